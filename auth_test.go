@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"project/libraryManagement/config"
+	"project/libraryManagement/models"
+	"project/libraryManagement/outbox"
+	"project/libraryManagement/testutil"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+var otpPattern = regexp.MustCompile(`otp to log in to your account: (\d+)`)
+
+func TestOnboardedReaderLogsInWithEmailedOTP(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	testutil.SetupDB(t)
+	mail := testutil.Mailer(t)
+
+	library := testutil.CreateLibrary(t, "Library")
+	admin := testutil.CreateUser(t, library.ID, "admin", "admin@library.test")
+
+	r := SetupRouter()
+	registerRoutes(r)
+	f := &tenantFixture{router: r}
+
+	w := f.do("POST", "/admin/onboard/reader", testutil.Token(t, admin), gin.H{"user": "new@library.test"})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	welcome, ok := mail.Last("new@library.test")
+	assert.True(t, ok)
+	assert.Equal(t, "Reader Onboarding", welcome.Subject)
+
+	w = f.do("POST", "/auth/login", "", gin.H{"email": "new@library.test"})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	otpMail, _ := mail.Last("new@library.test")
+	match := otpPattern.FindStringSubmatch(otpMail.Body)
+	if match == nil {
+		t.Fatalf("no otp in %q", otpMail.Body)
+	}
+
+	w = f.do("POST", "/auth/otp/verify", "", gin.H{"email": "new@library.test", "otp": match[1]})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var session struct {
+		Token string `json:"token"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &session)
+	assert.NotEmpty(t, session.Token)
+
+	w = f.do("GET", "/reader/balance", session.Token, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// a failing mailer no longer fails onboarding, the welcome mail stays queued
+	mail.Fail(assert.AnError)
+	w = f.do("POST", "/admin/onboard/reader", testutil.Token(t, admin), gin.H{"user": "offline@library.test"})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var queued models.OutboxMessage
+	config.DB.Where("\"to\" = ?", "offline@library.test").First(&queued)
+	assert.Equal(t, outbox.StatusPending, queued.Status)
+	assert.Equal(t, uint(1), queued.Attempts)
+
+	// the worker delivers it once the mailer is back and the backoff passed
+	mail.Fail(nil)
+	sent, failed, err := outbox.Deliver(config.DB, time.Now().Add(time.Hour), 10)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, sent)
+	assert.Equal(t, 0, failed)
+
+	welcome, ok = mail.Last("offline@library.test")
+	assert.True(t, ok)
+	assert.Equal(t, "Reader Onboarding", welcome.Subject)
+}
+
+func TestAdminCannotReadOTPs(t *testing.T) {
+	f := setupTenants(t)
+	mail := testutil.Mailer(t)
+
+	w := f.do("POST", "/auth/login", "", gin.H{"email": "reader@own.test"})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	otpMail, _ := mail.Last("reader@own.test")
+	code := otpPattern.FindStringSubmatch(otpMail.Body)[1]
+
+	// the code is mailed but never queued, and notifications are listed without their bodies
+	var queued int64
+	config.DB.Model(&models.OutboxMessage{}).Where("body LIKE ? OR html_body LIKE ?", "%"+code+"%", "%"+code+"%").Count(&queued)
+	assert.Equal(t, int64(0), queued)
+
+	outbox.Enqueue(config.DB, f.ownBook.LibID, "reader@own.test", "Secret", "only for the reader")
+	w = f.do("GET", "/admin/notifications", f.adminToken, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), code)
+	assert.NotContains(t, w.Body.String(), "only for the reader")
+	assert.Contains(t, w.Body.String(), "Secret")
+
+	// an otp that couldn't be mailed can be requested again right away
+	mail.Fail(assert.AnError)
+	w = f.do("POST", "/auth/login", "", gin.H{"email": "admin@own.test"})
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+
+	mail.Fail(nil)
+	w = f.do("POST", "/auth/login", "", gin.H{"email": "admin@own.test"})
+	assert.Equal(t, http.StatusOK, w.Code)
+}
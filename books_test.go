@@ -0,0 +1,283 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"project/libraryManagement/config"
+	"project/libraryManagement/models"
+	"project/libraryManagement/testutil"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateInventoryNormalizesISBN(t *testing.T) {
+	f := setupTenants(t)
+
+	w := f.do("POST", "/admin/create/inventory", f.adminToken, gin.H{"isbn": "0-306-40615-2", "title": "Numerical Methods", "totalCopies": 1})
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	var book models.BookInventory
+	config.DB.Where("title = ?", "Numerical Methods").First(&book)
+	assert.Equal(t, "9780306406157", book.ISBN)
+
+	// the same isbn, in either form, adds copies to the same book
+	w = f.do("POST", "/admin/create/inventory", f.adminToken, gin.H{"isbn": "978-0-306-40615-7", "title": "Numerical Methods", "totalCopies": 2})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	config.DB.First(&book, book.ID)
+	assert.Equal(t, uint(3), book.TotalCopies)
+}
+
+func TestCreateInventoryRejectsInvalidISBN(t *testing.T) {
+	f := setupTenants(t)
+
+	w := f.do("POST", "/admin/create/inventory", f.adminToken, gin.H{"isbn": "0-306-40615-3", "title": "Bad Checksum", "totalCopies": 1})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestSameISBNInTwoLibraries(t *testing.T) {
+	f := setupTenants(t)
+
+	assert.NoError(t, config.DB.Model(f.otherBook).Update("isbn", "9780306406157").Error)
+
+	w := f.do("POST", "/admin/create/inventory", f.adminToken, gin.H{"isbn": "9780306406157", "title": "Numerical Methods", "totalCopies": 1})
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	// but only once per library
+	second := testutil.CreateBook(t, f.otherBook.LibID, "Duplicate", 1)
+	assert.Error(t, config.DB.Model(second).Update("isbn", "9780306406157").Error)
+}
+
+func TestRequestsAcceptISBN(t *testing.T) {
+	f := setupTenants(t)
+
+	assert.NoError(t, config.DB.Model(f.ownBook).Update("isbn", "9780306406157").Error)
+
+	w := f.do("POST", "/reader/issue/request", f.readerToken, gin.H{"isbn": "0306406152"})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var event models.RequestEvent
+	assert.NoError(t, config.DB.Where("book_id = ? AND request_type = ?", f.ownBook.ID, "issue").First(&event).Error)
+
+	w = f.do("POST", "/reader/issue/request", f.readerToken, gin.H{"isbn": "0306406153"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = f.do("POST", "/admin/add/book", f.adminToken, gin.H{"isbn": "978-0-306-40615-7", "copies": 1})
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	w = f.do("DELETE", fmt.Sprintf("/admin/delete/book/%s", "9780306406157"), f.adminToken, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var book models.BookInventory
+	config.DB.First(&book, f.ownBook.ID)
+	assert.Equal(t, uint(2), book.TotalCopies)
+}
+
+func TestCopyCodesAndLabels(t *testing.T) {
+	f := setupTenants(t)
+
+	var item models.BookCopy
+	config.DB.Where("book_id = ?", f.ownBook.ID).First(&item)
+
+	w := f.do("GET", "/admin/copy/"+item.Barcode, f.adminToken, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var res struct {
+		ItemURL string `json:"itemUrl"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &res)
+	path := strings.TrimPrefix(res.ItemURL, "http://localhost:3001")
+
+	// the qr code target and image are public
+	w = f.do("GET", path, "", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), item.Barcode)
+
+	w = f.do("GET", path+"/qr?format=svg&level=Q", "", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "image/svg+xml", w.Header().Get("Content-Type"))
+
+	w = f.do("GET", path+"x/qr", "", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = f.do("POST", "/admin/labels", f.adminToken, gin.H{"bookIds": []uint{f.ownBook.ID}})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/pdf", w.Header().Get("Content-Type"))
+
+	// copies of another library are not printed
+	w = f.do("POST", "/admin/labels", f.adminToken, gin.H{"bookIds": []uint{f.otherBook.ID}})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestSearchBookRanksPartialMatches(t *testing.T) {
+	f := setupTenants(t)
+
+	goblet := testutil.CreateBook(t, f.ownBook.LibID, "Harry Potter and the Goblet of Fire", 1)
+	config.DB.Model(goblet).Updates(map[string]interface{}{"authors": models.StringArray{"J. K. Rowling"}, "subjects": models.StringArray{"Wizards", "Schools"}})
+	testutil.CreateBook(t, f.ownBook.LibID, "Potter's Field", 1)
+	testutil.CreateBook(t, f.otherBook.LibID, "Harry Potter and the Chamber of Secrets", 1)
+
+	var res struct {
+		Result []struct {
+			ID        uint    `json:"id"`
+			Title     string  `json:"title"`
+			Rank      float64 `json:"rank"`
+			Highlight string  `json:"highlight"`
+			Snippet   string  `json:"snippet"`
+		} `json:"result"`
+	}
+
+	w := f.do("POST", "/reader/book/search", f.readerToken, gin.H{"query": "harry potter"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	json.Unmarshal(w.Body.Bytes(), &res)
+	assert.Len(t, res.Result, 1)
+	assert.Equal(t, goblet.ID, res.Result[0].ID)
+	assert.Equal(t, "<mark>Harry</mark> <mark>Potter</mark> and the Goblet of Fire", res.Result[0].Highlight)
+
+	// prefixes match and the title outranks the subjects
+	w = f.do("POST", "/reader/book/search", f.readerToken, gin.H{"query": "pott"})
+	json.Unmarshal(w.Body.Bytes(), &res)
+	assert.Len(t, res.Result, 2)
+
+	w = f.do("POST", "/reader/book/search", f.readerToken, gin.H{"query": "wizard"})
+	json.Unmarshal(w.Body.Bytes(), &res)
+	assert.Len(t, res.Result, 1)
+	assert.Contains(t, res.Result[0].Snippet, "<mark>Wizards</mark>")
+
+	// misspelled titles are still found
+	w = f.do("POST", "/reader/book/search", f.readerToken, gin.H{"query": "goblit"})
+	json.Unmarshal(w.Body.Bytes(), &res)
+	assert.Len(t, res.Result, 1)
+}
+
+func TestSearchBookPagesFiltersAndFacets(t *testing.T) {
+	f := setupTenants(t)
+	lib := f.ownBook.LibID
+
+	dune := testutil.CreateBook(t, lib, "Dune", 1)
+	config.DB.Model(dune).Updates(map[string]interface{}{"authors": models.StringArray{"Frank Herbert"}, "language": "en", "year": 1965, "times_borrowed": 5, "available_copies": 0})
+	emma := testutil.CreateBook(t, lib, "Emma", 1)
+	config.DB.Model(emma).Updates(map[string]interface{}{"authors": models.StringArray{"Jane Austen"}, "language": "en", "year": 1815, "times_borrowed": 2})
+	prince := testutil.CreateBook(t, lib, "Le Petit Prince", 1)
+	config.DB.Model(prince).Updates(map[string]interface{}{"language": "fr", "year": 1943, "times_borrowed": 9})
+
+	type page struct {
+		Result []struct {
+			Title string `json:"title"`
+		} `json:"result"`
+		List []struct {
+			Title string `json:"title"`
+		} `json:"list"`
+		NextCursor string `json:"nextCursor"`
+		Total      int64  `json:"total"`
+		Facets     struct {
+			Languages []struct {
+				Value string `json:"value"`
+				Count int64  `json:"count"`
+			} `json:"languages"`
+			Available int64 `json:"available"`
+		} `json:"facets"`
+	}
+	titles := func(p page) []string {
+		out := []string{}
+		for _, r := range append(p.Result, p.List...) {
+			out = append(out, r.Title)
+		}
+		return out
+	}
+
+	// pages follow each other through the cursor, the facets cover every match
+	var first page
+	w := f.do("POST", "/reader/book/search", f.readerToken, gin.H{"sort": "title", "limit": 2})
+	assert.Equal(t, http.StatusOK, w.Code)
+	json.Unmarshal(w.Body.Bytes(), &first)
+	assert.Equal(t, []string{"Dune", "Emma"}, titles(first))
+	assert.Equal(t, int64(4), first.Total)
+	assert.NotEmpty(t, first.NextCursor)
+	assert.Equal(t, "en", first.Facets.Languages[0].Value)
+	assert.Equal(t, int64(2), first.Facets.Languages[0].Count)
+	assert.Equal(t, int64(3), first.Facets.Available)
+
+	var second page
+	w = f.do("POST", "/reader/book/search", f.readerToken, gin.H{"sort": "title", "limit": 2, "cursor": first.NextCursor})
+	json.Unmarshal(w.Body.Bytes(), &second)
+	assert.Equal(t, []string{"Le Petit Prince", "Own Book"}, titles(second))
+	assert.Empty(t, second.NextCursor)
+
+	var borrowed page
+	w = f.do("POST", "/reader/book/search", f.readerToken, gin.H{"sort": "borrowed", "limit": 2})
+	json.Unmarshal(w.Body.Bytes(), &borrowed)
+	assert.Equal(t, []string{"Le Petit Prince", "Dune"}, titles(borrowed))
+
+	var filtered page
+	w = f.do("POST", "/reader/book/search", f.readerToken, gin.H{"language": "EN", "availableOnly": true})
+	json.Unmarshal(w.Body.Bytes(), &filtered)
+	assert.Equal(t, []string{"Emma"}, titles(filtered))
+
+	w = f.do("POST", "/reader/book/search", f.readerToken, gin.H{"author": "frank herbert", "yearFrom": 1900, "yearTo": 1970})
+	json.Unmarshal(w.Body.Bytes(), &filtered)
+	assert.Equal(t, []string{"Dune"}, titles(filtered))
+
+	// a cursor only continues the sort it came from
+	for _, body := range []gin.H{{"sort": "popular"}, {"yearFrom": 1900, "yearTo": 1800}, {"sort": "borrowed", "cursor": first.NextCursor}} {
+		w = f.do("POST", "/reader/book/search", f.readerToken, body)
+		assert.Equal(t, http.StatusBadRequest, w.Code, body)
+	}
+
+	// the public listing takes the same query as parameters
+	var public page
+	w = f.do("GET", fmt.Sprintf("/book/lib/%d?language=fr&sort=newest", lib), "", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	json.Unmarshal(w.Body.Bytes(), &public)
+	assert.Equal(t, []string{"Le Petit Prince"}, titles(public))
+
+	w = f.do("GET", fmt.Sprintf("/book/lib/%d?sort=newest", f.otherBook.LibID), "", nil)
+	json.Unmarshal(w.Body.Bytes(), &public)
+	assert.Equal(t, []string{"Other Book"}, titles(public))
+
+	w = f.do("GET", "/book/lib/9999", "", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestSuggestBooksFollowsTheCatalog(t *testing.T) {
+	f := setupTenants(t)
+
+	var res struct {
+		Suggestions []struct {
+			Text  string `json:"text"`
+			Kind  string `json:"kind"`
+			Books int    `json:"books"`
+		} `json:"suggestions"`
+	}
+	suggest := func(prefix string) []string {
+		w := f.do("GET", "/reader/book/suggest?query="+prefix, f.readerToken, nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		res.Suggestions = nil
+		json.Unmarshal(w.Body.Bytes(), &res)
+
+		texts := []string{}
+		for _, s := range res.Suggestions {
+			texts = append(texts, s.Kind+":"+s.Text)
+		}
+		return texts
+	}
+
+	// only the reader's library is suggested
+	assert.Equal(t, []string{"title:Own Book"}, suggest("boo"))
+	assert.Empty(t, suggest("other"))
+
+	// new and changed books are suggested straight away
+	w := f.do("POST", "/admin/create/inventory", f.adminToken, gin.H{"title": "Brave New World", "authors": []string{"Aldous Huxley"}, "subjects": []string{"Dystopias"}})
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, []string{"title:Brave New World"}, suggest("brave"))
+	assert.Equal(t, []string{"author:Aldous Huxley"}, suggest("hux"))
+
+	w = f.do("PATCH", "/admin/update/book", f.adminToken, gin.H{"bookId": f.ownBook.ID, "title": "Brave Little Toaster"})
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, []string{"title:Brave New World", "title:Brave Little Toaster"}, suggest("brave"))
+	assert.Empty(t, suggest("own"))
+}
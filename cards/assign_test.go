@@ -0,0 +1,80 @@
+package cards
+
+import (
+	"path/filepath"
+	"project/libraryManagement/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// open a fresh sqlite database with the tables of the readers and their replaced cards
+func setupDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("failed to open test database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.Library{}, &models.Users{}, &models.ReplacedCard{}); err != nil {
+		t.Fatalf("failed to migrate test database: %v", err)
+	}
+	t.Cleanup(func() {
+		sqlDB, _ := db.DB()
+		sqlDB.Close()
+	})
+
+	return db
+}
+
+// make Generate return the numbers in turn
+func generateNumbers(t *testing.T, numbers ...string) {
+	t.Helper()
+
+	previous := generate
+	generate = func() (string, error) {
+		number := numbers[0]
+		if len(numbers) > 1 {
+			numbers = numbers[1:]
+		}
+		return number, nil
+	}
+	t.Cleanup(func() { generate = previous })
+}
+
+func TestAssignSkipsUsedNumbers(t *testing.T) {
+	db := setupDB(t)
+
+	used, _ := Generate()
+	replaced, _ := Generate()
+	free, _ := Generate()
+
+	db.Create(&models.Users{Email: "used@library.test", Role: "reader", CardNumber: used})
+	db.Create(&models.ReplacedCard{Number: replaced})
+
+	generateNumbers(t, used, replaced, free)
+	reader := models.Users{Email: "reader@library.test", Role: "reader"}
+	assert.NoError(t, Assign(db, &reader))
+	assert.Equal(t, free, reader.CardNumber)
+
+	// every attempt collides
+	generateNumbers(t, used)
+	other := models.Users{Email: "other@library.test", Role: "reader"}
+	assert.ErrorIs(t, Assign(db, &other), ErrCardNumbersExhausted)
+	assert.Empty(t, other.CardNumber)
+}
+
+func TestCardNumbersAreUnique(t *testing.T) {
+	db := setupDB(t)
+
+	number, _ := Generate()
+	assert.NoError(t, db.Create(&models.Users{Email: "reader@library.test", Role: "reader", CardNumber: number}).Error)
+	assert.Error(t, db.Create(&models.Users{Email: "other@library.test", Role: "reader", CardNumber: number}).Error)
+
+	// staff have no card
+	assert.NoError(t, db.Create(&models.Users{Email: "admin@library.test", Role: "admin"}).Error)
+	assert.NoError(t, db.Create(&models.Users{Email: "owner@library.test", Role: "owner"}).Error)
+}
@@ -0,0 +1,179 @@
+package cards
+
+import (
+	"crypto/rand"
+	"errors"
+	"math/big"
+	"project/libraryManagement/models"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// card numbers are 12 digits: the prefix, 10 random digits and a luhn check digit
+const (
+	Prefix = "2"
+	Length = 12
+)
+
+// random numbers tried before giving up on finding an unused one
+const assignAttempts = 5
+
+var (
+	ErrInvalidNumber        = errors.New("invalid card number")
+	ErrNotFound             = errors.New("no reader has this card")
+	ErrReplaced             = errors.New("card has been replaced, please use the new card")
+	ErrCardNumbersExhausted = errors.New("no unused card number could be found, please try again")
+)
+
+// source of new card numbers, replaced in tests
+var generate = Generate
+
+// luhn check digit of the digits
+func CheckDigit(digits string) byte {
+	sum := 0
+	double := true
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := int(digits[i] - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+
+	return byte('0' + (10-sum%10)%10)
+}
+
+// card number without the spaces or hyphens it may be printed with
+func Normalize(number string) string {
+	return strings.NewReplacer(" ", "", "-", "").Replace(strings.TrimSpace(number))
+}
+
+// whether the number is a well formed card number with a valid check digit
+func Valid(number string) bool {
+	number = Normalize(number)
+	if len(number) != Length || !strings.HasPrefix(number, Prefix) {
+		return false
+	}
+
+	for _, r := range number {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+
+	return CheckDigit(number[:Length-1]) == number[Length-1]
+}
+
+// new random card number
+func Generate() (string, error) {
+	random := Length - len(Prefix) - 1
+
+	max := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(random)), nil)
+	n, err := rand.Int(rand.Reader, max)
+	if err != nil {
+		return "", err
+	}
+
+	digits := Prefix + leftPad(n.String(), random)
+	return digits + string(CheckDigit(digits)), nil
+}
+
+func leftPad(s string, length int) string {
+	return strings.Repeat("0", length-len(s)) + s
+}
+
+// card number as printed, in blocks of four digits
+func Format(number string) string {
+	var blocks []string
+	for len(number) > 4 {
+		blocks = append(blocks, number[:4])
+		number = number[4:]
+	}
+
+	return strings.Join(append(blocks, number), " ")
+}
+
+// give the reader a new card number, unique across libraries and never used before
+func Assign(tx *gorm.DB, reader *models.Users) error {
+	for attempt := 0; attempt < assignAttempts; attempt++ {
+		number, err := generate()
+		if err != nil {
+			return err
+		}
+
+		var taken, replaced int64
+		if err := tx.Model(&models.Users{}).Where("card_number = ?", number).Count(&taken).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.ReplacedCard{}).Where("number = ?", number).Count(&replaced).Error; err != nil {
+			return err
+		}
+		if taken+replaced > 0 {
+			continue
+		}
+
+		reader.CardNumber = number
+		if reader.ID == 0 {
+			return nil
+		}
+
+		return tx.Model(reader).Update("card_number", number).Error
+	}
+
+	return ErrCardNumbersExhausted
+}
+
+// give the reader a new card, the old number stops working and is kept so it is never reissued
+func Replace(db *gorm.DB, reader *models.Users, staffID uint) (string, error) {
+	old := reader.CardNumber
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if old != "" {
+			replaced := models.ReplacedCard{Number: old, UserID: reader.ID, ReplacedByID: staffID, ReplacedAt: time.Now(), LibID: reader.LibID}
+			if err := tx.Create(&replaced).Error; err != nil {
+				return err
+			}
+		}
+
+		return Assign(tx, reader)
+	})
+	if err != nil {
+		reader.CardNumber = old
+		return "", err
+	}
+
+	return old, nil
+}
+
+// reader of the library holding the card
+func FindReader(db *gorm.DB, libID uint, number string) (*models.Users, error) {
+	var reader models.Users
+
+	number = Normalize(number)
+	if !Valid(number) {
+		return nil, ErrInvalidNumber
+	}
+
+	res := db.Where("card_number = ? AND lib_id = ? AND role = ?", number, libID, "reader").First(&reader)
+	if res.Error != nil {
+		if !errors.Is(res.Error, gorm.ErrRecordNotFound) {
+			return nil, res.Error
+		}
+
+		// tell a replaced card apart from a mistyped one
+		var replaced int64
+		db.Model(&models.ReplacedCard{}).Where("number = ? AND lib_id = ?", number, libID).Count(&replaced)
+		if replaced > 0 {
+			return nil, ErrReplaced
+		}
+		return nil, ErrNotFound
+	}
+
+	return &reader, nil
+}
@@ -0,0 +1,49 @@
+package cards
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckDigit(t *testing.T) {
+	assert.Equal(t, byte('3'), CheckDigit("7992739871"))
+	assert.Equal(t, byte('6'), CheckDigit("20000000000"))
+}
+
+func TestGenerate(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		number, err := Generate()
+		assert.NoError(t, err)
+		assert.Len(t, number, Length)
+		assert.True(t, Valid(number), number)
+	}
+}
+
+func TestValid(t *testing.T) {
+	number, _ := Generate()
+
+	assert.True(t, Valid(number[:4]+" "+number[4:8]+"-"+number[8:]))
+
+	// a single mistyped digit is caught
+	wrong := []byte(number)
+	wrong[5] = '0' + (wrong[5]-'0'+1)%10
+	assert.False(t, Valid(string(wrong)))
+
+	assert.False(t, Valid("1"+number[1:]))
+	assert.False(t, Valid(number[:11]))
+	assert.False(t, Valid(number[:11]+"x"))
+}
+
+func TestValidPIN(t *testing.T) {
+	assert.True(t, ValidPIN("1234"))
+	assert.True(t, ValidPIN("12345678"))
+	assert.False(t, ValidPIN("123"))
+	assert.False(t, ValidPIN("123456789"))
+	assert.False(t, ValidPIN("12a4"))
+}
+
+func TestFormat(t *testing.T) {
+	assert.Equal(t, "2000 0000 0006", Format("200000000006"))
+	assert.Equal(t, "12", Format("12"))
+}
@@ -0,0 +1,132 @@
+package cards
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"project/libraryManagement/models"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// pins are 4 to 8 digits, a card is locked for a while after too many wrong pins
+const (
+	MinPINLength   = 4
+	MaxPINLength   = 8
+	MaxPINAttempts = 5
+	PINLockout     = 15 * time.Minute
+)
+
+var (
+	ErrInvalidPIN = errors.New("pin must be 4 to 8 digits")
+	ErrPINNotSet  = errors.New("no pin has been set for this card")
+	ErrWrongPIN   = errors.New("invalid card or pin")
+	ErrPINLocked  = errors.New("too many invalid pins, please try again later")
+)
+
+// whether the pin is 4 to 8 digits
+func ValidPIN(pin string) bool {
+	if len(pin) < MinPINLength || len(pin) > MaxPINLength {
+		return false
+	}
+
+	for _, r := range pin {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// hash the pin, binding it to the reader
+func hashPIN(readerID uint, pin string) string {
+	mac := hmac.New(sha256.New, []byte(os.Getenv("SECRET")))
+	mac.Write([]byte(fmt.Sprintf("pin:%d:%s", readerID, pin)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// set the pin of the reader, clearing any lockout
+func SetPIN(db *gorm.DB, reader *models.Users, pin string) error {
+	if !ValidPIN(pin) {
+		return ErrInvalidPIN
+	}
+
+	reader.PINHash = hashPIN(reader.ID, pin)
+	reader.PINAttempts = 0
+	reader.PINLockedUntil = nil
+
+	return db.Model(reader).Select("pin_hash", "pin_attempts", "pin_locked_until").Updates(reader).Error
+}
+
+// remove the pin of the reader, they can't use a kiosk until they set a new one
+func ClearPIN(db *gorm.DB, reader *models.Users) error {
+	reader.PINHash = ""
+	reader.PINAttempts = 0
+	reader.PINLockedUntil = nil
+
+	return db.Model(reader).Select("pin_hash", "pin_attempts", "pin_locked_until").Updates(reader).Error
+}
+
+// reader of the library holding the card, when the pin matches
+func Authenticate(db *gorm.DB, libID uint, number string, pin string) (*models.Users, error) {
+	reader, err := FindReader(db, libID, number)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return nil, ErrWrongPIN
+		}
+		return nil, err
+	}
+
+	// the reader's row is locked while the pin is checked, so parallel guesses are counted
+	// one after the other and can't exceed the limit
+	var outcome error
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var current models.Users
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", reader.ID).First(&current).Error; err != nil {
+			return err
+		}
+
+		now := time.Now()
+
+		if current.PINLockedUntil != nil && now.Before(*current.PINLockedUntil) {
+			outcome = ErrPINLocked
+			return nil
+		}
+
+		if current.PINHash == "" {
+			outcome = ErrPINNotSet
+			return nil
+		}
+
+		if !hmac.Equal([]byte(hashPIN(current.ID, pin)), []byte(current.PINHash)) {
+			outcome = ErrWrongPIN
+			updates := map[string]interface{}{"pin_attempts": current.PINAttempts + 1}
+			if current.PINAttempts+1 >= MaxPINAttempts {
+				outcome = ErrPINLocked
+				updates = map[string]interface{}{"pin_attempts": 0, "pin_locked_until": now.Add(PINLockout)}
+			}
+
+			return tx.Model(&models.Users{}).Where("id = ?", current.ID).Updates(updates).Error
+		}
+
+		if current.PINAttempts > 0 || current.PINLockedUntil != nil {
+			return tx.Model(&models.Users{}).Where("id = ?", current.ID).Updates(map[string]interface{}{"pin_attempts": 0, "pin_locked_until": nil}).Error
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if outcome != nil {
+		return nil, outcome
+	}
+
+	reader.PINAttempts, reader.PINLockedUntil = 0, nil
+	return reader, nil
+}
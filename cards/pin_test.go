@@ -0,0 +1,47 @@
+package cards_test
+
+import (
+	"project/libraryManagement/cards"
+	"project/libraryManagement/config"
+	"project/libraryManagement/testutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuthenticateLocksTheCard(t *testing.T) {
+	testutil.SetupDB(t)
+
+	library := testutil.CreateLibrary(t, "Library")
+	reader := testutil.CreateUser(t, library.ID, "reader", "reader@library.test")
+
+	_, err := cards.Authenticate(config.DB, library.ID, reader.CardNumber, "1234")
+	assert.ErrorIs(t, err, cards.ErrPINNotSet)
+
+	assert.NoError(t, cards.SetPIN(config.DB, reader, "1234"))
+
+	found, err := cards.Authenticate(config.DB, library.ID, cards.Format(reader.CardNumber), "1234")
+	assert.NoError(t, err)
+	assert.Equal(t, reader.ID, found.ID)
+
+	for i := 1; i < cards.MaxPINAttempts; i++ {
+		_, err = cards.Authenticate(config.DB, library.ID, reader.CardNumber, "9999")
+		assert.ErrorIs(t, err, cards.ErrWrongPIN)
+	}
+	_, err = cards.Authenticate(config.DB, library.ID, reader.CardNumber, "9999")
+	assert.ErrorIs(t, err, cards.ErrPINLocked)
+
+	// once locked even the right pin is refused, until an admin clears it and the reader sets a new one
+	_, err = cards.Authenticate(config.DB, library.ID, reader.CardNumber, "1234")
+	assert.ErrorIs(t, err, cards.ErrPINLocked)
+
+	assert.NoError(t, cards.ClearPIN(config.DB, reader))
+	assert.NoError(t, cards.SetPIN(config.DB, reader, "4321"))
+
+	_, err = cards.Authenticate(config.DB, library.ID, reader.CardNumber, "4321")
+	assert.NoError(t, err)
+
+	// a card of another library is unknown
+	_, err = cards.Authenticate(config.DB, library.ID+1, reader.CardNumber, "4321")
+	assert.ErrorIs(t, err, cards.ErrWrongPIN)
+}
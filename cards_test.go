@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"project/libraryManagement/cards"
+	"project/libraryManagement/config"
+	"project/libraryManagement/models"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReaderCards(t *testing.T) {
+	f := setupTenants(t)
+
+	var reader, otherReader models.Users
+	config.DB.Where("email = ?", "reader@own.test").First(&reader)
+	config.DB.Where("email = ?", "reader@other.test").First(&otherReader)
+
+	w := f.do("GET", "/reader/card", f.readerToken, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/pdf", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Body.String(), cards.Format(reader.CardNumber))
+
+	w = f.do("GET", "/reader/card?format=png", f.readerToken, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "image/png", w.Header().Get("Content-Type"))
+
+	// admins look readers up by card, in any printed form
+	w = f.do("GET", "/admin/card/"+cards.Format(reader.CardNumber), f.adminToken, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = f.do("GET", "/admin/card/"+otherReader.CardNumber, f.adminToken, nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = f.do("GET", fmt.Sprintf("/admin/reader/%d/card", otherReader.ID), f.adminToken, nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = f.do("POST", fmt.Sprintf("/admin/reader/%d/card/replace", reader.ID), f.adminToken, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var res struct {
+		Reader   models.Users `json:"reader"`
+		Replaced string       `json:"replacedCardNumber"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &res)
+	assert.Equal(t, reader.CardNumber, res.Replaced)
+	assert.NotEqual(t, reader.CardNumber, res.Reader.CardNumber)
+	assert.True(t, cards.Valid(res.Reader.CardNumber))
+
+	// the old card no longer works
+	w = f.do("GET", "/admin/card/"+reader.CardNumber, f.adminToken, nil)
+	assert.Equal(t, http.StatusGone, w.Code)
+
+	w = f.do("GET", "/admin/card/"+res.Reader.CardNumber, f.adminToken, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var item models.BookCopy
+	config.DB.Where("book_id = ?", f.ownBook.ID).First(&item)
+
+	w = f.do("POST", "/admin/desk/checkout", f.adminToken, gin.H{"card": reader.CardNumber, "code": item.Barcode})
+	assert.Equal(t, http.StatusGone, w.Code)
+
+	w = f.do("PUT", "/reader/pin", f.readerToken, gin.H{"pin": "12a4"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// a pin given at the desk is checked
+	w = f.do("PUT", "/reader/pin", f.readerToken, gin.H{"pin": "1234"})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = f.do("POST", "/admin/desk/checkout", f.adminToken, gin.H{"card": res.Reader.CardNumber, "pin": "9999", "code": item.Barcode})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = f.do("POST", "/admin/desk/checkout", f.adminToken, gin.H{"card": res.Reader.CardNumber, "pin": "1234", "code": item.Barcode})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	config.DB.First(&reader, reader.ID)
+	assert.NotEmpty(t, reader.PINHash)
+
+	w = f.do("DELETE", fmt.Sprintf("/admin/reader/%d/pin", reader.ID), f.adminToken, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	config.DB.First(&reader, reader.ID)
+	assert.Empty(t, reader.PINHash)
+}
@@ -0,0 +1,312 @@
+package circulation
+
+import (
+	"errors"
+	"project/libraryManagement/models"
+	"project/libraryManagement/outbox"
+	"project/libraryManagement/templates"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrRequestNotFound  = errors.New("request event does not exists")
+	ErrRequestProcessed = errors.New("request event has already been processed")
+	ErrWrongRequestType = errors.New("request event has a different type")
+	ErrBookNotFound     = errors.New("unable to find book")
+	ErrNotAvailable     = errors.New("book is not available")
+	ErrRegistryNotFound = errors.New("error finding the issue registry")
+)
+
+// lock a row until the transaction ends
+func forUpdate(tx *gorm.DB) *gorm.DB {
+	return tx.Clauses(clause.Locking{Strength: "UPDATE"})
+}
+
+// lock a pending request event of the given type
+func lockPendingRequest(tx *gorm.DB, reqID uint, requestType string) (*models.RequestEvent, error) {
+	var event models.RequestEvent
+
+	res := forUpdate(tx).Where("req_id = ?", reqID).First(&event)
+	if res.Error != nil {
+		if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+			return nil, ErrRequestNotFound
+		}
+		return nil, res.Error
+	}
+
+	if event.Status != "pending" {
+		return nil, ErrRequestProcessed
+	}
+
+	if requestType != "" && event.RequestType != requestType {
+		return nil, ErrWrongRequestType
+	}
+
+	return &event, nil
+}
+
+// lock the inventory row of a book
+func lockBook(tx *gorm.DB, bookID uint) (*models.BookInventory, error) {
+	var book models.BookInventory
+
+	res := forUpdate(tx).Where("id = ?", bookID).First(&book)
+	if res.Error != nil {
+		if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+			return nil, ErrBookNotFound
+		}
+		return nil, res.Error
+	}
+
+	return &book, nil
+}
+
+// who approves a request, a staff member or a self-service kiosk
+type approver struct {
+	staffID uint
+	kioskID *uint
+}
+
+func byStaff(staffID uint) approver {
+	return approver{staffID: staffID}
+}
+
+func byKiosk(kioskID uint) approver {
+	return approver{kioskID: &kioskID}
+}
+
+// staff member approving the request, nil for a kiosk
+func (a approver) staff() *uint {
+	if a.kioskID != nil {
+		return nil
+	}
+
+	staffID := a.staffID
+	return &staffID
+}
+
+// mark the request as approved by the approver
+func approve(tx *gorm.DB, event *models.RequestEvent, by approver, now time.Time) error {
+	event.ApproverID = by.staff()
+	event.KioskID = by.kioskID
+	event.ApprovalDate = &now
+	event.Status = "approved"
+
+	return tx.Model(event).Select("approver_id", "kiosk_id", "approval_date", "status").Updates(event).Error
+}
+
+// approve an issue request, lending one copy of the book and opening a registry entry
+func ApproveIssue(db *gorm.DB, reqID uint, approverID uint) (*models.IssueRegistery, error) {
+	return ApproveIssueCopy(db, reqID, approverID, "")
+}
+
+// approve an issue request lending the copy with the given barcode, any available copy when empty
+func ApproveIssueCopy(db *gorm.DB, reqID uint, approverID uint, barcode string) (*models.IssueRegistery, error) {
+	var registry *models.IssueRegistery
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		event, err := lockPendingRequest(tx, reqID, "issue")
+		if err != nil {
+			return err
+		}
+
+		registry, err = lend(tx, event, byStaff(approverID), barcode, time.Now())
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return registry, nil
+}
+
+// approve a locked issue request, lending a copy of the book and opening a registry entry
+func lend(tx *gorm.DB, event *models.RequestEvent, by approver, barcode string, now time.Time) (*models.IssueRegistery, error) {
+	book, err := lockBook(tx, event.BookId)
+	if err != nil {
+		return nil, err
+	}
+
+	policy, err := policyFor(tx, event.ReaderId, book)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkLoanLimit(tx, policy, event.ReaderId, false); err != nil {
+		return nil, err
+	}
+
+	// a ready hold has already reserved a copy for the reader
+	var hold models.Hold
+	held := forUpdate(tx).Where("book_id = ? AND reader_id = ? AND status = ?", event.BookId, event.ReaderId, HoldReady).First(&hold)
+	if held.Error != nil && !errors.Is(held.Error, gorm.ErrRecordNotFound) {
+		return nil, held.Error
+	}
+
+	var readyHold *models.Hold
+	if held.Error == nil {
+		readyHold = &hold
+	}
+
+	item, err := takeCopy(tx, book, readyHold, barcode)
+	if err != nil {
+		return nil, err
+	}
+
+	if readyHold != nil {
+		hold.Status = HoldFulfilled
+		hold.ClosedAt = &now
+		if err := tx.Model(&hold).Select("status", "closed_at").Updates(&hold).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	// update the availability of the book, a copy released from the hold goes to the next reader
+	if err := serveHolds(tx, book, now); err != nil {
+		return nil, err
+	}
+
+	if err := approve(tx, event, by, now); err != nil {
+		return nil, err
+	}
+
+	// update the issue registry
+	registry := models.IssueRegistery{BookID: event.BookId, CopyID: item.ID, ReaderID: event.ReaderId, IssueApproverID: by.staffID, IssueKioskID: by.kioskID, IssueStatus: "issued", IssueDate: now, ExpectedReturnDate: now.Add(policy.LoanPeriod()), LibID: book.LibID}
+	if err := tx.Create(&registry).Error; err != nil {
+		return nil, err
+	}
+
+	// most borrowed books are sorted by this count
+	if err := tx.Model(book).Update("times_borrowed", gorm.Expr("times_borrowed + 1")).Error; err != nil {
+		return nil, err
+	}
+
+	if err := notifyRequest(tx, event, templates.RequestApproved, book, &registry.ExpectedReturnDate); err != nil {
+		return nil, err
+	}
+
+	return &registry, nil
+}
+
+// approve a return request, putting the copy back into the inventory and closing the registry entry
+func ApproveReturn(db *gorm.DB, reqID uint, approverID uint) (*models.IssueRegistery, error) {
+	var registry models.IssueRegistery
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		event, err := lockPendingRequest(tx, reqID, "return")
+		if err != nil {
+			return err
+		}
+
+		// find the issue registry
+		res := forUpdate(tx).Where("book_id = ? AND reader_id = ? AND issue_status = ?", event.BookId, event.ReaderId, "issued").Order("issue_date").First(&registry)
+		if res.Error != nil {
+			if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+				return ErrRegistryNotFound
+			}
+			return res.Error
+		}
+
+		return receive(tx, event, &registry, byStaff(approverID), time.Now())
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &registry, nil
+}
+
+// approve a locked return request of a locked loan, putting the copy back on the shelf,
+// charging a late return and closing the registry entry
+func receive(tx *gorm.DB, event *models.RequestEvent, registry *models.IssueRegistery, by approver, now time.Time) error {
+	book, err := lockBook(tx, registry.BookID)
+	if err != nil {
+		return err
+	}
+
+	// put the copy back on the shelf
+	if err := returnCopy(tx, registry); err != nil {
+		return err
+	}
+
+	// the returned copy goes to the next reader in line
+	if err := serveHolds(tx, book, now); err != nil {
+		return err
+	}
+
+	if err := approve(tx, event, by, now); err != nil {
+		return err
+	}
+
+	// charge the reader for a late return
+	policy, err := policyFor(tx, registry.ReaderID, book)
+	if err != nil {
+		return err
+	}
+
+	if err := chargeFine(tx, policy, registry, now); err != nil {
+		return err
+	}
+
+	// close the issue registry
+	registry.ReturnDate = &now
+	registry.ReturnApproverID = by.staff()
+	registry.ReturnKioskID = by.kioskID
+	registry.IssueStatus = "returned"
+
+	if err := tx.Model(registry).Select("return_date", "return_approver_id", "return_kiosk_id", "issue_status", "fine").Updates(registry).Error; err != nil {
+		return err
+	}
+
+	return notifyRequest(tx, event, templates.RequestApproved, book, nil)
+}
+
+// queue the email telling a reader their request was approved or rejected
+func notifyRequest(tx *gorm.DB, event *models.RequestEvent, template string, book *models.BookInventory, dueDate *time.Time) error {
+	var reader models.Users
+
+	if err := tx.First(&reader, event.ReaderId).Error; err != nil {
+		return err
+	}
+
+	data := templates.Data{"RequestType": event.RequestType, "Title": book.Title, "DueDate": ""}
+	if dueDate != nil {
+		data["DueDate"] = dueDate.Format("02 Jan 2006")
+	}
+
+	_, err := outbox.EnqueueTemplate(tx, book.LibID, reader.Email, template, data)
+	return err
+}
+
+// reject a pending request
+func Reject(db *gorm.DB, reqID uint) (*models.RequestEvent, error) {
+	var rejected *models.RequestEvent
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		event, err := lockPendingRequest(tx, reqID, "")
+		if err != nil {
+			return err
+		}
+
+		event.Status = "rejected"
+		rejected = event
+
+		if err := tx.Model(event).Update("status", "rejected").Error; err != nil {
+			return err
+		}
+
+		book, err := lockBook(tx, event.BookId)
+		if err != nil {
+			return err
+		}
+
+		return notifyRequest(tx, event, templates.RequestRejected, book, nil)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return rejected, nil
+}
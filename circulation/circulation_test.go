@@ -0,0 +1,367 @@
+package circulation
+
+import (
+	"errors"
+	"fmt"
+	"project/libraryManagement/config"
+	"project/libraryManagement/models"
+	"project/libraryManagement/outbox"
+	"project/libraryManagement/tenant"
+	"project/libraryManagement/testutil"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// run fn concurrently for every request, returning the errors in order
+func approveInParallel(reqIDs []uint, fn func(reqID uint) error) []error {
+	errs := make([]error, len(reqIDs))
+	start := make(chan struct{})
+
+	var wg sync.WaitGroup
+	for i, reqID := range reqIDs {
+		wg.Add(1)
+		go func(i int, reqID uint) {
+			defer wg.Done()
+			<-start
+			errs[i] = fn(reqID)
+		}(i, reqID)
+	}
+
+	close(start)
+	wg.Wait()
+
+	return errs
+}
+
+func TestParallelIssueApprovalsNeverOverIssue(t *testing.T) {
+	testutil.SetupDB(t)
+
+	library := testutil.CreateLibrary(t, "Library")
+	admin := testutil.CreateUser(t, library.ID, "admin", "admin@library.test")
+	book := testutil.CreateBook(t, library.ID, "Last Copy", 1)
+
+	// ten readers waiting for the last copy
+	var reqIDs []uint
+	for i := 0; i < 10; i++ {
+		reader := testutil.CreateUser(t, library.ID, "reader", fmt.Sprintf("reader%d@library.test", i))
+		event := models.RequestEvent{BookId: book.ID, ReaderId: reader.ID, RequestDate: time.Now(), RequestType: "issue", Status: "pending", LibID: library.ID}
+		config.DB.Create(&event)
+		reqIDs = append(reqIDs, event.ReqId)
+	}
+
+	errs := approveInParallel(reqIDs, func(reqID uint) error {
+		_, err := ApproveIssue(tenant.ForLibrary(library.ID), reqID, admin.ID)
+		return err
+	})
+
+	approved := 0
+	for _, err := range errs {
+		if err == nil {
+			approved++
+		} else {
+			assert.ErrorIs(t, err, ErrNotAvailable)
+		}
+	}
+	assert.Equal(t, 1, approved)
+
+	var inventory models.BookInventory
+	config.DB.First(&inventory, book.ID)
+	assert.Equal(t, uint(0), inventory.AvailableCopies)
+
+	var issued int64
+	config.DB.Model(&models.IssueRegistery{}).Where("book_id = ? AND issue_status = ?", book.ID, "issued").Count(&issued)
+	assert.Equal(t, int64(1), issued)
+
+	var approvedEvents int64
+	config.DB.Model(&models.RequestEvent{}).Where("status = ?", "approved").Count(&approvedEvents)
+	assert.Equal(t, int64(1), approvedEvents)
+}
+
+func TestParallelApprovalsOfOneRequestApplyOnce(t *testing.T) {
+	testutil.SetupDB(t)
+
+	library := testutil.CreateLibrary(t, "Library")
+	admin := testutil.CreateUser(t, library.ID, "admin", "admin@library.test")
+	reader := testutil.CreateUser(t, library.ID, "reader", "reader@library.test")
+	book := testutil.CreateBook(t, library.ID, "Many Copies", 5)
+
+	event := models.RequestEvent{BookId: book.ID, ReaderId: reader.ID, RequestDate: time.Now(), RequestType: "issue", Status: "pending", LibID: library.ID}
+	config.DB.Create(&event)
+
+	reqIDs := []uint{event.ReqId, event.ReqId, event.ReqId, event.ReqId, event.ReqId}
+	errs := approveInParallel(reqIDs, func(reqID uint) error {
+		_, err := ApproveIssue(tenant.ForLibrary(library.ID), reqID, admin.ID)
+		return err
+	})
+
+	approved := 0
+	for _, err := range errs {
+		if err == nil {
+			approved++
+		} else if !errors.Is(err, ErrRequestProcessed) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	assert.Equal(t, 1, approved)
+
+	var inventory models.BookInventory
+	config.DB.First(&inventory, book.ID)
+	assert.Equal(t, uint(4), inventory.AvailableCopies)
+}
+
+func TestReturnPutsCopyBack(t *testing.T) {
+	testutil.SetupDB(t)
+
+	library := testutil.CreateLibrary(t, "Library")
+	admin := testutil.CreateUser(t, library.ID, "admin", "admin@library.test")
+	reader := testutil.CreateUser(t, library.ID, "reader", "reader@library.test")
+	book := testutil.CreateBook(t, library.ID, "Round Trip", 1)
+	db := tenant.ForLibrary(library.ID)
+
+	issue := models.RequestEvent{BookId: book.ID, ReaderId: reader.ID, RequestDate: time.Now(), RequestType: "issue", Status: "pending"}
+	db.Create(&issue)
+	_, err := ApproveIssue(db, issue.ReqId, admin.ID)
+	assert.NoError(t, err)
+
+	ret := models.RequestEvent{BookId: book.ID, ReaderId: reader.ID, RequestDate: time.Now(), RequestType: "return", Status: "pending"}
+	db.Create(&ret)
+	registry, err := ApproveReturn(db, ret.ReqId, admin.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "returned", registry.IssueStatus)
+
+	var inventory models.BookInventory
+	config.DB.First(&inventory, book.ID)
+	assert.Equal(t, uint(1), inventory.AvailableCopies)
+
+	_, err = ApproveReturn(db, ret.ReqId, admin.ID)
+	assert.ErrorIs(t, err, ErrRequestProcessed)
+}
+
+func TestRenewalExtendsLoanUntilHoldsWait(t *testing.T) {
+	testutil.SetupDB(t)
+
+	library := testutil.CreateLibrary(t, "Library")
+	admin := testutil.CreateUser(t, library.ID, "admin", "admin@library.test")
+	reader := testutil.CreateUser(t, library.ID, "reader", "reader@library.test")
+	waiting := testutil.CreateUser(t, library.ID, "reader", "waiting@library.test")
+	book := testutil.CreateBook(t, library.ID, "Popular", 1)
+	db := tenant.ForLibrary(library.ID)
+
+	issue := models.RequestEvent{BookId: book.ID, ReaderId: reader.ID, RequestDate: time.Now(), RequestType: "issue", Status: "pending"}
+	db.Create(&issue)
+	loan, err := ApproveIssue(db, issue.ReqId, admin.ID)
+	assert.NoError(t, err)
+
+	event, renewed, err := RequestRenewal(db, book.ID, reader.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "renew", event.RequestType)
+	assert.Equal(t, "approved", event.Status)
+	assert.Equal(t, uint(1), renewed.RenewalCount)
+	assert.WithinDuration(t, loan.ExpectedReturnDate.Add(DefaultPolicy.LoanPeriod()), renewed.ExpectedReturnDate, time.Second)
+
+	_, err = PlaceHold(db, book.ID, waiting.ID)
+	assert.NoError(t, err)
+
+	_, _, err = RequestRenewal(db, book.ID, reader.ID)
+	assert.ErrorIs(t, err, ErrHoldsWaiting)
+}
+
+func TestLateLoanCannotBeRenewed(t *testing.T) {
+	testutil.SetupDB(t)
+
+	library := testutil.CreateLibrary(t, "Library")
+	admin := testutil.CreateUser(t, library.ID, "admin", "admin@library.test")
+	reader := testutil.CreateUser(t, library.ID, "reader", "reader@library.test")
+	book := testutil.CreateBook(t, library.ID, "Late", 1)
+	db := tenant.ForLibrary(library.ID)
+
+	issue := models.RequestEvent{BookId: book.ID, ReaderId: reader.ID, RequestDate: time.Now(), RequestType: "issue", Status: "pending"}
+	db.Create(&issue)
+	loan, err := ApproveIssue(db, issue.ReqId, admin.ID)
+	assert.NoError(t, err)
+
+	// a renewal requested in time is refused on approval once the loan is late
+	approval := true
+	policy := models.LoanPolicy{RenewalApproval: &approval}
+	db.Create(&policy)
+	event, _, err := RequestRenewal(db, book.ID, reader.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "pending", event.Status)
+
+	due := time.Now().Add(-time.Hour)
+	db.Model(loan).Update("expected_return_date", due)
+
+	_, err = ApproveRenewal(db, event.ReqId, admin.ID)
+	assert.ErrorIs(t, err, ErrLoanOverdue)
+
+	db.Model(&policy).Update("renewal_approval", false)
+	_, _, err = RequestRenewal(db, book.ID, reader.ID)
+	assert.ErrorIs(t, err, ErrLoanOverdue)
+
+	// the due date is unchanged, so the return is still charged as late
+	db.First(loan, loan.IssueID)
+	assert.WithinDuration(t, due, loan.ExpectedReturnDate, time.Second)
+	assert.Equal(t, uint(0), loan.RenewalCount)
+}
+
+func TestPolicyOverridesAndLoanLimit(t *testing.T) {
+	testutil.SetupDB(t)
+
+	library := testutil.CreateLibrary(t, "Library")
+	admin := testutil.CreateUser(t, library.ID, "admin", "admin@library.test")
+	reader := testutil.CreateUser(t, library.ID, "reader", "reader@library.test")
+	db := tenant.ForLibrary(library.ID)
+
+	one, two, fourteen := uint(1), uint(2), uint(14)
+	db.Create(&models.LoanPolicy{MaxLoans: &one})
+	db.Create(&models.LoanPolicy{BookCategory: "reference", LoanPeriodDays: &two})
+	db.Create(&models.LoanPolicy{PatronCategory: "staff", LoanPeriodDays: &fourteen, MaxLoans: &two})
+
+	policy, err := ResolvePolicy(db, library.ID, "", "Reference")
+	assert.NoError(t, err)
+	assert.Equal(t, uint(2), policy.LoanPeriodDays)
+	assert.Equal(t, uint(1), policy.MaxLoans)
+	assert.Equal(t, DefaultPolicy.MaxRenewals, policy.MaxRenewals)
+
+	// the patron category wins over the book category
+	policy, err = ResolvePolicy(db, library.ID, "staff", "reference")
+	assert.NoError(t, err)
+	assert.Equal(t, uint(14), policy.LoanPeriodDays)
+	assert.Equal(t, uint(2), policy.MaxLoans)
+
+	first := testutil.CreateBook(t, library.ID, "First", 1)
+	second := testutil.CreateBook(t, library.ID, "Second", 1)
+
+	issue := models.RequestEvent{BookId: first.ID, ReaderId: reader.ID, RequestDate: time.Now(), RequestType: "issue", Status: "pending"}
+	db.Create(&issue)
+	_, err = ApproveIssue(db, issue.ReqId, admin.ID)
+	assert.NoError(t, err)
+
+	assert.ErrorIs(t, CheckIssueRequest(db, reader.ID, second), ErrLoanLimit)
+
+	issue = models.RequestEvent{BookId: second.ID, ReaderId: reader.ID, RequestDate: time.Now(), RequestType: "issue", Status: "pending"}
+	db.Create(&issue)
+	_, err = ApproveIssue(db, issue.ReqId, admin.ID)
+	assert.ErrorIs(t, err, ErrLoanLimit)
+}
+
+func TestGracePeriodFollowsThePolicy(t *testing.T) {
+	testutil.SetupDB(t)
+
+	library := testutil.CreateLibrary(t, "Library")
+	db := tenant.ForLibrary(library.ID)
+
+	one, five, rate := uint(1), uint(5), uint(10)
+	db.Create(&models.LoanPolicy{GracePeriodDays: &one, FinePerDay: &rate})
+	db.Create(&models.LoanPolicy{PatronCategory: "staff", GracePeriodDays: &five})
+
+	// three days and a bit late: charged four started days, unless still within the grace period
+	loan := &models.IssueRegistery{ExpectedReturnDate: time.Now().Add(-3*24*time.Hour - time.Hour)}
+
+	policy, err := ResolvePolicy(db, library.ID, "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, uint(40), computeFine(policy, loan, time.Now()))
+
+	policy, err = ResolvePolicy(db, library.ID, "Staff", "")
+	assert.NoError(t, err)
+	assert.Equal(t, uint(5), policy.GracePeriodDays)
+	assert.Equal(t, uint(0), computeFine(policy, loan, time.Now()))
+}
+
+func TestLateReturnChargesFineAndBlocksLoans(t *testing.T) {
+	testutil.SetupDB(t)
+
+	library := testutil.CreateLibrary(t, "Library")
+	admin := testutil.CreateUser(t, library.ID, "admin", "admin@library.test")
+	reader := testutil.CreateUser(t, library.ID, "reader", "reader@library.test")
+	book := testutil.CreateBook(t, library.ID, "Overdue", 1)
+	other := testutil.CreateBook(t, library.ID, "Next", 1)
+	db := tenant.ForLibrary(library.ID)
+
+	grace, rate, max := uint(1), uint(50), uint(100)
+	db.Create(&models.LoanPolicy{GracePeriodDays: &grace, FinePerDay: &rate, MaxBalance: &max})
+
+	issue := models.RequestEvent{BookId: book.ID, ReaderId: reader.ID, RequestDate: time.Now(), RequestType: "issue", Status: "pending"}
+	db.Create(&issue)
+	loan, err := ApproveIssue(db, issue.ReqId, admin.ID)
+	assert.NoError(t, err)
+
+	// three days and a bit late
+	config.DB.Model(loan).Update("expected_return_date", time.Now().Add(-3*24*time.Hour-time.Hour))
+
+	ret := models.RequestEvent{BookId: book.ID, ReaderId: reader.ID, RequestDate: time.Now(), RequestType: "return", Status: "pending"}
+	db.Create(&ret)
+	registry, err := ApproveReturn(db, ret.ReqId, admin.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, uint(200), registry.Fine)
+
+	balance, err := Balance(db, reader.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(200), balance)
+
+	assert.ErrorIs(t, CheckIssueRequest(db, reader.ID, other), ErrBalanceTooHigh)
+
+	_, err = RecordEntry(db, reader, EntryPayment, -10, "", admin.ID)
+	assert.ErrorIs(t, err, ErrInvalidAmount)
+
+	_, err = RecordEntry(db, reader, EntryPayment, 150, "cash", admin.ID)
+	assert.NoError(t, err)
+
+	balance, _ = Balance(db, reader.ID)
+	assert.Equal(t, int64(50), balance)
+	assert.NoError(t, CheckIssueRequest(db, reader.ID, other))
+}
+
+func TestDueNoticesAreSentOnceAndEscalate(t *testing.T) {
+	testutil.SetupDB(t)
+
+	mail := testutil.Mailer(t)
+
+	library := testutil.CreateLibrary(t, "Library")
+	admin := testutil.CreateUser(t, library.ID, "admin", "admin@library.test")
+	reader := testutil.CreateUser(t, library.ID, "reader", "reader@library.test")
+	book := testutil.CreateBook(t, library.ID, "Late", 1)
+	db := tenant.ForLibrary(library.ID)
+
+	issue := models.RequestEvent{BookId: book.ID, ReaderId: reader.ID, RequestDate: time.Now(), RequestType: "issue", Status: "pending"}
+	db.Create(&issue)
+	loan, err := ApproveIssue(db, issue.ReqId, admin.ID)
+	assert.NoError(t, err)
+
+	due := loan.ExpectedReturnDate
+	steps := []struct {
+		now  time.Time
+		sent int
+	}{
+		{due.Add(-5 * 24 * time.Hour), 0},
+		{due.Add(-24 * time.Hour), 1},
+		{due.Add(-23 * time.Hour), 0},
+		{due.Add(2 * 24 * time.Hour), 1},
+		{due.Add(3 * 24 * time.Hour), 0},
+		{due.Add(8 * 24 * time.Hour), 1},
+		{due.Add(20 * 24 * time.Hour), 1},
+		{due.Add(21 * 24 * time.Hour), 0},
+	}
+	for _, step := range steps {
+		sent, err := SendDueNotices(config.DB, step.now)
+		assert.NoError(t, err)
+		assert.Equal(t, step.sent, sent)
+	}
+
+	sent, _, err := outbox.Deliver(config.DB, time.Now().Add(30*24*time.Hour), 10)
+	assert.NoError(t, err)
+	assert.Equal(t, 5, sent)
+
+	var subjects []string
+	for _, msg := range mail.To(reader.Email) {
+		subjects = append(subjects, msg.Subject)
+	}
+	assert.Equal(t, []string{"Your issue request was approved", "Your book is due soon", "Your book is overdue", "Your book is a week overdue", "Final notice: your book is overdue"}, subjects)
+
+	var logged int64
+	config.DB.Model(&models.NoticeLog{}).Where("issue_id = ?", loan.IssueID).Count(&logged)
+	assert.Equal(t, int64(4), logged)
+}
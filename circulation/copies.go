@@ -0,0 +1,367 @@
+package circulation
+
+import (
+	"errors"
+	"fmt"
+	"project/libraryManagement/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// copy statuses
+const (
+	CopyAvailable = "available"
+	CopyOnLoan    = "on-loan"
+	CopyOnHold    = "on-hold"
+	CopyLost      = "lost"
+	CopyDamaged   = "damaged"
+	CopyInRepair  = "in-repair"
+	CopyWithdrawn = "withdrawn"
+)
+
+var (
+	ErrCopyNotFound      = errors.New("item does not exists")
+	ErrCopyExists        = errors.New("a item with this barcode or accession number already exists")
+	ErrCopyInUse         = errors.New("item is on loan or reserved for a hold")
+	ErrCopyNotLendable   = errors.New("item is not available for loan")
+	ErrInvalidCopyStatus = errors.New("invalid item status")
+	ErrCopyCount         = errors.New("count must be at least 1, and 1 when a barcode or accession number is given")
+)
+
+// statuses staff can set by hand, loans and holds move copies in and out of on-loan and on-hold
+var manualStatuses = map[string]bool{CopyAvailable: true, CopyLost: true, CopyDamaged: true, CopyInRepair: true, CopyWithdrawn: true}
+
+// copies counted in a book's total, lost and withdrawn copies are no longer part of the collection
+var collectionStatuses = []string{CopyAvailable, CopyOnLoan, CopyOnHold, CopyDamaged, CopyInRepair}
+
+// details of new copies, the barcode and accession number are assigned when empty
+type CopyDetails struct {
+	Barcode         string
+	AccessionNumber uint
+	Condition       string
+	AcquisitionDate *time.Time
+	Price           uint
+}
+
+// whether staff can set a copy to the status
+func ValidCopyStatus(status string) bool {
+	return manualStatuses[status]
+}
+
+// lock a copy of a book
+func lockCopy(tx *gorm.DB, query string, args ...interface{}) (*models.BookCopy, error) {
+	var item models.BookCopy
+
+	res := forUpdate(tx).Where(query, args...).First(&item)
+	if res.Error != nil {
+		if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+			return nil, ErrCopyNotFound
+		}
+		return nil, res.Error
+	}
+
+	return &item, nil
+}
+
+// change the status of a locked copy, a copy leaving on-hold is no longer reserved
+func setCopyStatus(tx *gorm.DB, item *models.BookCopy, status string) error {
+	item.Status = status
+	if status != CopyOnHold {
+		item.HoldID = nil
+	}
+
+	return tx.Model(item).Select("status", "hold_id").Updates(item).Error
+}
+
+// recount the copies of a locked book into its counters
+func syncCounters(tx *gorm.DB, book *models.BookInventory) error {
+	var total, available int64
+
+	if err := tx.Model(&models.BookCopy{}).Where("book_id = ? AND status IN ?", book.ID, collectionStatuses).Count(&total).Error; err != nil {
+		return err
+	}
+	if err := tx.Model(&models.BookCopy{}).Where("book_id = ? AND status = ?", book.ID, CopyAvailable).Count(&available).Error; err != nil {
+		return err
+	}
+
+	book.TotalCopies = uint(total)
+	book.AvailableCopies = uint(available)
+
+	return tx.Model(book).Updates(map[string]interface{}{"total_copies": book.TotalCopies, "available_copies": book.AvailableCopies}).Error
+}
+
+// add copies to a book, the new copies go to the readers waiting for the book first
+func AddCopies(db *gorm.DB, bookID uint, count uint, details CopyDetails) ([]models.BookCopy, error) {
+	var copies []models.BookCopy
+
+	if count == 0 || (count > 1 && (details.Barcode != "" || details.AccessionNumber != 0)) {
+		return nil, ErrCopyCount
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		book, err := lockBook(tx, bookID)
+		if err != nil {
+			return err
+		}
+
+		copies, err = createCopies(tx, book, count, details)
+		if err != nil {
+			return err
+		}
+
+		return serveHolds(tx, book, time.Now())
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return copies, nil
+}
+
+// create available copies of a locked book, numbering them after the library's last accession number
+func createCopies(tx *gorm.DB, book *models.BookInventory, count uint, details CopyDetails) ([]models.BookCopy, error) {
+	// the library row serializes accession numbers across its books
+	if err := forUpdate(tx).First(&models.Library{}, book.LibID).Error; err != nil {
+		return nil, err
+	}
+
+	if details.Barcode != "" || details.AccessionNumber != 0 {
+		var existing int64
+		tx.Model(&models.BookCopy{}).Where("lib_id = ? AND (barcode = ? OR accession_number = ?)", book.LibID, details.Barcode, details.AccessionNumber).Count(&existing)
+		if existing > 0 {
+			return nil, ErrCopyExists
+		}
+	}
+
+	var last uint
+	if err := tx.Model(&models.BookCopy{}).Where("lib_id = ?", book.LibID).Select("COALESCE(MAX(accession_number), 0)").Scan(&last).Error; err != nil {
+		return nil, err
+	}
+
+	condition := details.Condition
+	if condition == "" {
+		condition = "good"
+	}
+
+	copies := []models.BookCopy{}
+	for i := uint(0); i < count; i++ {
+		accession := details.AccessionNumber
+		if accession == 0 {
+			accession = last + i + 1
+		}
+
+		barcode := details.Barcode
+		if barcode == "" {
+			barcode = fmt.Sprintf("%08d", accession)
+		}
+
+		item := models.BookCopy{BookID: book.ID, Barcode: barcode, AccessionNumber: accession, Condition: condition, Status: CopyAvailable,
+			AcquisitionDate: details.AcquisitionDate, Price: details.Price, LibID: book.LibID}
+		if err := tx.Create(&item).Error; err != nil {
+			return nil, err
+		}
+
+		copies = append(copies, item)
+	}
+
+	return copies, nil
+}
+
+// change the status and/or condition of a copy, copies on loan or reserved for a hold
+// only change through circulation, except for a copy on loan reported lost, which closes its loan
+func UpdateCopy(db *gorm.DB, barcode string, status string, condition string) (*models.BookCopy, error) {
+	var updated *models.BookCopy
+
+	if status != "" && !manualStatuses[status] {
+		return nil, ErrInvalidCopyStatus
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var found models.BookCopy
+		if err := tx.Where("barcode = ?", barcode).First(&found).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrCopyNotFound
+			}
+			return err
+		}
+
+		// the book is locked before its copies, like everywhere else
+		book, err := lockBook(tx, found.BookID)
+		if err != nil {
+			return err
+		}
+
+		item, err := lockCopy(tx, "id = ?", found.ID)
+		if err != nil {
+			return err
+		}
+
+		if condition != "" {
+			item.Condition = condition
+			if err := tx.Model(item).Update("condition", condition).Error; err != nil {
+				return err
+			}
+		}
+
+		if status != "" && status != item.Status {
+			if item.Status == CopyOnHold || (item.Status == CopyOnLoan && status != CopyLost) {
+				return ErrCopyInUse
+			}
+
+			if item.Status == CopyOnLoan {
+				if err := closeLostLoan(tx, item, book, time.Now()); err != nil {
+					return err
+				}
+			}
+
+			if err := setCopyStatus(tx, item, status); err != nil {
+				return err
+			}
+		}
+
+		updated = item
+
+		// a copy back on the shelf goes to the readers waiting for the book first
+		return serveHolds(tx, book, time.Now())
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return updated, nil
+}
+
+// close the loan of a copy reported lost, charging the reader the fine of the days late so far and the price
+// of the copy. The loan no longer counts against the reader's limit nor gets notices
+func closeLostLoan(tx *gorm.DB, item *models.BookCopy, book *models.BookInventory, now time.Time) error {
+	var registry models.IssueRegistery
+
+	res := forUpdate(tx).Where("copy_id = ? AND issue_status = ?", item.ID, "issued").First(&registry)
+	if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if res.Error != nil {
+		return res.Error
+	}
+
+	policy, err := policyFor(tx, registry.ReaderID, book)
+	if err != nil {
+		return err
+	}
+	if err := chargeFine(tx, policy, &registry, now); err != nil {
+		return err
+	}
+
+	if item.Price > 0 {
+		entry := models.LedgerEntry{ReaderID: registry.ReaderID, Type: EntryCharge, Amount: int64(item.Price),
+			Note: fmt.Sprintf("lost item %s, %s", item.Barcode, book.Title), IssueID: &registry.IssueID, LibID: registry.LibID}
+		if err := tx.Create(&entry).Error; err != nil {
+			return err
+		}
+	}
+
+	registry.IssueStatus = "lost"
+	return tx.Model(&registry).Select("issue_status", "fine").Updates(&registry).Error
+}
+
+// withdraw one available copy of a book
+func WithdrawCopy(db *gorm.DB, bookID uint) (*models.BookInventory, error) {
+	var book *models.BookInventory
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+
+		book, err = lockBook(tx, bookID)
+		if err != nil {
+			return err
+		}
+
+		item, err := lockCopy(tx, "book_id = ? AND status = ?", bookID, CopyAvailable)
+		if errors.Is(err, ErrCopyNotFound) {
+			return ErrNotAvailable
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := setCopyStatus(tx, item, CopyWithdrawn); err != nil {
+			return err
+		}
+
+		return syncCounters(tx, book)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return book, nil
+}
+
+// pick the copy to lend and put it on loan: the scanned copy, else the copy reserved
+// for the reader's hold, else any available copy
+func takeCopy(tx *gorm.DB, book *models.BookInventory, hold *models.Hold, barcode string) (*models.BookCopy, error) {
+	var reserved *models.BookCopy
+
+	if hold != nil {
+		item, err := lockCopy(tx, "hold_id = ? AND status = ?", hold.ID, CopyOnHold)
+		if err != nil && !errors.Is(err, ErrCopyNotFound) {
+			return nil, err
+		}
+		reserved = item
+	}
+
+	var item *models.BookCopy
+	var err error
+
+	switch {
+	case barcode != "":
+		item, err = lockCopy(tx, "book_id = ? AND barcode = ?", book.ID, barcode)
+		if err != nil {
+			return nil, err
+		}
+
+		isReserved := reserved != nil && reserved.ID == item.ID
+		if item.Status != CopyAvailable && !isReserved {
+			return nil, ErrCopyNotLendable
+		}
+
+		// another copy was handed out, the reserved one goes back to the shelf
+		if reserved != nil && !isReserved {
+			if err := setCopyStatus(tx, reserved, CopyAvailable); err != nil {
+				return nil, err
+			}
+		}
+	case reserved != nil:
+		item = reserved
+	default:
+		item, err = lockCopy(tx, "book_id = ? AND status = ?", book.ID, CopyAvailable)
+		if errors.Is(err, ErrCopyNotFound) {
+			return nil, ErrNotAvailable
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := setCopyStatus(tx, item, CopyOnLoan); err != nil {
+		return nil, err
+	}
+
+	return item, nil
+}
+
+// put the copy of a closed loan back on the shelf
+func returnCopy(tx *gorm.DB, registry *models.IssueRegistery) error {
+	if registry.CopyID == 0 {
+		return nil
+	}
+
+	item, err := lockCopy(tx, "id = ?", registry.CopyID)
+	if err != nil {
+		return err
+	}
+
+	// a copy reported lost is found again once returned
+	return setCopyStatus(tx, item, CopyAvailable)
+}
@@ -0,0 +1,146 @@
+package circulation
+
+import (
+	"project/libraryManagement/config"
+	"project/libraryManagement/models"
+	"project/libraryManagement/tenant"
+	"project/libraryManagement/testutil"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoansTrackTheCopy(t *testing.T) {
+	testutil.SetupDB(t)
+
+	library := testutil.CreateLibrary(t, "Library")
+	admin := testutil.CreateUser(t, library.ID, "admin", "admin@library.test")
+	reader := testutil.CreateUser(t, library.ID, "reader", "reader@library.test")
+	book := testutil.CreateBook(t, library.ID, "Two Copies", 2)
+	db := tenant.ForLibrary(library.ID)
+
+	// the scanned copy is the one lent
+	issue := models.RequestEvent{BookId: book.ID, ReaderId: reader.ID, RequestDate: time.Now(), RequestType: "issue", Status: "pending"}
+	db.Create(&issue)
+	loan, err := ApproveIssueCopy(db, issue.ReqId, admin.ID, "00000002")
+	assert.NoError(t, err)
+
+	var item models.BookCopy
+	config.DB.First(&item, loan.CopyID)
+	assert.Equal(t, "00000002", item.Barcode)
+	assert.Equal(t, CopyOnLoan, item.Status)
+
+	var inventory models.BookInventory
+	config.DB.First(&inventory, book.ID)
+	assert.Equal(t, uint(2), inventory.TotalCopies)
+	assert.Equal(t, uint(1), inventory.AvailableCopies)
+
+	ret := models.RequestEvent{BookId: book.ID, ReaderId: reader.ID, RequestDate: time.Now(), RequestType: "return", Status: "pending"}
+	db.Create(&ret)
+	_, err = ApproveReturn(db, ret.ReqId, admin.ID)
+	assert.NoError(t, err)
+
+	config.DB.First(&item, loan.CopyID)
+	assert.Equal(t, CopyAvailable, item.Status)
+}
+
+func TestCopyStatusDrivesTheCounters(t *testing.T) {
+	testutil.SetupDB(t)
+
+	library := testutil.CreateLibrary(t, "Library")
+	admin := testutil.CreateUser(t, library.ID, "admin", "admin@library.test")
+	reader := testutil.CreateUser(t, library.ID, "reader", "reader@library.test")
+	waiting := testutil.CreateUser(t, library.ID, "reader", "waiting@library.test")
+	book := testutil.CreateBook(t, library.ID, "Fragile", 2)
+	db := tenant.ForLibrary(library.ID)
+
+	_, err := UpdateCopy(db, "00000001", CopyDamaged, "torn cover")
+	assert.NoError(t, err)
+
+	_, err = UpdateCopy(db, "00000002", "on-loan", "")
+	assert.ErrorIs(t, err, ErrInvalidCopyStatus)
+
+	var inventory models.BookInventory
+	config.DB.First(&inventory, book.ID)
+	assert.Equal(t, uint(2), inventory.TotalCopies)
+	assert.Equal(t, uint(1), inventory.AvailableCopies)
+
+	// the only shelf copy goes out, the next reader queues
+	issue := models.RequestEvent{BookId: book.ID, ReaderId: reader.ID, RequestDate: time.Now(), RequestType: "issue", Status: "pending"}
+	db.Create(&issue)
+	loan, err := ApproveIssue(db, issue.ReqId, admin.ID)
+	assert.NoError(t, err)
+
+	hold, err := PlaceHold(db, book.ID, waiting.ID)
+	assert.NoError(t, err)
+
+	// the repaired copy is reserved for the waiting reader
+	item, err := UpdateCopy(db, "00000001", CopyAvailable, "good")
+	assert.NoError(t, err)
+	config.DB.First(item, item.ID)
+	assert.Equal(t, CopyOnHold, item.Status)
+	assert.Equal(t, hold.ID, *item.HoldID)
+
+	_, err = UpdateCopy(db, "00000001", CopyWithdrawn, "")
+	assert.ErrorIs(t, err, ErrCopyInUse)
+
+	// a copy out on loan can be reported lost, it leaves the collection and its loan is closed,
+	// charging the reader its price
+	config.DB.Model(&models.BookCopy{}).Where("id = ?", loan.CopyID).Update("price", 1500)
+	_, err = UpdateCopy(db, "00000002", CopyLost, "")
+	assert.NoError(t, err)
+
+	config.DB.First(&inventory, book.ID)
+	assert.Equal(t, uint(1), inventory.TotalCopies)
+	assert.Equal(t, uint(0), inventory.AvailableCopies)
+
+	config.DB.First(loan, loan.IssueID)
+	assert.Equal(t, "lost", loan.IssueStatus)
+	assert.Equal(t, int64(0), activeLoans(db, reader.ID, false))
+
+	balance, err := Balance(db, reader.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1500), balance)
+
+	ret := models.RequestEvent{BookId: book.ID, ReaderId: reader.ID, RequestDate: time.Now(), RequestType: "return", Status: "pending"}
+	db.Create(&ret)
+	_, err = ApproveReturn(db, ret.ReqId, admin.ID)
+	assert.ErrorIs(t, err, ErrRegistryNotFound)
+
+	// and is put back on the shelf when found
+	_, err = UpdateCopy(db, "00000002", CopyAvailable, "")
+	assert.NoError(t, err)
+
+	var returned models.BookCopy
+	config.DB.First(&returned, loan.CopyID)
+	assert.Equal(t, CopyAvailable, returned.Status)
+
+	config.DB.First(&inventory, book.ID)
+	assert.Equal(t, uint(2), inventory.TotalCopies)
+	assert.Equal(t, uint(1), inventory.AvailableCopies)
+}
+
+func TestAddCopiesNumbersThem(t *testing.T) {
+	testutil.SetupDB(t)
+
+	library := testutil.CreateLibrary(t, "Library")
+	book := testutil.CreateBook(t, library.ID, "Growing", 1)
+	db := tenant.ForLibrary(library.ID)
+
+	copies, err := AddCopies(db, book.ID, 2, CopyDetails{Price: 1250})
+	assert.NoError(t, err)
+	assert.Equal(t, uint(2), copies[0].AccessionNumber)
+	assert.Equal(t, "00000003", copies[1].Barcode)
+
+	_, err = AddCopies(db, book.ID, 1, CopyDetails{Barcode: "00000003"})
+	assert.ErrorIs(t, err, ErrCopyExists)
+
+	_, err = AddCopies(db, book.ID, 2, CopyDetails{Barcode: "LIB-1"})
+	assert.ErrorIs(t, err, ErrCopyCount)
+
+	var inventory models.BookInventory
+	config.DB.First(&inventory, book.ID)
+	assert.Equal(t, uint(3), inventory.TotalCopies)
+	assert.Equal(t, uint(3), inventory.AvailableCopies)
+}
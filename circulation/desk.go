@@ -0,0 +1,160 @@
+package circulation
+
+import (
+	"errors"
+	"project/libraryManagement/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrAlreadyBorrowed = errors.New("the reader has already borrowed this book")
+	ErrCopyNotOnLoan   = errors.New("copy is not on loan")
+	ErrNotReadersLoan  = errors.New("copy is on loan to another reader")
+)
+
+// find a copy by barcode without locking it, the book is locked before its copies
+func findCopy(tx *gorm.DB, barcode string) (*models.BookCopy, error) {
+	var item models.BookCopy
+
+	res := tx.Where("barcode = ?", barcode).First(&item)
+	if res.Error != nil {
+		if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+			return nil, ErrCopyNotFound
+		}
+		return nil, res.Error
+	}
+
+	return &item, nil
+}
+
+// pending request of the reader for the book, a new one when there is none
+func deskRequest(tx *gorm.DB, requestType string, bookID uint, readerID uint, libID uint, now time.Time) (*models.RequestEvent, error) {
+	var event models.RequestEvent
+
+	res := forUpdate(tx).Where("book_id = ? AND reader_id = ? AND request_type = ? AND status = ?", bookID, readerID, requestType, "pending").First(&event)
+	if res.Error == nil {
+		return &event, nil
+	}
+	if !errors.Is(res.Error, gorm.ErrRecordNotFound) {
+		return nil, res.Error
+	}
+
+	event = models.RequestEvent{BookId: bookID, ReaderId: readerID, RequestDate: now, RequestType: requestType, Status: "pending", LibID: libID}
+	if err := tx.Create(&event).Error; err != nil {
+		return nil, err
+	}
+
+	return &event, nil
+}
+
+// lend the scanned copy to the reader at the desk, recorded as an issue request approved by the staff member,
+// an issue request the reader already made for the book is approved instead
+func Checkout(db *gorm.DB, readerID uint, barcode string, staffID uint) (*models.IssueRegistery, error) {
+	return checkout(db, readerID, barcode, byStaff(staffID))
+}
+
+// lend the scanned copy to the reader at a self-service kiosk, approved by the kiosk within the loan policy
+func KioskCheckout(db *gorm.DB, kioskID uint, readerID uint, barcode string) (*models.IssueRegistery, error) {
+	return checkout(db, readerID, barcode, byKiosk(kioskID))
+}
+
+func checkout(db *gorm.DB, readerID uint, barcode string, by approver) (*models.IssueRegistery, error) {
+	var registry *models.IssueRegistery
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		found, err := findCopy(tx, barcode)
+		if err != nil {
+			return err
+		}
+
+		book, err := lockBook(tx, found.BookID)
+		if err != nil {
+			return err
+		}
+
+		var borrowed int64
+		tx.Model(&models.IssueRegistery{}).Where("book_id = ? AND reader_id = ? AND issue_status = ?", book.ID, readerID, "issued").Count(&borrowed)
+		if borrowed > 0 {
+			return ErrAlreadyBorrowed
+		}
+
+		policy, err := policyFor(tx, readerID, book)
+		if err != nil {
+			return err
+		}
+
+		if err := checkBalance(tx, policy, readerID); err != nil {
+			return err
+		}
+
+		now := time.Now()
+
+		event, err := deskRequest(tx, "issue", book.ID, readerID, book.LibID, now)
+		if err != nil {
+			return err
+		}
+
+		registry, err = lend(tx, event, by, found.Barcode, now)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return registry, nil
+}
+
+// take back the scanned copy at the desk, recorded as a return request approved by the staff member,
+// the returned loan carries the fine charged for a late return
+func Checkin(db *gorm.DB, barcode string, staffID uint) (*models.IssueRegistery, error) {
+	return checkin(db, barcode, 0, byStaff(staffID))
+}
+
+// take back the scanned copy at a self-service kiosk, only the reader who borrowed it can return it there
+func KioskCheckin(db *gorm.DB, kioskID uint, readerID uint, barcode string) (*models.IssueRegistery, error) {
+	return checkin(db, barcode, readerID, byKiosk(kioskID))
+}
+
+// readerID restricts the return to the loans of that reader, any loan when 0
+func checkin(db *gorm.DB, barcode string, readerID uint, by approver) (*models.IssueRegistery, error) {
+	var registry models.IssueRegistery
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		found, err := findCopy(tx, barcode)
+		if err != nil {
+			return err
+		}
+
+		if _, err := lockBook(tx, found.BookID); err != nil {
+			return err
+		}
+
+		res := forUpdate(tx).Where("copy_id = ? AND issue_status = ?", found.ID, "issued").First(&registry)
+		if res.Error != nil {
+			if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+				return ErrCopyNotOnLoan
+			}
+			return res.Error
+		}
+
+		if readerID != 0 && registry.ReaderID != readerID {
+			return ErrNotReadersLoan
+		}
+
+		now := time.Now()
+
+		event, err := deskRequest(tx, "return", registry.BookID, registry.ReaderID, registry.LibID, now)
+		if err != nil {
+			return err
+		}
+
+		return receive(tx, event, &registry, by, now)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &registry, nil
+}
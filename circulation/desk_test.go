@@ -0,0 +1,139 @@
+package circulation
+
+import (
+	"project/libraryManagement/config"
+	"project/libraryManagement/models"
+	"project/libraryManagement/tenant"
+	"project/libraryManagement/testutil"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeskCheckoutAndCheckin(t *testing.T) {
+	testutil.SetupDB(t)
+
+	library := testutil.CreateLibrary(t, "Library")
+	admin := testutil.CreateUser(t, library.ID, "admin", "admin@library.test")
+	reader := testutil.CreateUser(t, library.ID, "reader", "reader@library.test")
+	book := testutil.CreateBook(t, library.ID, "At The Desk", 2)
+	db := tenant.ForLibrary(library.ID)
+
+	rate := uint(25)
+	db.Create(&models.LoanPolicy{FinePerDay: &rate})
+
+	loan, err := Checkout(db, reader.ID, "00000002", admin.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "issued", loan.IssueStatus)
+	assert.Equal(t, admin.ID, loan.IssueApproverID)
+
+	// the same records as an approved request
+	var event models.RequestEvent
+	config.DB.Where("book_id = ? AND request_type = ?", book.ID, "issue").First(&event)
+	assert.Equal(t, "approved", event.Status)
+	assert.Equal(t, admin.ID, *event.ApproverID)
+
+	_, err = Checkout(db, reader.ID, "00000001", admin.ID)
+	assert.ErrorIs(t, err, ErrAlreadyBorrowed)
+
+	_, err = Checkout(db, reader.ID, "99999999", admin.ID)
+	assert.ErrorIs(t, err, ErrCopyNotFound)
+
+	_, err = Checkin(db, "00000001", admin.ID)
+	assert.ErrorIs(t, err, ErrCopyNotOnLoan)
+
+	config.DB.Model(loan).Update("expected_return_date", time.Now().Add(-2*24*time.Hour-time.Hour))
+
+	returned, err := Checkin(db, "00000002", admin.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "returned", returned.IssueStatus)
+	assert.Equal(t, uint(75), returned.Fine)
+
+	var ret models.RequestEvent
+	config.DB.Where("book_id = ? AND request_type = ?", book.ID, "return").First(&ret)
+	assert.Equal(t, "approved", ret.Status)
+
+	var inventory models.BookInventory
+	config.DB.First(&inventory, book.ID)
+	assert.Equal(t, uint(2), inventory.AvailableCopies)
+	assert.Equal(t, uint(1), inventory.TimesBorrowed)
+}
+
+func TestDeskCheckoutApprovesPendingRequestWithinPolicy(t *testing.T) {
+	testutil.SetupDB(t)
+
+	library := testutil.CreateLibrary(t, "Library")
+	admin := testutil.CreateUser(t, library.ID, "admin", "admin@library.test")
+	reader := testutil.CreateUser(t, library.ID, "reader", "reader@library.test")
+	waiting := testutil.CreateUser(t, library.ID, "reader", "waiting@library.test")
+	book := testutil.CreateBook(t, library.ID, "Requested", 1)
+	other := testutil.CreateBook(t, library.ID, "Over The Limit", 1)
+	db := tenant.ForLibrary(library.ID)
+
+	maxLoans := uint(1)
+	db.Create(&models.LoanPolicy{MaxLoans: &maxLoans})
+
+	issue := models.RequestEvent{BookId: book.ID, ReaderId: reader.ID, RequestDate: time.Now(), RequestType: "issue", Status: "pending"}
+	db.Create(&issue)
+
+	_, err := Checkout(db, reader.ID, "00000001", admin.ID)
+	assert.NoError(t, err)
+
+	config.DB.First(&issue, issue.ReqId)
+	assert.Equal(t, "approved", issue.Status)
+
+	var events int64
+	config.DB.Model(&models.RequestEvent{}).Where("reader_id = ?", reader.ID).Count(&events)
+	assert.Equal(t, int64(1), events)
+
+	_, err = Checkout(db, reader.ID, "00000002", admin.ID)
+	assert.ErrorIs(t, err, ErrLoanLimit)
+
+	_, err = Checkin(db, "00000001", admin.ID)
+	assert.NoError(t, err)
+	_, err = Checkout(db, waiting.ID, "00000002", admin.ID)
+	assert.NoError(t, err)
+
+	// a copy on the hold shelf only goes to the reader it is reserved for
+	_, err = PlaceHold(db, other.ID, reader.ID)
+	assert.NoError(t, err)
+	_, err = Checkin(db, "00000002", admin.ID)
+	assert.NoError(t, err)
+
+	third := testutil.CreateUser(t, library.ID, "reader", "third@library.test")
+	_, err = Checkout(db, third.ID, "00000002", admin.ID)
+	assert.ErrorIs(t, err, ErrCopyNotLendable)
+
+	_, err = Checkout(db, reader.ID, "00000002", admin.ID)
+	assert.NoError(t, err)
+}
+
+func TestKioskOnlyTakesBackTheReadersOwnLoans(t *testing.T) {
+	testutil.SetupDB(t)
+
+	library := testutil.CreateLibrary(t, "Library")
+	reader := testutil.CreateUser(t, library.ID, "reader", "reader@library.test")
+	other := testutil.CreateUser(t, library.ID, "reader", "other@library.test")
+	testutil.CreateBook(t, library.ID, "Self Service", 1)
+	db := tenant.ForLibrary(library.ID)
+
+	kiosk := models.Kiosk{Name: "Entrance", CredentialHash: "hash"}
+	db.Create(&kiosk)
+
+	loan, err := KioskCheckout(db, kiosk.ID, reader.ID, "00000001")
+	assert.NoError(t, err)
+	assert.Equal(t, kiosk.ID, *loan.IssueKioskID)
+
+	var event models.RequestEvent
+	config.DB.Where("reader_id = ? AND request_type = ?", reader.ID, "issue").First(&event)
+	assert.Equal(t, kiosk.ID, *event.KioskID)
+	assert.Nil(t, event.ApproverID)
+
+	_, err = KioskCheckin(db, kiosk.ID, other.ID, "00000001")
+	assert.ErrorIs(t, err, ErrNotReadersLoan)
+
+	returned, err := KioskCheckin(db, kiosk.ID, reader.ID, "00000001")
+	assert.NoError(t, err)
+	assert.Equal(t, "returned", returned.IssueStatus)
+}
@@ -0,0 +1,112 @@
+package circulation
+
+import (
+	"errors"
+	"fmt"
+	"project/libraryManagement/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ledger entry types
+const (
+	EntryCharge     = "charge"
+	EntryPayment    = "payment"
+	EntryWaiver     = "waiver"
+	EntryAdjustment = "adjustment"
+)
+
+var (
+	ErrBalanceTooHigh   = errors.New("outstanding fines too high")
+	ErrInvalidEntryType = errors.New("entry type must be payment, waiver or adjustment")
+	ErrInvalidAmount    = errors.New("amount must be greater than zero")
+	ErrZeroAdjustment   = errors.New("amount of an adjustment cannot be zero")
+)
+
+// fine of a loan returned at the given time, charged per day late once the grace period is over
+func computeFine(policy Policy, registry *models.IssueRegistery, returnedAt time.Time) uint {
+	late := returnedAt.Sub(registry.ExpectedReturnDate)
+	if late <= policy.GracePeriod() || policy.FinePerDay == 0 {
+		return 0
+	}
+
+	// a started day counts as a whole day
+	days := uint((late + 24*time.Hour - 1) / (24 * time.Hour))
+
+	return days * policy.FinePerDay
+}
+
+// charge the reader the fine of a returned loan
+func chargeFine(tx *gorm.DB, policy Policy, registry *models.IssueRegistery, now time.Time) error {
+	registry.Fine = computeFine(policy, registry, now)
+	if registry.Fine == 0 {
+		return nil
+	}
+
+	entry := models.LedgerEntry{
+		ReaderID: registry.ReaderID,
+		Type:     EntryCharge,
+		Amount:   int64(registry.Fine),
+		Note:     fmt.Sprintf("overdue fine, returned %s after the due date %s", now.Format("02 Jan 2006"), registry.ExpectedReturnDate.Format("02 Jan 2006")),
+		IssueID:  &registry.IssueID,
+		LibID:    registry.LibID,
+	}
+
+	return tx.Create(&entry).Error
+}
+
+// outstanding balance of a reader, positive when they owe the library
+func Balance(db *gorm.DB, readerID uint) (int64, error) {
+	var balance int64
+
+	res := db.Model(&models.LedgerEntry{}).Where("reader_id = ?", readerID).Select("COALESCE(SUM(amount), 0)").Scan(&balance)
+	if res.Error != nil {
+		return 0, res.Error
+	}
+
+	return balance, nil
+}
+
+// check the reader's balance allows new loans, a zero threshold never blocks
+func checkBalance(db *gorm.DB, policy Policy, readerID uint) error {
+	if policy.MaxBalance == 0 {
+		return nil
+	}
+
+	balance, err := Balance(db, readerID)
+	if err != nil {
+		return err
+	}
+
+	if balance > int64(policy.MaxBalance) {
+		return fmt.Errorf("%w: your balance is %d, pay it below %d to borrow books", ErrBalanceTooHigh, balance, policy.MaxBalance)
+	}
+
+	return nil
+}
+
+// record a payment, waiver or adjustment made by staff,
+// payments and waivers reduce the balance, an adjustment adds the signed amount
+func RecordEntry(db *gorm.DB, reader *models.Users, entryType string, amount int64, note string, recordedByID uint) (*models.LedgerEntry, error) {
+	switch entryType {
+	case EntryPayment, EntryWaiver:
+		if amount <= 0 {
+			return nil, ErrInvalidAmount
+		}
+		amount = -amount
+	case EntryAdjustment:
+		if amount == 0 {
+			return nil, ErrZeroAdjustment
+		}
+	default:
+		return nil, ErrInvalidEntryType
+	}
+
+	entry := models.LedgerEntry{ReaderID: reader.ID, Type: entryType, Amount: amount, Note: note, RecordedByID: &recordedByID, LibID: reader.LibID}
+	if err := db.Create(&entry).Error; err != nil {
+		return nil, err
+	}
+
+	return &entry, nil
+}
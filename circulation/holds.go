@@ -0,0 +1,251 @@
+package circulation
+
+import (
+	"errors"
+	"project/libraryManagement/config"
+	"project/libraryManagement/models"
+	"project/libraryManagement/outbox"
+	"project/libraryManagement/templates"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// hold statuses
+const (
+	HoldWaiting   = "waiting"
+	HoldReady     = "ready"
+	HoldFulfilled = "fulfilled"
+	HoldExpired   = "expired"
+	HoldCancelled = "cancelled"
+)
+
+var (
+	ErrBookAvailable = errors.New("book is available, request it instead of placing a hold")
+	ErrHoldExists    = errors.New("you already have a hold on this book")
+	ErrHoldNotFound  = errors.New("hold does not exists")
+	ErrHoldClosed    = errors.New("hold is no longer active")
+)
+
+// how long a reader has to collect a book once their hold is ready
+func PickupWindow() time.Duration {
+	return config.GetEnvDuration("HOLD_PICKUP_WINDOW", 72*time.Hour)
+}
+
+// place a hold on an unavailable book, joining the end of its queue
+func PlaceHold(db *gorm.DB, bookID uint, readerID uint) (*models.Hold, error) {
+	var hold models.Hold
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		book, err := lockBook(tx, bookID)
+		if err != nil {
+			return err
+		}
+
+		if book.AvailableCopies > 0 {
+			return ErrBookAvailable
+		}
+
+		var existing int64
+		tx.Model(&models.Hold{}).Where("book_id = ? AND reader_id = ? AND status IN ?", bookID, readerID, []string{HoldWaiting, HoldReady}).Count(&existing)
+		if existing > 0 {
+			return ErrHoldExists
+		}
+
+		hold = models.Hold{BookId: bookID, ReaderId: readerID, Status: HoldWaiting, QueuedAt: time.Now(), LibID: book.LibID}
+		return tx.Create(&hold).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &hold, nil
+}
+
+// position of a waiting hold in its queue, starting at 1
+func QueuePosition(db *gorm.DB, hold *models.Hold) int64 {
+	if hold.Status != HoldWaiting {
+		return 0
+	}
+
+	var ahead int64
+	db.Model(&models.Hold{}).Where("book_id = ? AND status = ? AND id < ?", hold.BookId, HoldWaiting, hold.ID).Count(&ahead)
+
+	return ahead + 1
+}
+
+// cancel a reader's hold, a reserved copy goes to the next reader in line
+func CancelHold(db *gorm.DB, holdID uint, readerID uint) (*models.Hold, error) {
+	var hold models.Hold
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Where("id = ? AND reader_id = ?", holdID, readerID).First(&hold)
+		if res.Error != nil {
+			if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+				return ErrHoldNotFound
+			}
+			return res.Error
+		}
+
+		book, err := lockHold(tx, &hold)
+		if err != nil {
+			return err
+		}
+
+		if hold.Status != HoldWaiting && hold.Status != HoldReady {
+			return ErrHoldClosed
+		}
+
+		return closeHold(tx, book, &hold, HoldCancelled, time.Now())
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &hold, nil
+}
+
+// lock the book of a hold and then the hold, the order lending and returning lock them in,
+// the hold is reloaded as it may have changed before it was locked
+func lockHold(tx *gorm.DB, hold *models.Hold) (*models.BookInventory, error) {
+	book, err := lockBook(tx, hold.BookId)
+	if err != nil {
+		return nil, err
+	}
+
+	res := forUpdate(tx).Where("id = ?", hold.ID).First(hold)
+	if res.Error != nil {
+		if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+			return nil, ErrHoldNotFound
+		}
+		return nil, res.Error
+	}
+
+	return book, nil
+}
+
+// close a hold of a locked book, releasing its reserved copy if it had one
+func closeHold(tx *gorm.DB, book *models.BookInventory, hold *models.Hold, status string, now time.Time) error {
+	wasReady := hold.Status == HoldReady
+
+	hold.Status = status
+	hold.ClosedAt = &now
+	if err := tx.Model(hold).Select("status", "closed_at").Updates(hold).Error; err != nil {
+		return err
+	}
+
+	if !wasReady {
+		return nil
+	}
+
+	item, err := lockCopy(tx, "hold_id = ? AND status = ?", hold.ID, CopyOnHold)
+	if err != nil && !errors.Is(err, ErrCopyNotFound) {
+		return err
+	}
+	if item != nil {
+		if err := setCopyStatus(tx, item, CopyAvailable); err != nil {
+			return err
+		}
+	}
+
+	return serveHolds(tx, book, now)
+}
+
+// hand available copies of a locked book to the waiting holds, oldest first, and
+// recount its copies, the readers are notified through the outbox once the transaction commits
+func serveHolds(tx *gorm.DB, book *models.BookInventory, now time.Time) error {
+	for {
+		var hold models.Hold
+
+		res := forUpdate(tx).Where("book_id = ? AND status = ?", book.ID, HoldWaiting).Order("id").First(&hold)
+		if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+			break
+		}
+		if res.Error != nil {
+			return res.Error
+		}
+
+		item, err := lockCopy(tx, "book_id = ? AND status = ?", book.ID, CopyAvailable)
+		if errors.Is(err, ErrCopyNotFound) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		deadline := now.Add(PickupWindow())
+		hold.Status = HoldReady
+		hold.ReadyAt = &now
+		hold.PickupDeadline = &deadline
+		if err := tx.Model(&hold).Select("status", "ready_at", "pickup_deadline").Updates(&hold).Error; err != nil {
+			return err
+		}
+
+		// the copy is reserved for the reader
+		item.HoldID = &hold.ID
+		if err := setCopyStatus(tx, item, CopyOnHold); err != nil {
+			return err
+		}
+
+		if err := notifyHoldReady(tx, &hold, book); err != nil {
+			return err
+		}
+	}
+
+	return syncCounters(tx, book)
+}
+
+// expire ready holds that were not collected in time, rolling the copy to the next reader
+func ExpireHolds(db *gorm.DB, now time.Time) (int, error) {
+	var overdue []models.Hold
+
+	res := db.Where("status = ? AND pickup_deadline < ?", HoldReady, now).Find(&overdue)
+	if res.Error != nil {
+		return 0, res.Error
+	}
+
+	expired := 0
+	for _, candidate := range overdue {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			hold := candidate
+
+			// the hold may have been collected or removed in the meantime
+			book, err := lockHold(tx, &hold)
+			if errors.Is(err, ErrHoldNotFound) || errors.Is(err, ErrBookNotFound) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if hold.Status != HoldReady {
+				return nil
+			}
+
+			err = closeHold(tx, book, &hold, HoldExpired, now)
+			if err == nil {
+				expired++
+			}
+			return err
+		})
+		if err != nil {
+			return expired, err
+		}
+	}
+
+	return expired, nil
+}
+
+// queue the email telling a reader their hold is ready for pickup
+func notifyHoldReady(tx *gorm.DB, hold *models.Hold, book *models.BookInventory) error {
+	var reader models.Users
+
+	if err := tx.First(&reader, hold.ReaderId).Error; err != nil {
+		return err
+	}
+
+	_, err := outbox.EnqueueTemplate(tx, hold.LibID, reader.Email, templates.HoldReady, templates.Data{
+		"Title":          book.Title,
+		"PickupDeadline": hold.PickupDeadline.Format("02 Jan 2006 15:04"),
+	})
+	return err
+}
@@ -0,0 +1,117 @@
+package circulation
+
+import (
+	"fmt"
+	"project/libraryManagement/config"
+	"project/libraryManagement/models"
+	"project/libraryManagement/tenant"
+	"project/libraryManagement/testutil"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+// approve a request of the reader for the book
+func request(t *testing.T, db *gorm.DB, kind string, bookID uint, readerID uint, adminID uint) error {
+	t.Helper()
+
+	event := models.RequestEvent{BookId: bookID, ReaderId: readerID, RequestDate: time.Now(), RequestType: kind, Status: "pending"}
+	db.Create(&event)
+
+	var err error
+	if kind == "issue" {
+		_, err = ApproveIssue(db, event.ReqId, adminID)
+	} else {
+		_, err = ApproveReturn(db, event.ReqId, adminID)
+	}
+	return err
+}
+
+func holdOf(t *testing.T, id uint) models.Hold {
+	t.Helper()
+
+	var hold models.Hold
+	assert.NoError(t, config.DB.First(&hold, id).Error)
+	return hold
+}
+
+func TestHoldsAreServedInOrder(t *testing.T) {
+	testutil.SetupDB(t)
+
+	library := testutil.CreateLibrary(t, "Library")
+	admin := testutil.CreateUser(t, library.ID, "admin", "admin@library.test")
+	borrower := testutil.CreateUser(t, library.ID, "reader", "borrower@library.test")
+	book := testutil.CreateBook(t, library.ID, "Popular", 1)
+	db := tenant.ForLibrary(library.ID)
+
+	_, err := PlaceHold(db, book.ID, borrower.ID)
+	assert.ErrorIs(t, err, ErrBookAvailable)
+	assert.NoError(t, request(t, db, "issue", book.ID, borrower.ID, admin.ID))
+
+	// three readers queue for the only copy
+	var readers []*models.Users
+	var holds []*models.Hold
+	for i := 0; i < 3; i++ {
+		reader := testutil.CreateUser(t, library.ID, "reader", fmt.Sprintf("reader%d@library.test", i))
+		hold, err := PlaceHold(db, book.ID, reader.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(i+1), QueuePosition(db, hold))
+
+		readers, holds = append(readers, reader), append(holds, hold)
+	}
+	_, err = PlaceHold(db, book.ID, readers[0].ID)
+	assert.ErrorIs(t, err, ErrHoldExists)
+
+	// the returned copy is reserved for the first reader in line and they are told to collect it
+	assert.NoError(t, request(t, db, "return", book.ID, borrower.ID, admin.ID))
+
+	first := holdOf(t, holds[0].ID)
+	assert.Equal(t, HoldReady, first.Status)
+	assert.WithinDuration(t, time.Now().Add(PickupWindow()), *first.PickupDeadline, time.Minute)
+	assert.Equal(t, int64(1), QueuePosition(db, holds[1]))
+
+	var item models.BookCopy
+	config.DB.Where("book_id = ?", book.ID).First(&item)
+	assert.Equal(t, CopyOnHold, item.Status)
+	assert.Equal(t, first.ID, *item.HoldID)
+
+	var inventory models.BookInventory
+	config.DB.First(&inventory, book.ID)
+	assert.Equal(t, uint(0), inventory.AvailableCopies)
+
+	var notices int64
+	config.DB.Model(&models.OutboxMessage{}).Where("\"to\" = ?", readers[0].Email).Count(&notices)
+	assert.Equal(t, int64(1), notices)
+
+	// the copy is kept for them, not for the readers behind
+	assert.ErrorIs(t, request(t, db, "issue", book.ID, readers[1].ID, admin.ID), ErrNotAvailable)
+
+	// uncollected, it rolls over to the next reader once the pickup deadline passed
+	expired, err := ExpireHolds(db, time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, 0, expired)
+
+	expired, err = ExpireHolds(db, first.PickupDeadline.Add(time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, expired)
+	assert.Equal(t, HoldExpired, holdOf(t, holds[0].ID).Status)
+	assert.Equal(t, HoldReady, holdOf(t, holds[1].ID).Status)
+	assert.Equal(t, HoldWaiting, holdOf(t, holds[2].ID).Status)
+
+	// a cancelled ready hold hands the copy on as well
+	_, err = CancelHold(db, holds[1].ID, readers[1].ID)
+	assert.NoError(t, err)
+	assert.Equal(t, HoldReady, holdOf(t, holds[2].ID).Status)
+
+	_, err = CancelHold(db, holds[1].ID, readers[1].ID)
+	assert.ErrorIs(t, err, ErrHoldClosed)
+
+	// collecting the book fulfills the hold
+	assert.NoError(t, request(t, db, "issue", book.ID, readers[2].ID, admin.ID))
+	assert.Equal(t, HoldFulfilled, holdOf(t, holds[2].ID).Status)
+
+	config.DB.First(&item, item.ID)
+	assert.Equal(t, CopyOnLoan, item.Status)
+}
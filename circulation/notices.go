@@ -0,0 +1,126 @@
+package circulation
+
+import (
+	"fmt"
+	"project/libraryManagement/config"
+	"project/libraryManagement/models"
+	"project/libraryManagement/outbox"
+	"project/libraryManagement/templates"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// notice kinds
+const (
+	NoticeDueReminder = "due_reminder"
+	NoticeOverdue1    = "overdue_1"
+	NoticeOverdue7    = "overdue_7"
+	NoticeOverdue14   = "overdue_14"
+)
+
+// overdue notices escalate with the number of days a loan is late, latest stage first
+var overdueStages = []struct {
+	Days int
+	Kind string
+}{
+	{14, NoticeOverdue14},
+	{7, NoticeOverdue7},
+	{1, NoticeOverdue1},
+}
+
+// how many days before the due date readers get a reminder
+func ReminderDays() int {
+	return config.GetEnvInt("NOTICE_REMINDER_DAYS", 2)
+}
+
+// notice due for a loan at the given time, empty when none is due
+func noticeKind(registry *models.IssueRegistery, now time.Time, reminderDays int) string {
+	if registry.ExpectedReturnDate.After(now) {
+		if registry.ExpectedReturnDate.Sub(now) <= time.Duration(reminderDays)*24*time.Hour {
+			return NoticeDueReminder
+		}
+		return ""
+	}
+
+	daysLate := int(now.Sub(registry.ExpectedReturnDate) / (24 * time.Hour))
+	for _, stage := range overdueStages {
+		if daysLate >= stage.Days {
+			return stage.Kind
+		}
+	}
+
+	return ""
+}
+
+// queue the reminders and overdue notices due at the given time across every library,
+// returns the number of notices queued
+func SendDueNotices(db *gorm.DB, now time.Time) (int, error) {
+	var loans []models.IssueRegistery
+
+	reminderDays := ReminderDays()
+	horizon := now.Add(time.Duration(reminderDays) * 24 * time.Hour)
+
+	res := db.Preload("BookInventory").Where("issue_status = ? AND expected_return_date <= ?", "issued", horizon).Find(&loans)
+	if res.Error != nil {
+		return 0, res.Error
+	}
+
+	sent := 0
+	for i := range loans {
+		kind := noticeKind(&loans[i], now, reminderDays)
+		if kind == "" {
+			continue
+		}
+
+		ok, err := sendNotice(db, &loans[i], kind, now)
+		if err != nil {
+			fmt.Println("error sending notice for loan", loans[i].IssueID, err)
+			continue
+		}
+		if ok {
+			sent++
+		}
+	}
+
+	return sent, nil
+}
+
+// queue a notice unless it was already sent for the loan's current due date
+func sendNotice(db *gorm.DB, registry *models.IssueRegistery, kind string, now time.Time) (bool, error) {
+	var reader models.Users
+
+	if err := db.First(&reader, registry.ReaderID).Error; err != nil {
+		return false, err
+	}
+
+	template := templates.DueReminder
+	if kind != NoticeDueReminder {
+		template = templates.OverdueNotice
+	}
+
+	sent := false
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// the log entry makes restarts and parallel runs never send a notice twice
+		notice := models.NoticeLog{IssueID: registry.IssueID, Kind: kind, DueDate: registry.ExpectedReturnDate, Email: reader.Email, SentAt: now, LibID: registry.LibID}
+		res := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&notice)
+		if res.Error != nil || res.RowsAffected == 0 {
+			return res.Error
+		}
+
+		_, err := outbox.EnqueueTemplate(tx, registry.LibID, reader.Email, template, templates.Data{
+			"Title":    registry.BookInventory.Title,
+			"DueDate":  registry.ExpectedReturnDate.Format("02 Jan 2006"),
+			"DaysLate": int(now.Sub(registry.ExpectedReturnDate) / (24 * time.Hour)),
+		})
+		if err != nil {
+			return err
+		}
+
+		sent = true
+		return nil
+	})
+
+	return sent, err
+}
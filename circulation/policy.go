@@ -0,0 +1,157 @@
+package circulation
+
+import (
+	"errors"
+	"fmt"
+	"project/libraryManagement/models"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var ErrLoanLimit = errors.New("loan limit reached")
+
+// effective loan rules for a reader and a book
+type Policy struct {
+	LoanPeriodDays  uint `json:"loanPeriodDays"`
+	MaxLoans        uint `json:"maxLoans"`
+	MaxRenewals     uint `json:"maxRenewals"`
+	RenewalApproval bool `json:"renewalApproval"`
+	GracePeriodDays uint `json:"gracePeriodDays"`
+	FinePerDay      uint `json:"finePerDay"`
+	MaxBalance      uint `json:"maxBalance"`
+}
+
+// rules used when a library has not configured a policy
+var DefaultPolicy = Policy{
+	LoanPeriodDays:  7,
+	MaxLoans:        5,
+	MaxRenewals:     2,
+	RenewalApproval: false,
+	GracePeriodDays: 0,
+	FinePerDay:      0,
+	MaxBalance:      0,
+}
+
+func (p Policy) LoanPeriod() time.Duration {
+	return time.Duration(p.LoanPeriodDays) * 24 * time.Hour
+}
+
+func (p Policy) GracePeriod() time.Duration {
+	return time.Duration(p.GracePeriodDays) * 24 * time.Hour
+}
+
+// categories are compared case insensitively
+func NormalizeCategory(category string) string {
+	return strings.ToLower(strings.TrimSpace(category))
+}
+
+// apply the fields set on a stored policy
+func (p Policy) merge(override models.LoanPolicy) Policy {
+	if override.LoanPeriodDays != nil {
+		p.LoanPeriodDays = *override.LoanPeriodDays
+	}
+	if override.MaxLoans != nil {
+		p.MaxLoans = *override.MaxLoans
+	}
+	if override.MaxRenewals != nil {
+		p.MaxRenewals = *override.MaxRenewals
+	}
+	if override.RenewalApproval != nil {
+		p.RenewalApproval = *override.RenewalApproval
+	}
+	if override.GracePeriodDays != nil {
+		p.GracePeriodDays = *override.GracePeriodDays
+	}
+	if override.FinePerDay != nil {
+		p.FinePerDay = *override.FinePerDay
+	}
+	if override.MaxBalance != nil {
+		p.MaxBalance = *override.MaxBalance
+	}
+
+	return p
+}
+
+// resolve the policy of a library for a patron and book category,
+// from least to most specific: library default, book category, patron category, both
+func ResolvePolicy(db *gorm.DB, libID uint, patronCategory string, bookCategory string) (Policy, error) {
+	var stored []models.LoanPolicy
+
+	patronCategory = NormalizeCategory(patronCategory)
+	bookCategory = NormalizeCategory(bookCategory)
+
+	res := db.Where("lib_id = ? AND patron_category IN ? AND book_category IN ?", libID, []string{"", patronCategory}, []string{"", bookCategory}).Find(&stored)
+	if res.Error != nil {
+		return DefaultPolicy, res.Error
+	}
+
+	scopes := [][2]string{{"", ""}, {"", bookCategory}, {patronCategory, ""}, {patronCategory, bookCategory}}
+
+	policy := DefaultPolicy
+	applied := map[[2]string]bool{}
+	for _, scope := range scopes {
+		// a blank category is the same scope as the default, don't apply it twice
+		if applied[scope] {
+			continue
+		}
+		applied[scope] = true
+
+		for _, candidate := range stored {
+			if candidate.PatronCategory == scope[0] && candidate.BookCategory == scope[1] {
+				policy = policy.merge(candidate)
+			}
+		}
+	}
+
+	return policy, nil
+}
+
+// resolve the policy for a reader borrowing a book
+func policyFor(tx *gorm.DB, readerID uint, book *models.BookInventory) (Policy, error) {
+	var reader models.Users
+
+	if err := tx.First(&reader, readerID).Error; err != nil {
+		return DefaultPolicy, err
+	}
+
+	return ResolvePolicy(tx, book.LibID, reader.PatronCategory, book.Category)
+}
+
+// number of books the reader has on loan, optionally counting pending issue requests
+func activeLoans(tx *gorm.DB, readerID uint, includePending bool) int64 {
+	var loans int64
+	tx.Model(&models.IssueRegistery{}).Where("reader_id = ? AND issue_status = ?", readerID, "issued").Count(&loans)
+
+	if includePending {
+		var pending int64
+		tx.Model(&models.RequestEvent{}).Where("reader_id = ? AND request_type = ? AND status = ?", readerID, "issue", "pending").Count(&pending)
+		loans += pending
+	}
+
+	return loans
+}
+
+// check the reader can borrow one more book
+func checkLoanLimit(tx *gorm.DB, policy Policy, readerID uint, includePending bool) error {
+	if uint(activeLoans(tx, readerID, includePending)) >= policy.MaxLoans {
+		return fmt.Errorf("%w: you can have at most %d books on loan at a time", ErrLoanLimit, policy.MaxLoans)
+	}
+
+	return nil
+}
+
+// check whether a reader may request a book, used before creating an issue request
+func CheckIssueRequest(db *gorm.DB, readerID uint, book *models.BookInventory) error {
+	policy, err := policyFor(db, readerID, book)
+	if err != nil {
+		return err
+	}
+
+	if err := checkBalance(db, policy, readerID); err != nil {
+		return err
+	}
+
+	return checkLoanLimit(db, policy, readerID, true)
+}
@@ -0,0 +1,172 @@
+package circulation
+
+import (
+	"errors"
+	"fmt"
+	"project/libraryManagement/models"
+	"project/libraryManagement/templates"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrNotBorrowed    = errors.New("you cannot renew a book that has not been issued")
+	ErrRenewalLimit   = errors.New("renewal limit reached for this loan")
+	ErrHoldsWaiting   = errors.New("other readers are waiting for this book, it cannot be renewed")
+	ErrRenewalPending = errors.New("you have already requested to renew this book")
+	ErrLoanOverdue    = errors.New("an overdue loan cannot be renewed, please return the book")
+)
+
+// lock the open loan of a reader
+func lockLoan(tx *gorm.DB, bookID uint, readerID uint) (*models.IssueRegistery, error) {
+	var registry models.IssueRegistery
+
+	res := forUpdate(tx).Where("book_id = ? AND reader_id = ? AND issue_status = ?", bookID, readerID, "issued").Order("issue_date").First(&registry)
+	if res.Error != nil {
+		if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+			return nil, ErrNotBorrowed
+		}
+		return nil, res.Error
+	}
+
+	return &registry, nil
+}
+
+// resolve the policy of an open loan
+func loanPolicy(tx *gorm.DB, registry *models.IssueRegistery) (Policy, error) {
+	book, err := lockBook(tx, registry.BookID)
+	if err != nil {
+		return DefaultPolicy, err
+	}
+
+	return policyFor(tx, registry.ReaderID, book)
+}
+
+// check the loan can be renewed under the library's rules, a late loan has to be returned
+// so its fine is charged instead of being wiped out by the new due date
+func checkRenewable(tx *gorm.DB, policy Policy, registry *models.IssueRegistery, now time.Time) error {
+	if now.After(registry.ExpectedReturnDate) {
+		return ErrLoanOverdue
+	}
+
+	if registry.RenewalCount >= policy.MaxRenewals {
+		return fmt.Errorf("%w: a loan can be renewed at most %d times", ErrRenewalLimit, policy.MaxRenewals)
+	}
+
+	var holds int64
+	tx.Model(&models.Hold{}).Where("book_id = ? AND status IN ?", registry.BookID, []string{HoldWaiting, HoldReady}).Count(&holds)
+	if holds > 0 {
+		return ErrHoldsWaiting
+	}
+
+	return nil
+}
+
+// extend the due date of the loan and mark the renewal as approved
+func renew(tx *gorm.DB, policy Policy, registry *models.IssueRegistery, event *models.RequestEvent, approverID *uint, now time.Time) error {
+	registry.ExpectedReturnDate = registry.ExpectedReturnDate.Add(policy.LoanPeriod())
+	registry.RenewalCount += 1
+	if err := tx.Model(registry).Select("expected_return_date", "renewal_count").Updates(registry).Error; err != nil {
+		return err
+	}
+
+	event.ApproverID = approverID
+	event.ApprovalDate = &now
+	event.Status = "approved"
+
+	return tx.Model(event).Select("approver_id", "approval_date", "status").Updates(event).Error
+}
+
+// request a renewal of a loan, approved straight away unless the library wants to approve renewals
+func RequestRenewal(db *gorm.DB, bookID uint, readerID uint) (*models.RequestEvent, *models.IssueRegistery, error) {
+	var event models.RequestEvent
+	var registry *models.IssueRegistery
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+
+		registry, err = lockLoan(tx, bookID, readerID)
+		if err != nil {
+			return err
+		}
+
+		policy, err := loanPolicy(tx, registry)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+
+		if err := checkRenewable(tx, policy, registry, now); err != nil {
+			return err
+		}
+
+		var pending int64
+		tx.Model(&models.RequestEvent{}).Where("book_id = ? AND reader_id = ? AND request_type = ? AND status = ?", bookID, readerID, "renew", "pending").Count(&pending)
+		if pending > 0 {
+			return ErrRenewalPending
+		}
+
+		event = models.RequestEvent{BookId: bookID, ReaderId: readerID, RequestDate: now, RequestType: "renew", Status: "pending", LibID: registry.LibID}
+		if err := tx.Create(&event).Error; err != nil {
+			return err
+		}
+
+		if policy.RenewalApproval {
+			return nil
+		}
+
+		return renew(tx, policy, registry, &event, nil, now)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &event, registry, nil
+}
+
+// approve a pending renewal request
+func ApproveRenewal(db *gorm.DB, reqID uint, approverID uint) (*models.IssueRegistery, error) {
+	var registry *models.IssueRegistery
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		event, err := lockPendingRequest(tx, reqID, "renew")
+		if err != nil {
+			return err
+		}
+
+		registry, err = lockLoan(tx, event.BookId, event.ReaderId)
+		if err != nil {
+			return err
+		}
+
+		policy, err := loanPolicy(tx, registry)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+
+		// holds may have been placed and the loan may have become overdue since the request
+		if err := checkRenewable(tx, policy, registry, now); err != nil {
+			return err
+		}
+
+		if err := renew(tx, policy, registry, event, &approverID, now); err != nil {
+			return err
+		}
+
+		book, err := lockBook(tx, registry.BookID)
+		if err != nil {
+			return err
+		}
+
+		return notifyRequest(tx, event, templates.RequestApproved, book, &registry.ExpectedReturnDate)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return registry, nil
+}
@@ -3,7 +3,9 @@ package config
 import (
 	"fmt"
 	"os"
+	"project/libraryManagement/cards"
 	"project/libraryManagement/models"
+	"project/libraryManagement/search"
 
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
@@ -23,12 +25,141 @@ func ConnectToDB() {
 		panic("failed to connect database")
 	}
 
-	DB.AutoMigrate(&models.Library{})
-	DB.AutoMigrate(&models.Users{})
-	DB.AutoMigrate(&models.BookInventory{})
-	DB.AutoMigrate(&models.RequestEvent{})
-	DB.AutoMigrate(&models.IssueRegistery{})
+	if err := Migrate(DB); err != nil {
+		panic(err)
+	}
 
 	fmt.Println("Connected To Database")
 }
 
+// create and update the tables, the first step that fails stops the migration and is returned
+func Migrate(db *gorm.DB) error {
+	// books used to be keyed by a numeric "isbn" row id, it becomes the surrogate id
+	// and isbn holds the real, validated isbn-13
+	if db.Migrator().HasColumn(&models.BookInventory{}, "isbn") && !db.Migrator().HasColumn(&models.BookInventory{}, "id") {
+		if err := db.Migrator().RenameColumn(&models.BookInventory{}, "isbn", "id"); err != nil {
+			return fmt.Errorf("error renaming book_inventories.isbn to id: %w", err)
+		}
+	}
+	if db.Migrator().HasColumn(&models.IssueRegistery{}, "isbn") && !db.Migrator().HasColumn(&models.IssueRegistery{}, "book_id") {
+		if err := db.Migrator().RenameColumn(&models.IssueRegistery{}, "isbn", "book_id"); err != nil {
+			return fmt.Errorf("error renaming issue_registeries.isbn to book_id: %w", err)
+		}
+	}
+
+	// the loans of a book are counted once, lending a copy keeps the count up to date
+	countLoans := !db.Migrator().HasColumn(&models.BookInventory{}, "times_borrowed")
+
+	tables := []interface{}{
+		&models.Library{},
+		&models.Users{},
+		&models.BookInventory{},
+		&models.BookCopy{},
+		&models.RequestEvent{},
+		&models.IssueRegistery{},
+		&models.OTPChallenge{},
+		&models.Session{},
+		&models.Kiosk{},
+		&models.ReplacedCard{},
+		&models.Hold{},
+		&models.LoanPolicy{},
+		&models.LedgerEntry{},
+		&models.NoticeLog{},
+		&models.OutboxMessage{},
+		&models.EmailTemplate{},
+		&models.ImportJob{},
+		&models.ImportRow{},
+	}
+	for _, table := range tables {
+		if err := db.AutoMigrate(table); err != nil {
+			return fmt.Errorf("error migrating %T: %w", table, err)
+		}
+	}
+
+	// rows created before tenant scoping don't have a library yet
+	db.Exec("UPDATE request_events SET lib_id = (SELECT lib_id FROM book_inventories WHERE book_inventories.id = request_events.book_id) WHERE lib_id IS NULL OR lib_id = 0")
+	db.Exec("UPDATE issue_registeries SET lib_id = (SELECT lib_id FROM book_inventories WHERE book_inventories.id = issue_registeries.book_id) WHERE lib_id IS NULL OR lib_id = 0")
+
+	backfillCopies(db)
+
+	if countLoans {
+		db.Exec("UPDATE book_inventories SET times_borrowed = (SELECT COUNT(*) FROM issue_registeries WHERE issue_registeries.book_id = book_inventories.id)")
+	}
+
+	// full text search column, trigger and indexes
+	if err := search.Migrate(db); err != nil {
+		return fmt.Errorf("error setting up the catalog search: %w", err)
+	}
+
+	// readers onboarded before library cards get one
+	var readers []models.Users
+	if err := db.Where("role = ? AND (card_number IS NULL OR card_number = '')", "reader").Find(&readers).Error; err != nil {
+		return fmt.Errorf("error finding readers without a library card: %w", err)
+	}
+	for i := range readers {
+		if err := cards.Assign(db, &readers[i]); err != nil {
+			return fmt.Errorf("error assigning a library card to reader %d: %w", readers[i].ID, err)
+		}
+	}
+
+	// qr codes are rendered per copy on request instead of stored on the book
+	if db.Migrator().HasColumn(&models.BookInventory{}, "qr_code") {
+		db.Migrator().DropColumn(&models.BookInventory{}, "qr_code")
+	}
+
+	// otps are stored as hashed challenges instead of in clear on the user
+	if db.Migrator().HasColumn(&models.Users{}, "otp") {
+		db.Migrator().DropColumn(&models.Users{}, "otp")
+	}
+
+	return nil
+}
+
+// books used to only count their copies, create the copies behind the counters:
+// one on loan per open loan, one reserved per ready hold and the available ones
+func backfillCopies(db *gorm.DB) {
+	var books []models.BookInventory
+
+	db.Where("NOT EXISTS (SELECT 1 FROM book_copies WHERE book_copies.book_id = book_inventories.id)").Find(&books)
+
+	for _, book := range books {
+		db.Transaction(func(tx *gorm.DB) error {
+			var loans []models.IssueRegistery
+			var holds []models.Hold
+			var last uint
+
+			tx.Where("book_id = ? AND issue_status = ?", book.ID, "issued").Find(&loans)
+			tx.Where("book_id = ? AND status = ?", book.ID, "ready").Find(&holds)
+			tx.Model(&models.BookCopy{}).Where("lib_id = ?", book.LibID).Select("COALESCE(MAX(accession_number), 0)").Scan(&last)
+
+			create := func(status string, holdID *uint) (uint, error) {
+				last++
+				item := models.BookCopy{BookID: book.ID, Barcode: fmt.Sprintf("%08d", last), AccessionNumber: last, Condition: "good", Status: status, HoldID: holdID, LibID: book.LibID}
+				err := tx.Create(&item).Error
+				return item.ID, err
+			}
+
+			for _, loan := range loans {
+				copyID, err := create("on-loan", nil)
+				if err != nil {
+					return err
+				}
+				tx.Model(&models.IssueRegistery{}).Where("issue_id = ?", loan.IssueID).Update("copy_id", copyID)
+			}
+			for i := range holds {
+				if _, err := create("on-hold", &holds[i].ID); err != nil {
+					return err
+				}
+			}
+			for i := uint(0); i < book.AvailableCopies; i++ {
+				if _, err := create("available", nil); err != nil {
+					return err
+				}
+			}
+
+			// the counters now follow the copies
+			return tx.Model(&models.BookInventory{}).Where("id = ?", book.ID).Updates(map[string]interface{}{
+				"total_copies": uint(len(loans)+len(holds)) + book.AvailableCopies, "available_copies": book.AvailableCopies}).Error
+		})
+	}
+}
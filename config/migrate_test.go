@@ -0,0 +1,70 @@
+package config_test
+
+import (
+	"path/filepath"
+	"project/libraryManagement/config"
+	"project/libraryManagement/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// open an empty sqlite database
+func openDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("failed to open test database: %v", err)
+	}
+	t.Cleanup(func() {
+		sqlDB, _ := db.DB()
+		sqlDB.Close()
+	})
+
+	return db
+}
+
+func TestMigrateDropsLegacyColumns(t *testing.T) {
+	db := openDB(t)
+
+	// users used to keep their otp in clear
+	assert.NoError(t, db.Exec("CREATE TABLE `users` (`id` integer PRIMARY KEY AUTOINCREMENT,`email` text,`otp` text)").Error)
+	assert.NoError(t, db.Exec("INSERT INTO users (email, otp) VALUES ('admin@library.test', '1234')").Error)
+
+	assert.NoError(t, config.Migrate(db))
+	assert.False(t, db.Migrator().HasColumn(&models.Users{}, "otp"))
+
+	var user models.Users
+	db.First(&user)
+	assert.Equal(t, "admin@library.test", user.Email)
+}
+
+func TestMigrateRenamesTheBookKey(t *testing.T) {
+	db := openDB(t)
+
+	// books used to be keyed by a numeric isbn
+	assert.NoError(t, db.Exec("CREATE TABLE `book_inventories` (`isbn` integer PRIMARY KEY AUTOINCREMENT,`title` text,`lib_id` integer)").Error)
+	assert.NoError(t, db.Exec("INSERT INTO book_inventories (isbn, title, lib_id) VALUES (42, 'Emma', 1)").Error)
+
+	assert.NoError(t, config.Migrate(db))
+
+	var book models.BookInventory
+	assert.NoError(t, db.First(&book, 42).Error)
+	assert.Equal(t, "Emma", book.Title)
+	assert.Empty(t, book.ISBN)
+}
+
+func TestMigrateReturnsFailures(t *testing.T) {
+	db := openDB(t)
+
+	// emails have to be unique, the constraint can't be added over duplicates
+	assert.NoError(t, db.Exec("CREATE TABLE `users` (`id` integer PRIMARY KEY AUTOINCREMENT,`email` text)").Error)
+	assert.NoError(t, db.Exec("INSERT INTO users (email) VALUES ('reader@library.test'), ('reader@library.test')").Error)
+
+	err := config.Migrate(db)
+	assert.ErrorContains(t, err, "UNIQUE constraint failed")
+}
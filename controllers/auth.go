@@ -1,7 +1,9 @@
 package controllers
 
 import (
+	"errors"
 	"net/http"
+	"project/libraryManagement/middlewares"
 	"project/libraryManagement/utils"
 
 	"github.com/gin-gonic/gin"
@@ -11,9 +13,30 @@ type LoginData struct {
 	Email string `json:"email"`
 }
 
+type RefreshData struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
 type VerifyOTPData struct {
-	Email string `json:"email"`
-	OTP   string `json:"otp"`
+	Email   string `json:"email"`
+	OTP     string `json:"otp"`
+	Purpose string `json:"purpose"`
+}
+
+// map otp errors to the matching http status
+func otpErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, utils.ErrOTPExpired):
+		return http.StatusGone
+	case errors.Is(err, utils.ErrOTPAttemptsExceeded), errors.Is(err, utils.ErrOTPCooldown):
+		return http.StatusTooManyRequests
+	case errors.Is(err, utils.ErrOTPInvalid), errors.Is(err, utils.ErrOTPNotFound):
+		return http.StatusUnauthorized
+	case errors.Is(err, utils.ErrOTPInvalidPurpose):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
 }
 
 // Login
@@ -33,29 +56,14 @@ func Login(c *gin.Context) {
 		return
 	}
 
-	// check if user is admin, owner or a reader
-	if user.Role == "owner" || user.Role == "admin" {
-
-		// send otp for verification
-		result := utils.SendOTP(data.Email)
-		if result != nil {
-			c.IndentedJSON(http.StatusInternalServerError, gin.H{"message": "error sending otp"})
-			return
-		}
-
-		c.IndentedJSON(http.StatusOK, gin.H{"message": "otp sent successfully"})
-	} else {
-
-		// send otp for verification
-		result := utils.SendOTP(data.Email)
-		if result != nil {
-			c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "error sending otp"})
-			return
-		}
-
-		c.IndentedJSON(http.StatusOK, gin.H{"message": "otp sent successfully"})
+	// send otp for verification
+	result := utils.SendOTP(data.Email, utils.OTPPurposeLogin)
+	if result != nil {
+		c.IndentedJSON(otpErrorStatus(result), gin.H{"message": "error sending otp", "error": result.Error()})
+		return
 	}
 
+	c.IndentedJSON(http.StatusOK, gin.H{"message": "otp sent successfully"})
 }
 
 // verify OTP
@@ -74,22 +82,26 @@ func VerifyUserOTP(c *gin.Context) {
 		return
 	}
 
+	if data.Purpose == "" {
+		data.Purpose = utils.OTPPurposeLogin
+	}
+
 	// verify otp
-	user, e := utils.VerifyOTP(data.Email, data.OTP)
+	user, e := utils.VerifyOTP(data.Email, data.OTP, data.Purpose)
 	if e != nil {
-		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": e.Error()})
+		c.IndentedJSON(otpErrorStatus(e), gin.H{"message": e.Error()})
 		return
 	}
 
-	// gererate token
-	token, err := utils.GenerateToken(user)
+	// start a session
+	tokens, err := utils.CreateSession(user, c.Request.UserAgent(), c.ClientIP())
 	if err != nil {
-		c.IndentedJSON(http.StatusBadRequest, gin.H{"messsage": "error generating token", "error": err})
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"messsage": "error generating token", "error": err.Error()})
 		return
 	}
 
-	c.SetCookie("token", token, 3600, "/", "localhost", false, true)
-	c.IndentedJSON(http.StatusOK, gin.H{"message": "Otp verified", "user": user, "token": token})
+	c.SetCookie("token", tokens.AccessToken, int(utils.AccessTokenTTL().Seconds()), "/", "localhost", false, true)
+	c.IndentedJSON(http.StatusOK, gin.H{"message": "Otp verified", "user": user, "token": tokens.AccessToken, "expiresAt": tokens.AccessExpiresAt, "refreshToken": tokens.RefreshToken, "refreshExpiresAt": tokens.RefreshExpiresAt})
 }
 
 // demo login
@@ -108,13 +120,73 @@ func DemoLogin(c *gin.Context) {
 		return
 	}
 
-	// gererate token
-	token, err := utils.GenerateToken(user)
+	// start a session
+	tokens, err := utils.CreateSession(user, c.Request.UserAgent(), c.ClientIP())
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"messsage": "error generating token", "error": err.Error()})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"user": user, "token": tokens.AccessToken, "expiresAt": tokens.AccessExpiresAt, "refreshToken": tokens.RefreshToken, "refreshExpiresAt": tokens.RefreshExpiresAt})
+
+}
+
+// exchange a refresh token for a new access and refresh token
+func RefreshToken(c *gin.Context) {
+	var data RefreshData
+
+	err := c.ShouldBind(&data)
 	if err != nil {
-		c.IndentedJSON(http.StatusBadRequest, gin.H{"messsage": "error generating token", "error": err})
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.IndentedJSON(http.StatusOK, gin.H{"user": user, "token": token})
+	if data.RefreshToken == "" {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "refresh token is required"})
+		return
+	}
+
+	user, tokens, err := utils.RefreshSession(data.RefreshToken, c.Request.UserAgent(), c.ClientIP())
+	if err != nil {
+		c.IndentedJSON(http.StatusUnauthorized, gin.H{"message": err.Error()})
+		return
+	}
+
+	c.SetCookie("token", tokens.AccessToken, int(utils.AccessTokenTTL().Seconds()), "/", "localhost", false, true)
+	c.IndentedJSON(http.StatusOK, gin.H{"message": "token refreshed", "user": user, "token": tokens.AccessToken, "expiresAt": tokens.AccessExpiresAt, "refreshToken": tokens.RefreshToken, "refreshExpiresAt": tokens.RefreshExpiresAt})
+}
+
+// logout of the current session
+func Logout(c *gin.Context) {
+	principal, ok := middlewares.CurrentPrincipal(c)
+	if !ok {
+		c.IndentedJSON(http.StatusUnauthorized, gin.H{"error": "missing principal in the context"})
+		return
+	}
+
+	err := utils.RevokeSession(principal.SessionID)
+	if err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"message": "error logging out"})
+		return
+	}
+
+	c.SetCookie("token", "", -1, "/", "localhost", false, true)
+	c.IndentedJSON(http.StatusOK, gin.H{"message": "logged out successfully"})
+}
+
+// logout of all devices
+func LogoutAll(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	err := utils.RevokeAllSessions(user.ID)
+	if err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"message": "error logging out"})
+		return
+	}
 
+	c.SetCookie("token", "", -1, "/", "localhost", false, true)
+	c.IndentedJSON(http.StatusOK, gin.H{"message": "logged out of all devices"})
 }
@@ -0,0 +1,225 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"project/libraryManagement/cards"
+	"project/libraryManagement/circulation"
+	"project/libraryManagement/labels"
+	"project/libraryManagement/models"
+	"project/libraryManagement/tenant"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type SetPINStruct struct {
+	PIN string `json:"pin"`
+}
+
+// map card errors to the matching http status
+func cardErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, cards.ErrInvalidNumber), errors.Is(err, cards.ErrInvalidPIN):
+		return http.StatusBadRequest
+	case errors.Is(err, cards.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, cards.ErrReplaced):
+		return http.StatusGone
+	case errors.Is(err, cards.ErrWrongPIN):
+		return http.StatusUnauthorized
+	case errors.Is(err, cards.ErrPINNotSet):
+		return http.StatusForbidden
+	case errors.Is(err, cards.ErrPINLocked):
+		return http.StatusTooManyRequests
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// reader holding a scanned library card, the pin is checked when given,
+// writes the error response when unknown
+func cardHolder(c *gin.Context, libID uint, number string, pin string) (*models.Users, bool) {
+	var reader *models.Users
+	var err error
+
+	if pin != "" {
+		reader, err = cards.Authenticate(tenant.DB(c), libID, number, pin)
+	} else {
+		reader, err = cards.FindReader(tenant.DB(c), libID, number)
+	}
+	if err != nil {
+		status := cardErrorStatus(err)
+		if status == http.StatusInternalServerError {
+			c.IndentedJSON(status, gin.H{"message": "error finding the reader"})
+			return nil, false
+		}
+		c.IndentedJSON(status, gin.H{"message": err.Error()})
+		return nil, false
+	}
+
+	return reader, true
+}
+
+// library card of the reader as a printable pdf, or only its qr code with ?format=png
+func respondWithCard(c *gin.Context, reader *models.Users) {
+	if reader.CardNumber == "" {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"message": "the reader has no library card"})
+		return
+	}
+
+	level, err := labels.ParseLevel(c.Query("level"))
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+
+	switch c.DefaultQuery("format", "pdf") {
+	case "pdf":
+		var library models.Library
+		tenant.DB(c).First(&library, reader.LibID)
+
+		pdf, err := labels.CardPDF(labels.Card{Library: library.Name, Name: reader.Name, Number: reader.CardNumber, Printed: cards.Format(reader.CardNumber)}, level)
+		if err != nil {
+			c.IndentedJSON(http.StatusInternalServerError, gin.H{"message": "error generating the card"})
+			return
+		}
+
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="card-%s.pdf"`, reader.CardNumber))
+		c.Data(http.StatusOK, "application/pdf", pdf)
+	case "png":
+		size, err := strconv.Atoi(c.DefaultQuery("size", "256"))
+		if err != nil {
+			c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "size must be a number"})
+			return
+		}
+
+		image, err := labels.PNG(reader.CardNumber, size, level)
+		if err != nil {
+			c.IndentedJSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+			return
+		}
+
+		c.Data(http.StatusOK, "image/png", image)
+	default:
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "format must be pdf or png"})
+	}
+}
+
+// library card of the logged in reader
+func RetrieveReaderCard(c *gin.Context) {
+	reader, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	respondWithCard(c, reader)
+}
+
+// library card of a reader of the library, to print at the desk
+func PrintReaderCard(c *gin.Context) {
+	admin, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	reader, ok := findReader(c, admin.LibID)
+	if !ok {
+		return
+	}
+
+	respondWithCard(c, reader)
+}
+
+// give a reader a new card number, e.g. for a lost card, the old number stops working
+func ReplaceReaderCard(c *gin.Context) {
+	admin, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	reader, ok := findReader(c, admin.LibID)
+	if !ok {
+		return
+	}
+
+	old, err := cards.Replace(tenant.DB(c), reader, admin.ID)
+	if errors.Is(err, cards.ErrCardNumbersExhausted) {
+		c.IndentedJSON(http.StatusServiceUnavailable, gin.H{"message": err.Error()})
+		return
+	}
+	if err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"message": "error replacing the card"})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"message": "card replaced successfully", "reader": reader, "replacedCardNumber": old})
+}
+
+// set the pin the reader confirms their card with at the desk and signs in with at a kiosk
+func SetReaderPIN(c *gin.Context) {
+	var data SetPINStruct
+
+	err := c.ShouldBind(&data)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	reader, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	if err := cards.SetPIN(tenant.DB(c), reader, data.PIN); err != nil {
+		if errors.Is(err, cards.ErrInvalidPIN) {
+			c.IndentedJSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+			return
+		}
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"message": "error saving the pin"})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"message": "pin updated successfully"})
+}
+
+// remove the pin of a reader who forgot it, they set a new one from their account
+func ClearReaderPIN(c *gin.Context) {
+	admin, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	reader, ok := findReader(c, admin.LibID)
+	if !ok {
+		return
+	}
+
+	if err := cards.ClearPIN(tenant.DB(c), reader); err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"message": "error clearing the pin"})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"message": "pin cleared successfully"})
+}
+
+// reader of the library holding a card, with their loans and balance
+func LookupCard(c *gin.Context) {
+	var loans []models.IssueRegistery
+
+	admin, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	reader, ok := cardHolder(c, admin.LibID, c.Param("number"), "")
+	if !ok {
+		return
+	}
+
+	tenant.DB(c).Preload("BookInventory").Where("reader_id = ? AND issue_status = ?", reader.ID, "issued").Order("expected_return_date").Find(&loans)
+	balance, _ := circulation.Balance(tenant.DB(c), reader.ID)
+
+	c.IndentedJSON(http.StatusOK, gin.H{"message": "reader found", "reader": reader, "hasPin": reader.PINHash != "", "loans": loans, "balance": balance})
+}
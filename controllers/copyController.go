@@ -0,0 +1,122 @@
+package controllers
+
+import (
+	"net/http"
+	"project/libraryManagement/circulation"
+	"project/libraryManagement/labels"
+	"project/libraryManagement/models"
+	"project/libraryManagement/tenant"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AddCopiesStruct struct {
+	Count           uint       `json:"count"`
+	Barcode         string     `json:"barcode"`
+	AccessionNumber uint       `json:"accessionNumber"`
+	Condition       string     `json:"condition"`
+	AcquisitionDate *time.Time `json:"acquisitionDate"`
+	Price           uint       `json:"price"`
+}
+
+type UpdateCopyStruct struct {
+	Status    string `json:"status"`
+	Condition string `json:"condition"`
+}
+
+// retrieve the copies of a book, the path takes the book id or its isbn
+func RetrieveCopies(c *gin.Context) {
+	var copies []models.BookCopy
+
+	book, ok := bookParam(c, "id")
+	if !ok {
+		return
+	}
+
+	query := tenant.DB(c).Where("book_id = ?", book.ID)
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	res := query.Order("accession_number").Find(&copies)
+	if res.Error != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "error retrieving copies"})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"message": "copies retrieved successfully", "book": book, "copies": copies})
+}
+
+// add copies to a book, barcodes and accession numbers are assigned unless given for a single copy
+func AddBookCopies(c *gin.Context) {
+	var data AddCopiesStruct
+
+	err := c.ShouldBind(&data)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	book, ok := bookParam(c, "id")
+	if !ok {
+		return
+	}
+
+	if data.Count == 0 {
+		data.Count = 1
+	}
+
+	copies, e := circulation.AddCopies(tenant.DB(c), book.ID, data.Count, circulation.CopyDetails{Barcode: data.Barcode, AccessionNumber: data.AccessionNumber,
+		Condition: data.Condition, AcquisitionDate: data.AcquisitionDate, Price: data.Price})
+	if e != nil {
+		c.IndentedJSON(circulationErrorStatus(e), gin.H{"message": e.Error()})
+		return
+	}
+
+	c.IndentedJSON(http.StatusCreated, gin.H{"message": "copies added successfully", "copies": copies})
+}
+
+// find a copy by its barcode, with its book and the loan it is out on
+func RetrieveCopy(c *gin.Context) {
+	var item models.BookCopy
+
+	res := tenant.DB(c).Preload("BookInventory").Where("barcode = ?", c.Param("barcode")).First(&item)
+	if res.Error != nil {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"message": "copy does not exists"})
+		return
+	}
+
+	var loan *models.IssueRegistery
+	var registry models.IssueRegistery
+	if tenant.DB(c).Where("copy_id = ? AND issue_status = ?", item.ID, "issued").First(&registry).Error == nil {
+		loan = &registry
+	}
+
+	itemURL := labels.ItemURL(item.LibID, item.ID)
+	c.IndentedJSON(http.StatusOK, gin.H{"message": "copy found", "copy": item, "loan": loan, "itemUrl": itemURL, "qrUrl": itemURL + "/qr"})
+}
+
+// change the status or condition of a copy, e.g. mark it damaged, lost or back from repair
+func UpdateCopy(c *gin.Context) {
+	var data UpdateCopyStruct
+
+	err := c.ShouldBind(&data)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if data.Status == "" && data.Condition == "" {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "status or condition is required"})
+		return
+	}
+
+	item, e := circulation.UpdateCopy(tenant.DB(c), c.Param("barcode"), data.Status, data.Condition)
+	if e != nil {
+		c.IndentedJSON(circulationErrorStatus(e), gin.H{"message": e.Error()})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"message": "copy updated successfully", "copy": item})
+}
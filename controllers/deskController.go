@@ -0,0 +1,122 @@
+package controllers
+
+import (
+	"net/http"
+	"project/libraryManagement/circulation"
+	"project/libraryManagement/labels"
+	"project/libraryManagement/models"
+	"project/libraryManagement/tenant"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+type DeskCheckoutStruct struct {
+	Card string `json:"card"`
+	PIN  string `json:"pin"`
+	Code string `json:"code"`
+}
+
+type DeskCheckinStruct struct {
+	Code string `json:"code"`
+}
+
+// barcode of a scanned copy, the code is either its barcode or its qr code (item url or token),
+// writes the error response when the copy is unknown
+func scannedBarcode(c *gin.Context, code string) (string, bool) {
+	code = strings.TrimSpace(code)
+	if code == "" {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "code is required"})
+		return "", false
+	}
+
+	token := code
+	if i := strings.LastIndex(code, "/item/"); i >= 0 {
+		token = strings.SplitN(code[i+len("/item/"):], "/", 2)[0]
+	}
+
+	if _, copyID, err := labels.ParseItemToken(token); err == nil {
+		var item models.BookCopy
+		if tenant.DB(c).Where("id = ?", copyID).First(&item).Error != nil {
+			c.IndentedJSON(http.StatusNotFound, gin.H{"message": "copy does not exists"})
+			return "", false
+		}
+		return item.Barcode, true
+	}
+
+	return code, true
+}
+
+// lend a scanned copy to the reader of a scanned card, without a prior request
+func DeskCheckout(c *gin.Context) {
+	var data DeskCheckoutStruct
+
+	err := c.ShouldBind(&data)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	staff, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	reader, ok := cardHolder(c, staff.LibID, data.Card, data.PIN)
+	if !ok {
+		return
+	}
+
+	barcode, ok := scannedBarcode(c, data.Code)
+	if !ok {
+		return
+	}
+
+	registry, e := circulation.Checkout(tenant.DB(c), reader.ID, barcode, staff.ID)
+	if e != nil {
+		c.IndentedJSON(circulationErrorStatus(e), gin.H{"message": e.Error()})
+		return
+	}
+
+	balance, _ := circulation.Balance(tenant.DB(c), reader.ID)
+
+	tenant.DB(c).Preload("BookInventory").First(registry, registry.IssueID)
+	c.IndentedJSON(http.StatusOK, gin.H{"message": "book checked out", "loan": registry, "reader": reader, "balance": balance})
+}
+
+// take back a scanned copy, the reader is charged for a late return
+func DeskCheckin(c *gin.Context) {
+	var data DeskCheckinStruct
+
+	err := c.ShouldBind(&data)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	staff, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	barcode, ok := scannedBarcode(c, data.Code)
+	if !ok {
+		return
+	}
+
+	registry, e := circulation.Checkin(tenant.DB(c), barcode, staff.ID)
+	if e != nil {
+		c.IndentedJSON(circulationErrorStatus(e), gin.H{"message": e.Error()})
+		return
+	}
+
+	balance, _ := circulation.Balance(tenant.DB(c), registry.ReaderID)
+
+	// a copy reserved for a hold goes to the hold shelf instead of back on the shelf
+	var item models.BookCopy
+	tenant.DB(c).First(&item, registry.CopyID)
+
+	tenant.DB(c).Preload("BookInventory").First(registry, registry.IssueID)
+	c.IndentedJSON(http.StatusOK, gin.H{"message": "book checked in", "loan": registry, "fine": registry.Fine, "balance": balance, "copy": item,
+		"holdShelf": item.Status == circulation.CopyOnHold})
+}
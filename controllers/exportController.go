@@ -0,0 +1,85 @@
+package controllers
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"project/libraryManagement/export"
+	"project/libraryManagement/tenant"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ExportStruct struct {
+	SearchBookStruct
+	Format string     `form:"format,default=csv"`
+	Copies bool       `form:"copies"`
+	From   *time.Time `form:"from" time_format:"2006-01-02"`
+	To     *time.Time `form:"to" time_format:"2006-01-02"`
+}
+
+// stream an export as a file download, errors found before anything was sent are answered as usual
+func streamExport(c *gin.Context, name string, format string, run func(w io.Writer) error) {
+	contentType, extension, err := export.ContentType(format)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+
+	admin, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-%d-%s.%s"`, name, admin.LibID, time.Now().Format("20060102"), extension))
+
+	if err := run(c.Writer); err != nil {
+		if c.Writer.Written() {
+			// the client already has part of the file, it ends where the export failed
+			fmt.Println("export failed:", err)
+			c.Abort()
+			return
+		}
+
+		c.Writer.Header().Del("Content-Type")
+		c.Writer.Header().Del("Content-Disposition")
+		c.IndentedJSON(searchErrorStatus(err), gin.H{"message": err.Error()})
+	}
+}
+
+// export the library's books matching the search filters as csv (the default), json lines or marcxml,
+// with their copies on ?copies=true
+func ExportCatalog(c *gin.Context) {
+	var data ExportStruct
+
+	if err := c.ShouldBindQuery(&data); err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	streamExport(c, "catalog", data.Format, func(w io.Writer) error {
+		return export.Catalog(w, tenant.DB(c), data.Format, data.catalogQuery(), data.Copies)
+	})
+}
+
+// export the circulation history of the books matching the search filters as csv or json lines,
+// ?from= and ?to= (yyyy-mm-dd) limit it to the loans issued in between
+func ExportLoans(c *gin.Context) {
+	var data ExportStruct
+
+	if err := c.ShouldBindQuery(&data); err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if data.Format == export.FormatMARCXML {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": export.ErrLoansFormat.Error()})
+		return
+	}
+
+	streamExport(c, "loans", data.Format, func(w io.Writer) error {
+		return export.Loans(w, tenant.DB(c), data.Format, data.catalogQuery(), data.From, data.To)
+	})
+}
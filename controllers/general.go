@@ -1,7 +1,15 @@
 package controllers
 
 import (
+	"errors"
 	"net/http"
+	"strconv"
+	"project/libraryManagement/circulation"
+	"project/libraryManagement/isbn"
+	"project/libraryManagement/middlewares"
+	"project/libraryManagement/models"
+	"project/libraryManagement/tenant"
+
 	"github.com/gin-gonic/gin"
 )
 
@@ -12,3 +20,95 @@ type EmailData struct {
 func Health(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message":"server is up and running"})
 }
+
+// authenticated user from the context, writes the error response when missing
+func currentUser(c *gin.Context) (*models.Users, bool) {
+	principal, ok := middlewares.CurrentPrincipal(c)
+	if !ok {
+		c.IndentedJSON(http.StatusUnauthorized, gin.H{"error": "missing principal in the context"})
+		return nil, false
+	}
+
+	return &principal.User, true
+}
+
+// map circulation errors to the matching http status
+func circulationErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, circulation.ErrRequestNotFound), errors.Is(err, circulation.ErrBookNotFound), errors.Is(err, circulation.ErrHoldNotFound),
+		errors.Is(err, circulation.ErrCopyNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, circulation.ErrRequestProcessed), errors.Is(err, circulation.ErrHoldExists), errors.Is(err, circulation.ErrHoldClosed),
+		errors.Is(err, circulation.ErrRenewalPending), errors.Is(err, circulation.ErrHoldsWaiting), errors.Is(err, circulation.ErrCopyExists),
+		errors.Is(err, circulation.ErrCopyInUse), errors.Is(err, circulation.ErrAlreadyBorrowed):
+		return http.StatusConflict
+	case errors.Is(err, circulation.ErrNotAvailable), errors.Is(err, circulation.ErrWrongRequestType), errors.Is(err, circulation.ErrRegistryNotFound), errors.Is(err, circulation.ErrBookAvailable),
+		errors.Is(err, circulation.ErrNotBorrowed), errors.Is(err, circulation.ErrRenewalLimit), errors.Is(err, circulation.ErrLoanOverdue), errors.Is(err, circulation.ErrLoanLimit),
+		errors.Is(err, circulation.ErrInvalidEntryType), errors.Is(err, circulation.ErrInvalidAmount), errors.Is(err, circulation.ErrZeroAdjustment),
+		errors.Is(err, circulation.ErrCopyNotLendable), errors.Is(err, circulation.ErrInvalidCopyStatus), errors.Is(err, circulation.ErrCopyCount),
+		errors.Is(err, circulation.ErrCopyNotOnLoan):
+		return http.StatusBadRequest
+	case errors.Is(err, circulation.ErrBalanceTooHigh):
+		return http.StatusPaymentRequired
+	case errors.Is(err, circulation.ErrNotReadersLoan):
+		return http.StatusForbidden
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// numeric path parameter, writes the error response when invalid
+func uintParam(c *gin.Context, name string) (uint, bool) {
+	value, err := strconv.ParseUint(c.Param(name), 10, 64)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": name + " must be a number"})
+		return 0, false
+	}
+
+	return uint(value), true
+}
+
+// find a book of the library by id, or by isbn-10/isbn-13 when no id is given,
+// writes the error response when missing
+func findBook(c *gin.Context, bookID uint, rawISBN string) (*models.BookInventory, bool) {
+	var book models.BookInventory
+
+	query := tenant.DB(c)
+	switch {
+	case bookID != 0:
+		query = query.Where("id = ?", bookID)
+	case rawISBN != "":
+		normalized, err := isbn.Parse(rawISBN)
+		if err != nil {
+			c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "invalid isbn: " + err.Error()})
+			return nil, false
+		}
+		query = query.Where("isbn = ?", normalized)
+	default:
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "bookId or isbn is required"})
+		return nil, false
+	}
+
+	res := query.First(&book)
+	if res.Error != nil {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"message": "book does not exists"})
+		return nil, false
+	}
+
+	return &book, true
+}
+
+// book path parameter, either the id of the book or its isbn
+func bookParam(c *gin.Context, name string) (*models.BookInventory, bool) {
+	value := c.Param(name)
+	if isbn.Valid(value) {
+		return findBook(c, 0, value)
+	}
+
+	id, ok := uintParam(c, name)
+	if !ok {
+		return nil, false
+	}
+
+	return findBook(c, id, "")
+}
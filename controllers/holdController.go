@@ -0,0 +1,112 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"project/libraryManagement/circulation"
+	"project/libraryManagement/models"
+	"project/libraryManagement/tenant"
+
+	"github.com/gin-gonic/gin"
+)
+
+type HoldResponse struct {
+	models.Hold
+	Position int64 `json:"position"`
+}
+
+// place a hold on an unavailable book
+func PlaceHold(c *gin.Context) {
+	var data IssueBookStruct
+
+	err := c.ShouldBind(&data)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	reader, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	book, ok := findBook(c, data.BookID, data.ISBN)
+	if !ok {
+		return
+	}
+
+	hold, e := circulation.PlaceHold(tenant.DB(c), book.ID, reader.ID)
+	if e != nil {
+		c.IndentedJSON(circulationErrorStatus(e), gin.H{"message": e.Error()})
+		return
+	}
+
+	c.IndentedJSON(http.StatusCreated, gin.H{"message": "hold placed successfully", "hold": HoldResponse{Hold: *hold, Position: circulation.QueuePosition(tenant.DB(c), hold)}})
+}
+
+// cancel a hold of the reader
+func CancelHold(c *gin.Context) {
+	reader, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	holdID, ok := uintParam(c, "id")
+	if !ok {
+		return
+	}
+
+	_, e := circulation.CancelHold(tenant.DB(c), holdID, reader.ID)
+	if e != nil {
+		c.IndentedJSON(circulationErrorStatus(e), gin.H{"message": e.Error()})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"message": "hold cancelled"})
+}
+
+// retrieve the active holds of the reader with their queue position
+func RetrieveReaderHolds(c *gin.Context) {
+	var holds []models.Hold
+
+	reader, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	res := tenant.DB(c).Preload("BookInventory").Where("reader_id = ? AND status IN ?", reader.ID, []string{circulation.HoldWaiting, circulation.HoldReady}).Order("id").Find(&holds)
+	if res.Error != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "error retrieving holds"})
+		return
+	}
+
+	list := []HoldResponse{}
+	for _, hold := range holds {
+		list = append(list, HoldResponse{Hold: hold, Position: circulation.QueuePosition(tenant.DB(c), &hold)})
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"message": "holds retrieved successfully", "holds": list})
+}
+
+// retrieve the hold queues of the library
+func RetrieveHolds(c *gin.Context) {
+	var holds []models.Hold
+
+	query := tenant.DB(c).Preload("BookInventory").Where("status IN ?", []string{circulation.HoldWaiting, circulation.HoldReady})
+	if c.Query("bookId") != "" || c.Query("isbn") != "" {
+		bookID, _ := strconv.ParseUint(c.Query("bookId"), 10, 64)
+		book, ok := findBook(c, uint(bookID), c.Query("isbn"))
+		if !ok {
+			return
+		}
+		query = query.Where("book_id = ?", book.ID)
+	}
+
+	res := query.Order("book_id, id").Find(&holds)
+	if res.Error != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "error retrieving holds"})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"message": "holds retrieved successfully", "holds": holds})
+}
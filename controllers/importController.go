@@ -0,0 +1,124 @@
+package controllers
+
+import (
+	"net/http"
+	"project/libraryManagement/config"
+	"project/libraryManagement/importer"
+	"project/libraryManagement/models"
+	"project/libraryManagement/tenant"
+
+	"github.com/gin-gonic/gin"
+)
+
+// largest file accepted by an import
+const maxImportSize = 32 << 20
+
+type ImportCatalogStruct struct {
+	Format string `form:"format"`
+	DryRun bool   `form:"dryRun"`
+}
+
+// import books from a csv, json lines, marc or marcxml file sent as the "file" form field, small files are imported right away
+// and answer with the report of every line, larger ones become a job polled with GET /admin/import/:id.
+// The job lists the marc fields the import left out with the number of records holding them
+func ImportCatalog(c *gin.Context) {
+	var data ImportCatalogStruct
+
+	admin, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImportSize)
+	if err := c.ShouldBind(&data); err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	header, err := c.FormFile("file")
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "a csv, json lines or marc file is required"})
+		return
+	}
+
+	format := data.Format
+	if format == "" {
+		format = importer.FormatOf(header.Filename)
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "error reading the file"})
+		return
+	}
+	defer file.Close()
+
+	records, err := importer.Parse(format, file)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+
+	job := models.ImportJob{FileName: header.Filename, Format: format, DryRun: data.DryRun, Status: importer.StatusQueued, Total: uint(len(records)), Unmapped: importer.Unmapped(records),
+		CreatedByID: admin.ID, LibID: admin.LibID}
+	if err := tenant.DB(c).Create(&job).Error; err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"message": "error creating the import"})
+		return
+	}
+
+	// the request may end before a large file is imported, the job runs outside of it
+	if len(records) > config.GetEnvInt("IMPORT_SYNC_ROWS", 500) {
+		importer.Start(tenant.ForLibrary(admin.LibID), job, records)
+		c.IndentedJSON(http.StatusAccepted, gin.H{"message": "import started", "job": job})
+		return
+	}
+
+	if err := importer.Run(tenant.DB(c), &job, records); err != nil {
+		importer.Fail(tenant.DB(c), &job, err)
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"message": "error importing the file", "job": job})
+		return
+	}
+
+	var rows []models.ImportRow
+	tenant.DB(c).Where("job_id = ?", job.ID).Order("id").Find(&rows)
+
+	c.IndentedJSON(http.StatusOK, gin.H{"message": "import finished", "job": job, "rows": rows})
+}
+
+// imports of the library, latest first
+func RetrieveImportJobs(c *gin.Context) {
+	var jobs []models.ImportJob
+
+	res := tenant.DB(c).Order("id DESC").Find(&jobs)
+	if res.Error != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "error retrieving imports"})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"message": "imports retrieved successfully", "imports": jobs})
+}
+
+// progress of an import and the report of the lines imported so far, ?status=rejected lists only the rejected lines
+func RetrieveImportJob(c *gin.Context) {
+	var job models.ImportJob
+	var rows []models.ImportRow
+
+	id, ok := uintParam(c, "id")
+	if !ok {
+		return
+	}
+
+	res := tenant.DB(c).Where("id = ?", id).First(&job)
+	if res.Error != nil {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"message": "import does not exists"})
+		return
+	}
+
+	query := tenant.DB(c).Where("job_id = ?", job.ID)
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	query.Order("id").Find(&rows)
+
+	c.IndentedJSON(http.StatusOK, gin.H{"message": "import retrieved successfully", "job": job, "rows": rows})
+}
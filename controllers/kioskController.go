@@ -0,0 +1,243 @@
+package controllers
+
+import (
+	"net/http"
+	"project/libraryManagement/cards"
+	"project/libraryManagement/circulation"
+	"project/libraryManagement/middlewares"
+	"project/libraryManagement/models"
+	"project/libraryManagement/tenant"
+	"project/libraryManagement/utils"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type RegisterKioskStruct struct {
+	Name string `json:"name"`
+}
+
+type KioskSignInStruct struct {
+	Card string `json:"card"`
+	PIN  string `json:"pin"`
+}
+
+type KioskScanStruct struct {
+	Card string `json:"card"`
+	PIN  string `json:"pin"`
+	Code string `json:"code"`
+}
+
+// register a self-service kiosk of the library, the credential is only returned here
+func RegisterKiosk(c *gin.Context) {
+	var data RegisterKioskStruct
+
+	err := c.ShouldBind(&data)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	data.Name = strings.TrimSpace(data.Name)
+	if data.Name == "" {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "name is required"})
+		return
+	}
+
+	owner, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	credential, hash, err := utils.NewKioskCredential()
+	if err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"message": "error generating the credential"})
+		return
+	}
+
+	kiosk := models.Kiosk{Name: data.Name, CredentialHash: hash, CreatedByID: owner.ID, LibID: owner.LibID}
+	res := tenant.DB(c).Create(&kiosk)
+	if res.Error != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "error registering the kiosk"})
+		return
+	}
+
+	c.IndentedJSON(http.StatusCreated, gin.H{"message": "kiosk registered, store the credential on the device", "kiosk": kiosk, "credential": credential})
+}
+
+// kiosks of the library
+func RetrieveKiosks(c *gin.Context) {
+	var kiosks []models.Kiosk
+
+	res := tenant.DB(c).Order("id").Find(&kiosks)
+	if res.Error != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "error retrieving kiosks"})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"message": "kiosks retrieved successfully", "kiosks": kiosks})
+}
+
+// kiosk of the library from the path, writes the error response when missing
+func findKiosk(c *gin.Context) (*models.Kiosk, bool) {
+	var kiosk models.Kiosk
+
+	id, ok := uintParam(c, "id")
+	if !ok {
+		return nil, false
+	}
+
+	res := tenant.DB(c).Where("id = ?", id).First(&kiosk)
+	if res.Error != nil {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"message": "kiosk does not exists"})
+		return nil, false
+	}
+
+	return &kiosk, true
+}
+
+// revoke a kiosk, its credential stops working immediately
+func RevokeKiosk(c *gin.Context) {
+	kiosk, ok := findKiosk(c)
+	if !ok {
+		return
+	}
+
+	if kiosk.RevokedAt == nil {
+		now := time.Now()
+		kiosk.RevokedAt = &now
+
+		res := tenant.DB(c).Model(kiosk).Update("revoked_at", now)
+		if res.Error != nil {
+			c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "error revoking the kiosk"})
+			return
+		}
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"message": "kiosk revoked successfully", "kiosk": kiosk})
+}
+
+// audit trail of a kiosk, every request it approved
+func RetrieveKioskTransactions(c *gin.Context) {
+	var events []models.RequestEvent
+
+	kiosk, ok := findKiosk(c)
+	if !ok {
+		return
+	}
+
+	res := tenant.DB(c).Preload("BookInventory").Where("kiosk_id = ?", kiosk.ID).Order("approval_date desc").Find(&events)
+	if res.Error != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "error retrieving transactions"})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"message": "transactions retrieved successfully", "kiosk": kiosk, "transactions": events})
+}
+
+// kiosk of the request and the reader signing in at it with card and pin, writes the error response when refused
+func kioskReader(c *gin.Context, card string, pin string) (*models.Kiosk, *models.Users, bool) {
+	kiosk, ok := middlewares.CurrentKiosk(c)
+	if !ok {
+		c.IndentedJSON(http.StatusUnauthorized, gin.H{"error": "missing kiosk in the context"})
+		return nil, nil, false
+	}
+
+	// the pin is always required at a kiosk
+	if pin == "" {
+		c.IndentedJSON(http.StatusUnauthorized, gin.H{"message": cards.ErrWrongPIN.Error()})
+		return nil, nil, false
+	}
+
+	reader, ok := cardHolder(c, kiosk.LibID, card, pin)
+	if !ok {
+		return nil, nil, false
+	}
+
+	return kiosk, reader, true
+}
+
+// loans and balance of the reader signing in at the kiosk
+func KioskAccount(c *gin.Context) {
+	var data KioskSignInStruct
+	var loans []models.IssueRegistery
+
+	err := c.ShouldBind(&data)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	_, reader, ok := kioskReader(c, data.Card, data.PIN)
+	if !ok {
+		return
+	}
+
+	tenant.DB(c).Preload("BookInventory").Where("reader_id = ? AND issue_status = ?", reader.ID, "issued").Order("expected_return_date").Find(&loans)
+	balance, _ := circulation.Balance(tenant.DB(c), reader.ID)
+
+	c.IndentedJSON(http.StatusOK, gin.H{"message": "signed in", "reader": gin.H{"name": reader.Name, "cardNumber": reader.CardNumber}, "loans": loans, "balance": balance})
+}
+
+// lend a scanned copy to the reader signed in at the kiosk, approved within the loan policy
+func KioskCheckout(c *gin.Context) {
+	var data KioskScanStruct
+
+	err := c.ShouldBind(&data)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	kiosk, reader, ok := kioskReader(c, data.Card, data.PIN)
+	if !ok {
+		return
+	}
+
+	barcode, ok := scannedBarcode(c, data.Code)
+	if !ok {
+		return
+	}
+
+	registry, e := circulation.KioskCheckout(tenant.DB(c), kiosk.ID, reader.ID, barcode)
+	if e != nil {
+		c.IndentedJSON(circulationErrorStatus(e), gin.H{"message": e.Error()})
+		return
+	}
+
+	tenant.DB(c).Preload("BookInventory").First(registry, registry.IssueID)
+	c.IndentedJSON(http.StatusOK, gin.H{"message": "book checked out", "loan": registry})
+}
+
+// take back a scanned copy from the reader signed in at the kiosk
+func KioskCheckin(c *gin.Context) {
+	var data KioskScanStruct
+
+	err := c.ShouldBind(&data)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	kiosk, reader, ok := kioskReader(c, data.Card, data.PIN)
+	if !ok {
+		return
+	}
+
+	barcode, ok := scannedBarcode(c, data.Code)
+	if !ok {
+		return
+	}
+
+	registry, e := circulation.KioskCheckin(tenant.DB(c), kiosk.ID, reader.ID, barcode)
+	if e != nil {
+		c.IndentedJSON(circulationErrorStatus(e), gin.H{"message": e.Error()})
+		return
+	}
+
+	balance, _ := circulation.Balance(tenant.DB(c), reader.ID)
+
+	tenant.DB(c).Preload("BookInventory").First(registry, registry.IssueID)
+	c.IndentedJSON(http.StatusOK, gin.H{"message": "book checked in", "loan": registry, "fine": registry.Fine, "balance": balance})
+}
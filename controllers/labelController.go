@@ -0,0 +1,156 @@
+package controllers
+
+import (
+	"net/http"
+	"project/libraryManagement/circulation"
+	"project/libraryManagement/labels"
+	"project/libraryManagement/models"
+	"project/libraryManagement/tenant"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type PrintLabelsStruct struct {
+	Barcodes []string `json:"barcodes"`
+	BookIDs  []uint   `json:"bookIds"`
+	Layout   string   `json:"layout"`
+	Skip     int      `json:"skip"`
+	Level    string   `json:"level"`
+}
+
+// copy behind a signed item token, writes the error response when invalid
+func findItem(c *gin.Context) (*models.BookCopy, bool) {
+	var item models.BookCopy
+
+	libID, copyID, err := labels.ParseItemToken(c.Param("token"))
+	if err != nil {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"message": "item not found"})
+		return nil, false
+	}
+
+	res := tenant.ForLibrary(libID).Preload("BookInventory").Where("id = ?", copyID).First(&item)
+	if res.Error != nil {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"message": "item not found"})
+		return nil, false
+	}
+
+	return &item, true
+}
+
+// public page of a copy, the target of its qr code
+func RetrieveItem(c *gin.Context) {
+	item, ok := findItem(c)
+	if !ok {
+		return
+	}
+
+	book := item.BookInventory
+	c.IndentedJSON(http.StatusOK, gin.H{"message": "item found", "item": gin.H{
+		"title":      book.Title,
+		"authors":    book.Authors,
+		"isbn":       book.ISBN,
+		"callNumber": book.CallNumber,
+		"barcode":    item.Barcode,
+		"status":     item.Status,
+	}})
+}
+
+// qr code of a copy as png or svg, e.g. /item/:token/qr?format=svg&size=512&level=H
+func RetrieveItemCode(c *gin.Context) {
+	item, ok := findItem(c)
+	if !ok {
+		return
+	}
+
+	level, err := labels.ParseLevel(c.Query("level"))
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+
+	size, err := strconv.Atoi(c.DefaultQuery("size", "256"))
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "size must be a number"})
+		return
+	}
+
+	url := labels.ItemURL(item.LibID, item.ID)
+
+	var image []byte
+	contentType := "image/png"
+	switch c.DefaultQuery("format", "png") {
+	case "png":
+		image, err = labels.PNG(url, size, level)
+	case "svg":
+		contentType = "image/svg+xml"
+		image, err = labels.SVG(url, size, level)
+	default:
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "format must be png or svg"})
+		return
+	}
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+
+	// the code of a copy never changes
+	c.Header("Cache-Control", "public, max-age=86400")
+	c.Data(http.StatusOK, contentType, image)
+}
+
+// pdf of label sheets for the selected copies, by barcode and/or every copy of the given books
+func PrintLabels(c *gin.Context) {
+	var data PrintLabelsStruct
+	var copies []models.BookCopy
+
+	err := c.ShouldBind(&data)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if len(data.Barcodes) == 0 && len(data.BookIDs) == 0 {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "barcodes or bookIds are required"})
+		return
+	}
+
+	layout, err := labels.FindLayout(data.Layout)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": err.Error(), "layouts": labels.Layouts()})
+		return
+	}
+
+	level, err := labels.ParseLevel(data.Level)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+
+	// withdrawn and lost copies don't need a label
+	res := tenant.DB(c).Preload("BookInventory").Where("(barcode IN ? OR book_id IN ?) AND status NOT IN ?", append(data.Barcodes, ""), append(data.BookIDs, 0),
+		[]string{circulation.CopyWithdrawn, circulation.CopyLost}).Order("book_id, accession_number").Find(&copies)
+	if res.Error != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "error retrieving copies"})
+		return
+	}
+
+	if len(copies) == 0 {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"message": "no copies found"})
+		return
+	}
+
+	items := []labels.Label{}
+	for _, item := range copies {
+		items = append(items, labels.Label{Title: item.BookInventory.Title, CallNumber: item.BookInventory.CallNumber, Barcode: item.Barcode, Code: labels.ItemURL(item.LibID, item.ID)})
+	}
+
+	pdf, err := labels.Sheet(layout, items, data.Skip, level)
+	if err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"message": "error generating labels"})
+		return
+	}
+
+	c.Header("Content-Disposition", `attachment; filename="labels.pdf"`)
+	c.Data(http.StatusOK, "application/pdf", pdf)
+}
@@ -0,0 +1,109 @@
+package controllers
+
+import (
+	"net/http"
+	"project/libraryManagement/circulation"
+	"project/libraryManagement/models"
+	"project/libraryManagement/tenant"
+
+	"github.com/gin-gonic/gin"
+)
+
+type LedgerEntryStruct struct {
+	Type   string `json:"type"`
+	Amount int64  `json:"amount"`
+	Note   string `json:"note"`
+}
+
+// entries and balance of a reader's account
+func respondWithLedger(c *gin.Context, readerID uint) {
+	var entries []models.LedgerEntry
+
+	res := tenant.DB(c).Where("reader_id = ?", readerID).Order("id").Find(&entries)
+	if res.Error != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "error retrieving the ledger"})
+		return
+	}
+
+	balance, err := circulation.Balance(tenant.DB(c), readerID)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "error computing the balance"})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"message": "ledger retrieved successfully", "balance": balance, "entries": entries})
+}
+
+// find a reader of the staff member's library from the id path parameter
+func findReader(c *gin.Context, libID uint) (*models.Users, bool) {
+	var reader models.Users
+
+	id, ok := uintParam(c, "id")
+	if !ok {
+		return nil, false
+	}
+
+	res := tenant.DB(c).Where("id = ? AND lib_id = ? AND role = ?", id, libID, "reader").First(&reader)
+	if res.Error != nil {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"message": "reader not found"})
+		return nil, false
+	}
+
+	return &reader, true
+}
+
+// balance and ledger of the logged in reader
+func RetrieveBalance(c *gin.Context) {
+	reader, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	respondWithLedger(c, reader.ID)
+}
+
+// balance and ledger of a reader of the library
+func RetrieveReaderLedger(c *gin.Context) {
+	admin, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	reader, ok := findReader(c, admin.LibID)
+	if !ok {
+		return
+	}
+
+	respondWithLedger(c, reader.ID)
+}
+
+// record a payment, waiver or adjustment on a reader's account
+func RecordLedgerEntry(c *gin.Context) {
+	var data LedgerEntryStruct
+
+	err := c.ShouldBind(&data)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	admin, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	reader, ok := findReader(c, admin.LibID)
+	if !ok {
+		return
+	}
+
+	entry, e := circulation.RecordEntry(tenant.DB(c), reader, data.Type, data.Amount, data.Note, admin.ID)
+	if e != nil {
+		c.IndentedJSON(circulationErrorStatus(e), gin.H{"message": e.Error()})
+		return
+	}
+
+	balance, _ := circulation.Balance(tenant.DB(c), reader.ID)
+
+	c.IndentedJSON(http.StatusCreated, gin.H{"message": "entry recorded successfully", "entry": entry, "balance": balance})
+}
@@ -1,12 +1,18 @@
 package controllers
 
 import (
+	"errors"
 	"github.com/gin-gonic/gin"
-	"github.com/lib/pq"
 	"net/http"
-	"project/libraryManagement/config"
+	"project/libraryManagement/circulation"
+	"project/libraryManagement/isbn"
+	"project/libraryManagement/middlewares"
 	"project/libraryManagement/models"
+	"project/libraryManagement/search"
+	"project/libraryManagement/tenant"
 	"project/libraryManagement/utils"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -15,32 +21,61 @@ type CreateLibrary struct {
 	Email string `json:"email"`
 }
 type InventoryStruct struct {
+	ISBN        string         `json:"isbn"`
 	Title       string         `json:"title"`
-	Authors     pq.StringArray `json:"authors"`
+	Authors     models.StringArray `json:"authors"`
+	Subjects    models.StringArray `json:"subjects"`
 	Publisher   string         `json:"publisher"`
 	Version     string         `json:"version"`
+	Category    string         `json:"category"`
+	CallNumber  string         `json:"callNumber"`
+	Language    string         `json:"language"`
+	Year        uint           `json:"year"`
 	TotalCopies uint           `json:"totalCopies"`
 }
 type AddBookStruct struct {
-	ISBN   uint `json:"isbn"`
-	Copies uint `json:"copies"`
+	BookID uint   `json:"bookId"`
+	ISBN   string `json:"isbn"`
+	Copies uint   `json:"copies"`
 }
 type UpdateBookStruct struct {
-	ISBN        uint           `json:"isbn"`
+	BookID      uint           `json:"bookId"`
+	ISBN        string         `json:"isbn"`
 	Title       string         `json:"title"`
-	Authors     pq.StringArray `json:"authors"`
+	Authors     models.StringArray `json:"authors"`
+	Subjects    models.StringArray `json:"subjects"`
 	Publisher   string         `json:"publisher"`
 	Version     string         `json:"version"`
+	Category    string         `json:"category"`
+	CallNumber  string         `json:"callNumber"`
+	Language    string         `json:"language"`
+	Year        uint           `json:"year"`
 	TotalCopies uint           `json:"totalCopies"`
 }
 type SearchBookStruct struct {
-	Query string `json:"query"`
+	Query         string `json:"query" form:"query"`
+	Author        string `json:"author" form:"author"`
+	Publisher     string `json:"publisher" form:"publisher"`
+	Subject       string `json:"subject" form:"subject"`
+	Language      string `json:"language" form:"language"`
+	YearFrom      uint   `json:"yearFrom" form:"yearFrom"`
+	YearTo        uint   `json:"yearTo" form:"yearTo"`
+	AvailableOnly bool   `json:"availableOnly" form:"availableOnly"`
+	Sort          string `json:"sort" form:"sort"`
+	Cursor        string `json:"cursor" form:"cursor"`
+	Limit         int    `json:"limit" form:"limit"`
+}
+type SuggestStruct struct {
+	Query string `form:"query"`
+	Limit int    `form:"limit"`
 }
 type IssueBookStruct struct {
-	ISBN uint `json:"isbn"`
+	BookID uint   `json:"bookId"`
+	ISBN   string `json:"isbn"`
 }
 type ApproveRequestStruct struct {
-	ReqId uint `json:"reqId"`
+	ReqId   uint   `json:"reqId"`
+	Barcode string `json:"barcode"`
 }
 
 // register a new library and adding a new user as owner
@@ -69,7 +104,7 @@ func RegisterLibrary(c *gin.Context) {
 
 	newLib := models.Library{Name: library.Name}
 
-	newLibRes := config.DB.Create(&newLib)
+	newLibRes := tenant.DB(c).Create(&newLib)
 	if newLibRes.Error != nil {
 		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": newLibRes.Error.Error()})
 		return
@@ -77,22 +112,22 @@ func RegisterLibrary(c *gin.Context) {
 
 	newUser := models.Users{Email: library.Email, LibID: newLib.ID, Role: "owner"}
 
-	newUserRes := config.DB.Create(&newUser)
+	newUserRes := tenant.DB(c).Create(&newUser)
 	if newUserRes.Error != nil {
 		// delete the library as well
-		config.DB.Delete(&models.Library{}, newLib.ID)
+		tenant.DB(c).Delete(&models.Library{}, newLib.ID)
 		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": newLibRes.Error.Error()})
 		return
 	}
 
 	// send otp for verification
-	result := utils.SendOTP(library.Email)
+	result := utils.SendOTP(library.Email, utils.OTPPurposeLibraryRegistration)
 	if result != nil {
 		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "error sending otp"})
 		return
 	}
 
-	c.IndentedJSON(http.StatusCreated, gin.H{"message": "otp sent successfully"})
+	c.IndentedJSON(http.StatusCreated, gin.H{"message": "otp sent successfully", "purpose": utils.OTPPurposeLibraryRegistration})
 }
 
 // Create BookInventory
@@ -106,89 +141,96 @@ func CreateInventory(c *gin.Context) {
 		return
 	}
 
-	value, ok := c.Get("email")
-
+	owner, ok := currentUser(c)
 	if !ok {
-		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "missing email in the context"})
 		return
 	}
 
-	owner, e := utils.FindUser(value)
-	if e != nil {
-		c.IndentedJSON(http.StatusNotFound, gin.H{"message": "user not found"})
-		return
+	// isbn-10 and isbn-13 are both accepted and stored as isbn-13
+	normalized := ""
+	if data.ISBN != "" {
+		normalized, err = isbn.Parse(data.ISBN)
+		if err != nil {
+			c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "invalid isbn: " + err.Error()})
+			return
+		}
 	}
 
 	// if book is not present in lib - create
 	// if book is present in lib - +1
 
-	// check if book is present in library
-	res := config.DB.Preload("Library").Where("title = ? AND lib_id = ?", data.Title, owner.LibID).First(&Inventory)
+	// check if book is present in library, by isbn when given
+	query := tenant.DB(c).Preload("Library").Where("title = ? AND lib_id = ?", data.Title, owner.LibID)
+	if normalized != "" {
+		query = tenant.DB(c).Preload("Library").Where("isbn = ? AND lib_id = ?", normalized, owner.LibID)
+	}
+	res := query.First(&Inventory)
 
 	if res.Error == nil {
-		// inventory exists
-		Inventory.AvailableCopies += data.TotalCopies
-		Inventory.TotalCopies += data.TotalCopies
-		res := config.DB.Save(&Inventory)
-		if res.Error != nil {
-			c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "unable to add book"})
-			return
+		// inventory exists, new copies go to the readers waiting for the book first
+		if data.TotalCopies > 0 {
+			if _, e := circulation.AddCopies(tenant.DB(c), Inventory.ID, data.TotalCopies, circulation.CopyDetails{}); e != nil {
+				c.IndentedJSON(circulationErrorStatus(e), gin.H{"message": "unable to add book", "err": e.Error()})
+				return
+			}
 		}
 		c.IndentedJSON(http.StatusOK, gin.H{"message": "book added to the inventory"})
 	} else {
-		// gerenrate qr code
-		qr, err := utils.GenerateQR(data.Title)
-		if err != nil {
-			c.IndentedJSON(http.StatusInternalServerError, gin.H{"message": "error generating qr code"})
-			return
-		}
 		// inventory doesn't exists
-		item := models.BookInventory{Title: data.Title, Authors: data.Authors, Publisher: data.Publisher, Version: data.Version, TotalCopies: data.TotalCopies, AvailableCopies: data.TotalCopies, LibID: owner.LibID, QrCode: qr}
-		res := config.DB.Create(&item)
+		item := models.BookInventory{ISBN: normalized, Title: data.Title, Authors: data.Authors, Subjects: data.Subjects, Publisher: data.Publisher, Version: data.Version, Category: circulation.NormalizeCategory(data.Category), CallNumber: data.CallNumber, Language: strings.ToLower(strings.TrimSpace(data.Language)), Year: data.Year, LibID: owner.LibID}
+		res := tenant.DB(c).Create(&item)
 		if res.Error != nil {
 			c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "unable to create inventory", "err": res.Error.Error()})
 			return
 		}
+		search.RefreshSuggestions(owner.LibID)
+
+		// the counters follow the copies
+		if data.TotalCopies > 0 {
+			if _, e := circulation.AddCopies(tenant.DB(c), item.ID, data.TotalCopies, circulation.CopyDetails{}); e != nil {
+				c.IndentedJSON(circulationErrorStatus(e), gin.H{"message": "unable to create copies", "err": e.Error()})
+				return
+			}
+		}
 		c.IndentedJSON(http.StatusCreated, gin.H{"message": "inventory created successfully"})
 	}
 }
 
 // Remove a book
 func RemoveBook(c *gin.Context) {
-	id := c.Param("id")
-	var Inventory models.BookInventory
-
-	if id == "" {
-		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "isbn is required"})
-		return
-	}
-
-	// check if inventory is present in the library
-	book := config.DB.Where("isbn = ?", id).First(&Inventory)
-	if book.Error != nil {
-		// doesn't exists
-		c.IndentedJSON(http.StatusNotFound, gin.H{"message": "book inventory does not exists"})
+	// check if inventory is present in the library, the path takes the book id or its isbn
+	book, ok := bookParam(c, "id")
+	if !ok {
 		return
 	}
+	Inventory := *book
 
-	if Inventory.TotalCopies > 1 && Inventory.AvailableCopies > 1 {
-		Inventory.TotalCopies -= 1
-		Inventory.AvailableCopies -= 1
-		res := config.DB.Save(&Inventory)
-		if res.Error != nil {
+	if Inventory.TotalCopies > 1 {
+		// withdraw a copy from the shelf
+		_, e := circulation.WithdrawCopy(tenant.DB(c), Inventory.ID)
+		if e != nil {
+			if errors.Is(e, circulation.ErrNotAvailable) {
+				c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "issued books cannot be removed"})
+				return
+			}
 			c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "unable to remove book"})
 			return
 		}
 		c.IndentedJSON(http.StatusOK, gin.H{"message": "book removed successfully"})
 	} else {
-		if Inventory.TotalCopies > 1 {
+		if Inventory.AvailableCopies < Inventory.TotalCopies {
 			c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "issued books cannot be removed"})
 		} else {
-			// remove inventory
-			del := config.DB.Where("isbn = ?", id).Delete(&Inventory)
+			// remove inventory and its copies
+			del := tenant.DB(c).Where("book_id = ?", Inventory.ID).Delete(&models.BookCopy{})
+			if del.Error == nil {
+				del = tenant.DB(c).Where("id = ?", Inventory.ID).Delete(&Inventory)
+			}
 			if del.Error != nil {
 				c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "unable to remove book"})
+				return
 			}
+			search.RefreshSuggestions(Inventory.LibID)
 			c.IndentedJSON(http.StatusOK, gin.H{"message": "inventory removed successfully"})
 		}
 	}
@@ -197,7 +239,6 @@ func RemoveBook(c *gin.Context) {
 // Add book
 func AddBook(c *gin.Context) {
 	var data AddBookStruct
-	var Inventory models.BookInventory
 
 	err := c.ShouldBind(&data)
 	if err != nil {
@@ -206,29 +247,24 @@ func AddBook(c *gin.Context) {
 	}
 
 	// check if inventory exists
-	isInventory := config.DB.Where("isbn = ?", data.ISBN).First(&Inventory)
-	if isInventory.Error != nil {
-		c.IndentedJSON(http.StatusNotFound, gin.H{"message": "inventory does not exists"})
+	book, ok := findBook(c, data.BookID, data.ISBN)
+	if !ok {
 		return
 	}
 
-	Inventory.TotalCopies += data.Copies
-	Inventory.AvailableCopies += data.Copies
-
-	// save
-	update := config.DB.Save(&Inventory)
-	if update.Error != nil {
-		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "error updating book inventory"})
+	// new copies go to the readers waiting for the book first
+	copies, e := circulation.AddCopies(tenant.DB(c), book.ID, data.Copies, circulation.CopyDetails{})
+	if e != nil {
+		c.IndentedJSON(circulationErrorStatus(e), gin.H{"message": e.Error()})
 		return
 	}
 
-	c.IndentedJSON(http.StatusCreated, gin.H{"message": "book(s) added successfully"})
+	c.IndentedJSON(http.StatusCreated, gin.H{"message": "book(s) added successfully", "copies": copies})
 }
 
 // Update book
 func UpdateBook(c *gin.Context) {
 	var data UpdateBookStruct
-	var Inventory models.BookInventory
 
 	err := c.ShouldBind(&data)
 	if err != nil {
@@ -236,61 +272,111 @@ func UpdateBook(c *gin.Context) {
 		return
 	}
 
-	// check if inventory exists
-	isInventory := config.DB.Where("isbn = ?", data.ISBN).First(&Inventory)
-	if isInventory.Error != nil {
-		c.IndentedJSON(http.StatusNotFound, gin.H{"message": "inventory does not exists"})
-		return
+	// the book is identified by its id, or by its isbn when no id is given,
+	// with an id the isbn is the new isbn of the book
+	lookupISBN, newISBN := data.ISBN, ""
+	if data.BookID != 0 && data.ISBN != "" {
+		lookupISBN = ""
+		newISBN, err = isbn.Parse(data.ISBN)
+		if err != nil {
+			c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "invalid isbn: " + err.Error()})
+			return
+		}
 	}
 
-	// generate qr code
-	qr, e := utils.GenerateQR(data.Title)
-	if e != nil {
-		c.IndentedJSON(http.StatusInternalServerError, gin.H{"message": "error generating qr"})
+	// check if inventory exists
+	book, ok := findBook(c, data.BookID, lookupISBN)
+	if !ok {
 		return
 	}
+	Inventory := *book
 
 	// update the inventory
-	update := config.DB.Where("isbn = ?", data.ISBN).Updates(models.BookInventory{Title: data.Title, Authors: data.Authors, Publisher: data.Publisher,
-		Version: data.Version, QrCode: qr, TotalCopies: data.TotalCopies + Inventory.TotalCopies, AvailableCopies: data.TotalCopies + Inventory.AvailableCopies,})
+	update := tenant.DB(c).Where("id = ?", Inventory.ID).Updates(models.BookInventory{ISBN: newISBN, Title: data.Title, Authors: data.Authors, Subjects: data.Subjects, Publisher: data.Publisher,
+		Version: data.Version, Category: circulation.NormalizeCategory(data.Category), CallNumber: data.CallNumber, Language: strings.ToLower(strings.TrimSpace(data.Language)), Year: data.Year,})
 	if update.Error != nil {
+		if newISBN != "" && tenant.DB(c).Where("isbn = ? AND id <> ?", newISBN, Inventory.ID).First(&models.BookInventory{}).Error == nil {
+			c.IndentedJSON(http.StatusConflict, gin.H{"message": "another book already has this isbn"})
+			return
+		}
 		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "error updating the inventory"})
 		return
 	}
+	search.RefreshSuggestions(Inventory.LibID)
+
+	// new copies go to the readers waiting for the book first
+	if data.TotalCopies > 0 {
+		if _, e := circulation.AddCopies(tenant.DB(c), Inventory.ID, data.TotalCopies, circulation.CopyDetails{}); e != nil {
+			c.IndentedJSON(circulationErrorStatus(e), gin.H{"message": e.Error()})
+			return
+		}
+	}
 
 	c.IndentedJSON(http.StatusCreated, gin.H{"message": "Inventory updated successfully"})
 }
 
-// retrieve books by libid
+// catalog query of a search request
+func (data SearchBookStruct) catalogQuery() search.Query {
+	return search.Query{
+		Text:          data.Query,
+		Author:        data.Author,
+		Publisher:     data.Publisher,
+		Subject:       data.Subject,
+		Language:      data.Language,
+		YearFrom:      data.YearFrom,
+		YearTo:        data.YearTo,
+		AvailableOnly: data.AvailableOnly,
+		Sort:          data.Sort,
+		Cursor:        data.Cursor,
+		Limit:         data.Limit,
+	}
+}
+
+// http status of a catalog search error
+func searchErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, search.ErrInvalidSort), errors.Is(err, search.ErrInvalidCursor), errors.Is(err, search.ErrInvalidYears):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// public catalog of a library, filtered, sorted and paged with the query parameters of a search
 func RetrieveBooksByLib(c *gin.Context) {
 	var Library models.Library
-	var Books []models.BookInventory
+	var data SearchBookStruct
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "invalid library id"})
+		return
+	}
 
-	id := c.Param("id")
-	if id == "" {
-		c.IndentedJSON(http.StatusBadGateway, gin.H{"message": "id is required"})
+	if err := c.ShouldBindQuery(&data); err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
 	// check if library exists
-	lib := config.DB.Where("id = ?", id).First(&Library)
+	lib := tenant.DB(c).Where("id = ?", id).First(&Library)
 	if lib.Error != nil {
 		c.IndentedJSON(http.StatusNotFound, gin.H{"message": "library not found"})
 		return
 	}
 
-	res := config.DB.Where("lib_id  = ?", id).Find(&Books)
-	if res.Error != nil {
-		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "error finding books"})
+	page, err := search.Find(tenant.ForLibrary(uint(id)), data.catalogQuery())
+	if err != nil {
+		c.IndentedJSON(searchErrorStatus(err), gin.H{"message": err.Error()})
 		return
 	}
 
-	c.IndentedJSON(http.StatusOK, gin.H{"message": "books found", "list": Books})
+	c.IndentedJSON(http.StatusOK, gin.H{"message": "books found", "list": page.Results, "nextCursor": page.NextCursor, "total": page.Total, "facets": page.Facets})
 }
 
-// Search book by Title, Publisher and Author
+// catalog search of the reader's library: full text over the title, authors, subjects and publisher,
+// with filters, a sort, facet counts and a cursor for the next page
 func SearchBook(c *gin.Context) {
-	var Inventory []models.BookInventory
 	var data SearchBookStruct
 
 	err := c.ShouldBind(&data)
@@ -299,27 +385,41 @@ func SearchBook(c *gin.Context) {
 		return
 	}
 
-	if data.Query == "" {
-		search := config.DB.Find(&Inventory)
-		if search.Error != nil {
-			c.IndentedJSON(http.StatusNotFound, gin.H{"message": "could not perform search operation"})
-			return
-		}
-	} else {
-		search := config.DB.Where("title = ? OR publisher = ? OR ?=ANY(authors)", data.Query, data.Query, data.Query).Find(&Inventory)
-		if search.Error != nil {
-			c.IndentedJSON(http.StatusNotFound, gin.H{"message": "could not perform search operation"})
-			return
-		}
+	page, err := search.Find(tenant.DB(c), data.catalogQuery())
+	if err != nil {
+		c.IndentedJSON(searchErrorStatus(err), gin.H{"message": err.Error()})
+		return
 	}
 
-	c.IndentedJSON(http.StatusOK, gin.H{"result": Inventory})
+	c.IndentedJSON(http.StatusOK, gin.H{"result": page.Results, "nextCursor": page.NextCursor, "total": page.Total, "facets": page.Facets})
+}
+
+// titles, authors and subjects of the reader's library completing what they typed, for search as you type
+func SuggestBooks(c *gin.Context) {
+	var data SuggestStruct
+
+	reader, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	if err := c.ShouldBindQuery(&data); err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	suggestions, err := search.Suggest(tenant.DB(c), reader.LibID, data.Query, data.Limit)
+	if err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"message": "could not load suggestions"})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"suggestions": suggestions})
 }
 
 // issue book request
 func IssueRequest(c *gin.Context) {
 	var data IssueBookStruct
-	var Inventory models.BookInventory
 	var User models.Users
 	var Event models.RequestEvent
 
@@ -329,43 +429,53 @@ func IssueRequest(c *gin.Context) {
 		return
 	}
 
-	value, ok := c.Get("email")
-
+	reader, ok := currentUser(c)
 	if !ok {
-		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "missing email in the context"})
-		return
-	}
-
-	reader, e := utils.FindUser(value)
-	if e != nil {
-		c.IndentedJSON(http.StatusNotFound, gin.H{"message": "user not found"})
 		return
 	}
 
 	// check if user exists
-	user := config.DB.Where("id = ?", reader.ID).First(&User)
+	user := tenant.DB(c).Where("id = ?", reader.ID).First(&User)
 	if user.Error != nil {
 		c.IndentedJSON(http.StatusNotFound, gin.H{"message": "user does not exists"})
 		return
 	}
 
 	// check if book is available
-	book := config.DB.Where("isbn = ?", data.ISBN).First(&Inventory)
-	if book.Error != nil {
-		c.IndentedJSON(http.StatusNotFound, gin.H{"message": "book does not exists"})
+	book, ok := findBook(c, data.BookID, data.ISBN)
+	if !ok {
 		return
 	}
+	Inventory := *book
 
 	// check if request already exists
-	req := config.DB.Where("book_id = ? AND reader_id = ? AND request_type = ? AND NOT status = ?", data.ISBN, reader.ID, "issue", "rejected").First(&Event)
+	req := tenant.DB(c).Where("book_id = ? AND reader_id = ? AND request_type = ? AND status = ?", Inventory.ID, reader.ID, "issue", "pending").First(&Event)
 	if req.Error == nil {
 		c.IndentedJSON(http.StatusConflict, gin.H{"message": "you have already requested this book"})
 		return
 	}
 
-	if Inventory.AvailableCopies > 0 {
+	// check if the reader still has the book
+	var issued int64
+	tenant.DB(c).Model(&models.IssueRegistery{}).Where("book_id = ? AND reader_id = ? AND issue_status = ?", Inventory.ID, reader.ID, "issued").Count(&issued)
+	if issued > 0 {
+		c.IndentedJSON(http.StatusConflict, gin.H{"message": "you have already borrowed this book"})
+		return
+	}
+
+	// check the loan limit of the library's policy
+	if e := circulation.CheckIssueRequest(tenant.DB(c), reader.ID, &Inventory); e != nil {
+		c.IndentedJSON(circulationErrorStatus(e), gin.H{"message": e.Error()})
+		return
+	}
+
+	// a ready hold has a copy reserved for the reader
+	var ready int64
+	tenant.DB(c).Model(&models.Hold{}).Where("book_id = ? AND reader_id = ? AND status = ?", Inventory.ID, reader.ID, circulation.HoldReady).Count(&ready)
+
+	if Inventory.AvailableCopies > 0 || ready > 0 {
 		// available
-		request := config.DB.Create(&models.RequestEvent{ReaderId: reader.ID, BookId: data.ISBN, RequestDate: time.Now(), RequestType: "issue", Status: "pending"})
+		request := tenant.DB(c).Create(&models.RequestEvent{ReaderId: reader.ID, BookId: Inventory.ID, RequestDate: time.Now(), RequestType: "issue", Status: "pending"})
 		if request.Error != nil {
 			c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "error creating the request"})
 			return
@@ -373,15 +483,13 @@ func IssueRequest(c *gin.Context) {
 		c.IndentedJSON(http.StatusOK, gin.H{"message": "request has been created"})
 	} else {
 		// not available
-		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "book is not available"})
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "book is not available, place a hold to join the queue"})
 	}
 }
 
 // approve issue request
 func ApproveIssueRequest(c *gin.Context) {
 	var data ApproveRequestStruct
-	var RequestEvent models.RequestEvent
-	var Inventory models.BookInventory
 
 	err := c.ShouldBind(&data)
 	if err != nil {
@@ -389,96 +497,43 @@ func ApproveIssueRequest(c *gin.Context) {
 		return
 	}
 
-	// check if the event exists
-	event := config.DB.Where("req_id = ?", data.ReqId).First(&RequestEvent)
-	if event.Error != nil {
-		c.IndentedJSON(http.StatusNotFound, gin.H{"message": "request event does not exists"})
-		return
-	}
-
 	// check if user exists
-	value, ok := c.Get("email")
-
+	admin, ok := currentUser(c)
 	if !ok {
-		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "missing email in the context"})
 		return
 	}
 
-	admin, e := utils.FindUser(value)
+	// approve the request, update the availability and the registry in one transaction
+	// the scanned copy when given, else the reserved or any available copy
+	registry, e := circulation.ApproveIssueCopy(tenant.DB(c), data.ReqId, admin.ID, data.Barcode)
 	if e != nil {
-		c.IndentedJSON(http.StatusNotFound, gin.H{"message": "user not found"})
+		c.IndentedJSON(circulationErrorStatus(e), gin.H{"message": e.Error()})
 		return
 	}
 
-	// approve the request
-	RequestEvent.ApproverID = &admin.ID
-	RequestEvent.ApprovalDate = &[]time.Time{time.Now()}[0]
-	RequestEvent.Status = "approved"
-
-	saveEvent := config.DB.Save(&RequestEvent)
-	if saveEvent.Error != nil {
-		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "error updating the event request"})
-		return
-	}
-
-	// update the availability of the book
-	book := config.DB.Where("isbn = ?", RequestEvent.BookId).First(&Inventory)
-	if book.Error != nil {
-		c.IndentedJSON(http.StatusInternalServerError, gin.H{"message": "unable to find book"})
-		return
-	}
-	if Inventory.AvailableCopies > 0 {
-		Inventory.AvailableCopies -= 1
-		save := config.DB.Save(&Inventory)
-		if save.Error != nil {
-			c.IndentedJSON(http.StatusInternalServerError, gin.H{"message": "unable to update copies"})
-			return
-		}
-
-		// update the issue registry
-		registry := config.DB.Create(&models.IssueRegistery{ISBN: RequestEvent.BookId, ReaderID: RequestEvent.ReaderId, IssueApproverID: admin.ID, IssueStatus: "issued", IssueDate: time.Now(), ExpectedReturnDate: time.Now().AddDate(0, 0, 7)})
-		if registry.Error != nil {
-			c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "error creating registry"})
-		}
-
-		c.IndentedJSON(http.StatusOK, gin.H{"message": "request event approved"})
-	} else {
-		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "book is not available"})
-	}
-
+	c.IndentedJSON(http.StatusOK, gin.H{"message": "request event approved", "registry": registry})
 }
 
 // reject request
 func RejectRequest(c *gin.Context) {
 	var data ApproveRequestStruct
-	var RequestEvent models.RequestEvent
 
 	err := c.ShouldBind(&data)
 	if err != nil {
 		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	// check if the event exists
-	event := config.DB.Where("req_id = ?", data.ReqId).First(&RequestEvent)
-	if event.Error != nil {
-		c.IndentedJSON(http.StatusNotFound, gin.H{"message": "request event does not exists"})
-		return
-	}
 
 	// check if user exists
-	_, ok := c.Get("email")
-
+	_, ok := currentUser(c)
 	if !ok {
-		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "missing email in the context"})
 		return
 	}
 
 	// reject the request
-	RequestEvent.Status = "rejected"
-
-	saveEvent := config.DB.Save(&RequestEvent)
-	if saveEvent.Error != nil {
-		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "error updating the event request"})
+	_, e := circulation.Reject(tenant.DB(c), data.ReqId)
+	if e != nil {
+		c.IndentedJSON(circulationErrorStatus(e), gin.H{"message": e.Error()})
 		return
 	}
 
@@ -488,7 +543,6 @@ func RejectRequest(c *gin.Context) {
 // return book request
 func ReturnRequest(c *gin.Context) {
 	var data IssueBookStruct
-	var Inventory models.BookInventory
 	var User models.Users
 	var Event models.RequestEvent
 	var Request models.RequestEvent
@@ -499,48 +553,40 @@ func ReturnRequest(c *gin.Context) {
 		return
 	}
 
-	value, ok := c.Get("email")
-
+	reader, ok := currentUser(c)
 	if !ok {
-		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "missing email in the context"})
-		return
-	}
-
-	reader, e := utils.FindUser(value)
-	if e != nil {
-		c.IndentedJSON(http.StatusNotFound, gin.H{"message": "user not found"})
 		return
 	}
 
 	// check if user exists
-	user := config.DB.Where("id = ?", reader.ID).First(&User)
+	user := tenant.DB(c).Where("id = ?", reader.ID).First(&User)
 	if user.Error != nil {
 		c.IndentedJSON(http.StatusNotFound, gin.H{"message": "user does not exists"})
 		return
 	}
 
 	// check if book is available
-	book := config.DB.Where("isbn = ?", data.ISBN).First(&Inventory)
-	if book.Error != nil {
-		c.IndentedJSON(http.StatusNotFound, gin.H{"message": "book does not exists"})
+	book, ok := findBook(c, data.BookID, data.ISBN)
+	if !ok {
 		return
 	}
+	Inventory := *book
 
 	// check if book is issued or not
-	issue := config.DB.Where("book_id = ? AND reader_id = ? AND request_type = ?", data.ISBN, reader.ID, "issue").First(&Event)
+	issue := tenant.DB(c).Where("book_id = ? AND reader_id = ? AND request_type = ?", Inventory.ID, reader.ID, "issue").First(&Event)
 	if issue.Error != nil {
 		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "you cannot return a book that has not been issued"})
 		return
 	}
 
 	// check if request already exists
-	req := config.DB.Where("book_id = ? AND reader_id = ? AND request_type = ? AND NOT status = ?", data.ISBN, reader.ID, "return", "rejected").First(&Request)
+	req := tenant.DB(c).Where("book_id = ? AND reader_id = ? AND request_type = ? AND NOT status = ?", Inventory.ID, reader.ID, "return", "rejected").First(&Request)
 	if req.Error == nil {
 		c.IndentedJSON(http.StatusConflict, gin.H{"message": "you have already requested to returned this book"})
 		return
 	}
 
-	res := config.DB.Create(&models.RequestEvent{BookId: Event.BookId, ReaderId: Event.ReaderId, RequestDate: time.Now(), RequestType: "return", Status: "pending"})
+	res := tenant.DB(c).Create(&models.RequestEvent{BookId: Event.BookId, ReaderId: Event.ReaderId, RequestDate: time.Now(), RequestType: "return", Status: "pending"})
 	if res.Error != nil {
 		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "error creating the request"})
 	}
@@ -551,9 +597,6 @@ func ReturnRequest(c *gin.Context) {
 // approve return request
 func ApproveReturnRequest(c *gin.Context) {
 	var data ApproveRequestStruct
-	var RequestEvent models.RequestEvent
-	var IssueRegistery models.IssueRegistery
-	var Inventory models.BookInventory
 
 	err := c.ShouldBind(&data)
 	if err != nil {
@@ -561,93 +604,91 @@ func ApproveReturnRequest(c *gin.Context) {
 		return
 	}
 
-	// check if the event exists
-	event := config.DB.Where("req_id = ?", data.ReqId).First(&RequestEvent)
-	if event.Error != nil {
-		c.IndentedJSON(http.StatusNotFound, gin.H{"message": "request event does not exists"})
-		return
-	}
-
-	value, ok := c.Get("email")
-
+	admin, ok := currentUser(c)
 	if !ok {
-		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "missing email in the context"})
 		return
 	}
 
-	admin, e := utils.FindUser(value)
+	// approve the request, update the availability and close the registry in one transaction
+	registry, e := circulation.ApproveReturn(tenant.DB(c), data.ReqId, admin.ID)
 	if e != nil {
-		c.IndentedJSON(http.StatusNotFound, gin.H{"message": "user not found"})
+		c.IndentedJSON(circulationErrorStatus(e), gin.H{"message": e.Error()})
 		return
 	}
 
-	// find the issue registry
-	registry := config.DB.Where("isbn = ? AND reader_id = ? AND issue_approver_id = ? AND issue_status = ?", RequestEvent.BookId, RequestEvent.ReaderId, admin.ID, "issued").First(&IssueRegistery)
+	c.IndentedJSON(http.StatusOK, gin.H{"message": "request event approved successfully", "registry": registry})
+}
+
+// renew book request
+func RenewRequest(c *gin.Context) {
+	var data IssueBookStruct
 
-	if registry.Error != nil {
-		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "error finding the issue registry"})
+	err := c.ShouldBind(&data)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// update the availability of the book
-	book := config.DB.Where("isbn = ?", RequestEvent.BookId).First(&Inventory)
-	if book.Error != nil {
-		c.IndentedJSON(http.StatusInternalServerError, gin.H{"message": "unable to find book"})
+	reader, ok := currentUser(c)
+	if !ok {
 		return
 	}
 
-	Inventory.AvailableCopies += 1
-	save := config.DB.Save(&Inventory)
-	if save.Error != nil {
-		c.IndentedJSON(http.StatusInternalServerError, gin.H{"message": "unable to update copies"})
+	book, ok := findBook(c, data.BookID, data.ISBN)
+	if !ok {
 		return
 	}
 
-	// approve the request
-	RequestEvent.ApproverID = &admin.ID
-	RequestEvent.ApprovalDate = &[]time.Time{time.Now()}[0]
-	RequestEvent.Status = "approved"
+	event, registry, e := circulation.RequestRenewal(tenant.DB(c), book.ID, reader.ID)
+	if e != nil {
+		c.IndentedJSON(circulationErrorStatus(e), gin.H{"message": e.Error()})
+		return
+	}
 
-	saveEvent := config.DB.Save(&RequestEvent)
-	if saveEvent.Error != nil {
-		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "error updating the event request"})
+	if event.Status == "pending" {
+		c.IndentedJSON(http.StatusOK, gin.H{"message": "renewal request has been created", "request": event})
 		return
 	}
 
-	// update the issue registry
-	IssueRegistery.ReturnDate = &[]time.Time{time.Now()}[0]
-	IssueRegistery.ReturnApproverID = &admin.ID
-	IssueRegistery.IssueStatus = "returned"
+	c.IndentedJSON(http.StatusOK, gin.H{"message": "book renewed successfully", "request": event, "registry": registry})
+}
+
+// approve renew request
+func ApproveRenewRequest(c *gin.Context) {
+	var data ApproveRequestStruct
 
-	saveRegistry := config.DB.Save(&IssueRegistery)
-	if saveRegistry.Error != nil {
-		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "error updating issue registry"})
+	err := c.ShouldBind(&data)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
 
-	c.IndentedJSON(http.StatusOK, gin.H{"message": "request event approved successfully"})
+	admin, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	registry, e := circulation.ApproveRenewal(tenant.DB(c), data.ReqId, admin.ID)
+	if e != nil {
+		c.IndentedJSON(circulationErrorStatus(e), gin.H{"message": e.Error()})
+		return
+	}
 
+	c.IndentedJSON(http.StatusOK, gin.H{"message": "renewal approved", "registry": registry})
 }
 
 // Retrieve Requests
 func RetrieveRequets(c *gin.Context) {
 	var events []models.RequestEvent
-	value, ok := c.Get("email")
-
+	user, ok := currentUser(c)
 	if !ok {
-		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "missing email in the context"})
 		return
 	}
 
-	user, e := utils.FindUser(value)
-	if e != nil {
-		c.IndentedJSON(http.StatusNotFound, gin.H{"message": "user not found"})
-		return
-	}
-
-	// retrieve all events by user
-	if user.Role == "reader" {
+	// retrieve all events by user, staff see every event of the library
+	if !middlewares.HasPermission(user.Role, middlewares.PermCirculationManage) {
 		// reader
-		res := config.DB.Preload("BookInventory").Where("reader_id = ?", user.ID).Find(&events)
+		res := tenant.DB(c).Preload("BookInventory").Where("reader_id = ?", user.ID).Find(&events)
 		if res.Error != nil {
 			c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "error retrieving request events"})
 			return
@@ -655,22 +696,15 @@ func RetrieveRequets(c *gin.Context) {
 
 		c.IndentedJSON(http.StatusOK, gin.H{"message": "requests retrieved successfully", "requests": events})
 
-	} else if user.Role == "admin" {
+	} else {
 		// admin
-		var filtered []models.RequestEvent
-		res := config.DB.Preload("BookInventory").Find(&events)
+		res := tenant.DB(c).Preload("BookInventory").Find(&events)
 		if res.Error != nil {
 			c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "error retrieving request events"})
 			return
 		}
 
-		for _, value := range events {
-			if value.BookInventory.LibID == user.LibID {
-				filtered = append(filtered, value)
-			}
-		}
-
-		c.IndentedJSON(http.StatusOK, gin.H{"message": "requests retrieved successfully", "requests": filtered})
+		c.IndentedJSON(http.StatusOK, gin.H{"message": "requests retrieved successfully", "requests": events})
 
 	}
 }
@@ -678,22 +712,14 @@ func RetrieveRequets(c *gin.Context) {
 // Retrieve Registry
 func RetrieveRegistry(c *gin.Context) {
 	var registry []models.IssueRegistery
-	value, ok := c.Get("email")
-
+	user, ok := currentUser(c)
 	if !ok {
-		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "missing email in the context"})
 		return
 	}
-
-	user, e := utils.FindUser(value)
-	if e != nil {
-		c.IndentedJSON(http.StatusNotFound, gin.H{"message": "user not found"})
-		return
-	}
-	// retrieve all events by user
-	if user.Role == "reader" {
+	// retrieve all events by user, staff see every event of the library
+	if !middlewares.HasPermission(user.Role, middlewares.PermCirculationManage) {
 		// reader
-		res := config.DB.Preload("BookInventory").Where("reader_id = ?", user.ID).Find(&registry)
+		res := tenant.DB(c).Preload("BookInventory").Where("reader_id = ?", user.ID).Find(&registry)
 		if res.Error != nil {
 			c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "error retrieving registry"})
 			return
@@ -701,10 +727,10 @@ func RetrieveRegistry(c *gin.Context) {
 
 		c.IndentedJSON(http.StatusOK, gin.H{"message": "registry retrieved successfully", "registry": registry})
 
-	} else if user.Role == "admin" {
+	} else {
 		// admin
 
-		res := config.DB.Preload("BookInventory").Where("issue_approver_id = ?", user.ID).Find(&registry)
+		res := tenant.DB(c).Preload("BookInventory").Find(&registry)
 		if res.Error != nil {
 			c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "error retrieving registry"})
 			return
@@ -0,0 +1,75 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"project/libraryManagement/models"
+	"project/libraryManagement/outbox"
+	"project/libraryManagement/tenant"
+
+	"github.com/gin-gonic/gin"
+)
+
+// map outbox errors to the matching http status
+func outboxErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, outbox.ErrMessageNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, outbox.ErrNotRetryable), errors.Is(err, outbox.ErrNotCancellable):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// list the notifications of the library, optionally filtered by ?status=
+func RetrieveNotifications(c *gin.Context) {
+	var messages []models.OutboxMessage
+
+	query := tenant.DB(c).Order("id desc").Limit(200)
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	res := query.Find(&messages)
+	if res.Error != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "error retrieving notifications"})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"message": "notifications retrieved successfully", "notifications": messages})
+}
+
+// queue a failed or cancelled notification again
+func RetryNotification(c *gin.Context) {
+	id, ok := uintParam(c, "id")
+	if !ok {
+		return
+	}
+
+	msg, err := outbox.Retry(tenant.DB(c), id)
+	if err != nil {
+		c.IndentedJSON(outboxErrorStatus(err), gin.H{"message": err.Error()})
+		return
+	}
+
+	outbox.Flush(tenant.DB(c), msg)
+
+	c.IndentedJSON(http.StatusOK, gin.H{"message": "notification queued again", "notification": msg})
+}
+
+// stop a pending or failed notification from being delivered
+func CancelNotification(c *gin.Context) {
+	id, ok := uintParam(c, "id")
+	if !ok {
+		return
+	}
+
+	msg, err := outbox.Cancel(tenant.DB(c), id)
+	if err != nil {
+		c.IndentedJSON(outboxErrorStatus(err), gin.H{"message": err.Error()})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"message": "notification cancelled", "notification": msg})
+}
@@ -0,0 +1,158 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"project/libraryManagement/circulation"
+	"project/libraryManagement/models"
+	"project/libraryManagement/tenant"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type LoanPolicyStruct struct {
+	PatronCategory  string `json:"patronCategory"`
+	BookCategory    string `json:"bookCategory"`
+	LoanPeriodDays  *uint  `json:"loanPeriodDays"`
+	MaxLoans        *uint  `json:"maxLoans"`
+	MaxRenewals     *uint  `json:"maxRenewals"`
+	RenewalApproval *bool  `json:"renewalApproval"`
+	GracePeriodDays *uint  `json:"gracePeriodDays"`
+	FinePerDay      *uint  `json:"finePerDay"`
+	MaxBalance      *uint  `json:"maxBalance"`
+}
+type PatronCategoryStruct struct {
+	PatronCategory string `json:"patronCategory"`
+}
+
+// retrieve the loan policies of the library
+func RetrievePolicies(c *gin.Context) {
+	var policies []models.LoanPolicy
+
+	res := tenant.DB(c).Order("patron_category, book_category").Find(&policies)
+	if res.Error != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "error retrieving policies"})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"message": "policies retrieved successfully", "default": circulation.DefaultPolicy, "policies": policies})
+}
+
+// create or replace the policy of a patron and book category, blank categories for the library default
+func SavePolicy(c *gin.Context) {
+	var data LoanPolicyStruct
+	var policy models.LoanPolicy
+
+	err := c.ShouldBind(&data)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if data.LoanPeriodDays != nil && *data.LoanPeriodDays == 0 {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "loan period must be at least one day"})
+		return
+	}
+	if data.MaxLoans != nil && *data.MaxLoans == 0 {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "readers must be allowed at least one loan"})
+		return
+	}
+
+	patronCategory := circulation.NormalizeCategory(data.PatronCategory)
+	bookCategory := circulation.NormalizeCategory(data.BookCategory)
+
+	res := tenant.DB(c).Where("patron_category = ? AND book_category = ?", patronCategory, bookCategory).First(&policy)
+	if res.Error != nil && !errors.Is(res.Error, gorm.ErrRecordNotFound) {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "error finding the policy"})
+		return
+	}
+
+	policy.PatronCategory = patronCategory
+	policy.BookCategory = bookCategory
+	policy.LoanPeriodDays = data.LoanPeriodDays
+	policy.MaxLoans = data.MaxLoans
+	policy.MaxRenewals = data.MaxRenewals
+	policy.RenewalApproval = data.RenewalApproval
+	policy.GracePeriodDays = data.GracePeriodDays
+	policy.FinePerDay = data.FinePerDay
+	policy.MaxBalance = data.MaxBalance
+
+	res = tenant.DB(c).Save(&policy)
+	if res.Error != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "error saving the policy"})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"message": "policy saved successfully", "policy": policy})
+}
+
+// delete a policy, its scope falls back to the less specific policies
+func DeletePolicy(c *gin.Context) {
+	var policy models.LoanPolicy
+
+	id, ok := uintParam(c, "id")
+	if !ok {
+		return
+	}
+
+	res := tenant.DB(c).Where("id = ?", id).First(&policy)
+	if res.Error != nil {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"message": "policy does not exists"})
+		return
+	}
+
+	res = tenant.DB(c).Delete(&policy)
+	if res.Error != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "error deleting the policy"})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"message": "policy deleted successfully"})
+}
+
+// resolve the rules that apply to a patron and book category
+func RetrieveEffectivePolicy(c *gin.Context) {
+	owner, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	policy, err := circulation.ResolvePolicy(tenant.DB(c), owner.LibID, c.Query("patronCategory"), c.Query("bookCategory"))
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "error resolving the policy"})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"message": "policy resolved successfully", "policy": policy})
+}
+
+// set the patron category of a reader, used to pick their loan policy
+func UpdatePatronCategory(c *gin.Context) {
+	var data PatronCategoryStruct
+
+	err := c.ShouldBind(&data)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	admin, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	reader, ok := findReader(c, admin.LibID)
+	if !ok {
+		return
+	}
+
+	reader.PatronCategory = circulation.NormalizeCategory(data.PatronCategory)
+	res := tenant.DB(c).Model(reader).Update("patron_category", reader.PatronCategory)
+	if res.Error != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "error updating the reader"})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"message": "reader updated successfully", "user": reader})
+}
@@ -0,0 +1,143 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"project/libraryManagement/models"
+	"project/libraryManagement/templates"
+	"project/libraryManagement/tenant"
+
+	"github.com/gin-gonic/gin"
+)
+
+type EmailTemplateStruct struct {
+	Subject string `json:"subject"`
+	Text    string `json:"text"`
+	HTML    string `json:"html"`
+}
+type BrandingStruct struct {
+	LogoURL string `json:"logoUrl"`
+}
+
+// map template errors to the matching http status
+func templateErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, templates.ErrUnknownTemplate):
+		return http.StatusNotFound
+	case errors.Is(err, templates.ErrInvalidTemplate):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// list the email templates with the library's overrides
+func RetrieveTemplates(c *gin.Context) {
+	var overrides []models.EmailTemplate
+
+	res := tenant.DB(c).Find(&overrides)
+	if res.Error != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "error retrieving templates"})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"message": "templates retrieved successfully", "names": templates.Names(), "overrides": overrides})
+}
+
+// override the subject, text and/or html of a template for the library
+func SaveTemplate(c *gin.Context) {
+	var data EmailTemplateStruct
+	var override models.EmailTemplate
+
+	err := c.ShouldBind(&data)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	name := c.Param("name")
+
+	tenant.DB(c).Where("name = ?", name).Limit(1).Find(&override)
+	override.Name = name
+	override.Subject = data.Subject
+	override.Text = data.Text
+	override.HTML = data.HTML
+
+	if e := templates.Validate(name, override); e != nil {
+		c.IndentedJSON(templateErrorStatus(e), gin.H{"message": e.Error()})
+		return
+	}
+
+	res := tenant.DB(c).Save(&override)
+	if res.Error != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "error saving the template"})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"message": "template saved successfully", "template": override})
+}
+
+// drop the library's override of a template
+func DeleteTemplate(c *gin.Context) {
+	res := tenant.DB(c).Where("name = ?", c.Param("name")).Delete(&models.EmailTemplate{})
+	if res.Error != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "error deleting the template"})
+		return
+	}
+	if res.RowsAffected == 0 {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"message": "template is not overridden"})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"message": "template reset to the default"})
+}
+
+// render a template with sample data, ?format=html returns the html page itself
+func PreviewTemplate(c *gin.Context) {
+	owner, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	name := c.Param("name")
+
+	rendered, err := templates.Render(tenant.DB(c), owner.LibID, name, templates.Sample(name))
+	if err != nil {
+		c.IndentedJSON(templateErrorStatus(err), gin.H{"message": err.Error()})
+		return
+	}
+
+	if c.Query("format") == "html" {
+		c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(rendered.HTML))
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"message": "template rendered successfully", "preview": rendered})
+}
+
+// set the logo shown in the library's emails
+func UpdateBranding(c *gin.Context) {
+	var data BrandingStruct
+
+	err := c.ShouldBind(&data)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	owner, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	library := owner.Library
+	library.LogoURL = data.LogoURL
+
+	res := tenant.DB(c).Model(&library).Update("logo_url", library.LogoURL)
+	if res.Error != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "error updating the library"})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"message": "library updated successfully", "library": library})
+}
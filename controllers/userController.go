@@ -1,13 +1,17 @@
 package controllers
 
 import (
-	"fmt"
+	"errors"
 	"net/http"
+	"project/libraryManagement/cards"
 	"project/libraryManagement/config"
 	"project/libraryManagement/models"
+	"project/libraryManagement/outbox"
+	"project/libraryManagement/templates"
 	"project/libraryManagement/utils"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 
@@ -16,6 +20,30 @@ type UserOnBoard struct {
 }
 
 
+// create a user and queue their welcome mail in one transaction
+func onboardUser(user *models.Users, template string) (*models.OutboxMessage, error) {
+	var mail *models.OutboxMessage
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		// readers get a library card to borrow at the desk
+		if user.Role == "reader" {
+			if err := cards.Assign(tx, user); err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Create(user).Error; err != nil {
+			return err
+		}
+
+		var err error
+		mail, err = outbox.EnqueueTemplate(tx, user.LibID, user.Email, template, nil)
+		return err
+	})
+
+	return mail, err
+}
+
 // onboard Admin
 func OnboardAdmin(c *gin.Context) {
 	var data UserOnBoard
@@ -32,16 +60,8 @@ func OnboardAdmin(c *gin.Context) {
 		return
 	}
 
-	value, ok := c.Get("email")
-
+	owner, ok := currentUser(c)
 	if !ok {
-		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "missing email in the context"})
-		return
-	}
-
-	owner, e := utils.FindUser(value)
-	if e != nil {
-		c.IndentedJSON(http.StatusNotFound, gin.H{"message": "user not found"})
 		return
 	}
 
@@ -61,20 +81,13 @@ func OnboardAdmin(c *gin.Context) {
 
 	user := models.Users{Email: data.User, Role: "admin", LibID: owner.LibID, Library: owner.Library}
 
-	res := config.DB.Create(&user)
-	if res.Error != nil {
+	// create the admin and queue the mail together
+	mail, err := onboardUser(&user, templates.AdminOnboarding)
+	if err != nil {
 		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "error onboading user"})
-	}
-
-	// message to be sent to the onboarded admin
-	message := fmt.Sprintf("Congratulations, you have been onboarded to Our Library Management System as an Admin. You are assigned to %s Library where you will be working as an Admin and onboarding readers. Please login and start managing the inventory.", owner.Library.Name)
-
-	// trigger mail to the admin
-	mail := utils.SendMail(user.Email, message, "Admin Onboarding")
-	if mail != nil {
-		c.IndentedJSON(http.StatusBadGateway, gin.H{"message": "error sending email"})
 		return
 	}
+	outbox.Flush(config.DB, mail)
 
 	c.IndentedJSON(http.StatusOK, gin.H{"message": "Admin onboarded successfully", "user": user})
 
@@ -91,16 +104,8 @@ func OnboardReader(c *gin.Context) {
 	}
 
 
-	value, ok := c.Get("email")
-
+	owner, ok := currentUser(c)
 	if !ok {
-		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "missing email in the context"})
-		return
-	}
-
-	owner, e := utils.FindUser(value)
-	if e != nil {
-		c.IndentedJSON(http.StatusNotFound, gin.H{"message": "user not found"})
 		return
 	}
 
@@ -113,20 +118,17 @@ func OnboardReader(c *gin.Context) {
 
 	user := models.Users{Email: data.User, Role: "reader", LibID: owner.LibID, Library: owner.Library}
 
-	res := config.DB.Create(&user)
-	if res.Error != nil {
-		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "error onboading user"})
+	// create the reader and queue the mail together
+	mail, err := onboardUser(&user, templates.ReaderOnboarding)
+	if errors.Is(err, cards.ErrCardNumbersExhausted) {
+		c.IndentedJSON(http.StatusServiceUnavailable, gin.H{"message": err.Error()})
+		return
 	}
-
-	// message to be sent to the onboarded reader
-	message := fmt.Sprintf("Congratulations, you have been onboarded to Our Library Management System as a Reader. You are assigned to %s Library where you can explore and read books. Login to enjoy unlimited reading.", owner.Library.Name)
-
-	// trigger mail to the reader
-	mail := utils.SendMail(user.Email, message, "Reader Onboarding")
-	if mail != nil {
-		c.IndentedJSON(http.StatusBadGateway, gin.H{"message": "error sending email"})
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "error onboading user"})
 		return
 	}
+	outbox.Flush(config.DB, mail)
 
 	c.IndentedJSON(http.StatusOK, gin.H{"message": "Reader onboarded successfully", "user": user})
 }
@@ -135,16 +137,8 @@ func OnboardReader(c *gin.Context) {
 func RetrieveAdminByLib(c *gin.Context) {
 	var user []models.Users
 
-	value, ok := c.Get("email")
-
+	owner, ok := currentUser(c)
 	if !ok {
-		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "missing email in the context"})
-		return
-	}
-
-	owner, e := utils.FindUser(value)
-	if e != nil {
-		c.IndentedJSON(http.StatusNotFound, gin.H{"message": "user not found"})
 		return
 	}
 
@@ -163,16 +157,8 @@ func RetrieveAdminByLib(c *gin.Context) {
 func RetrieveReaders(c *gin.Context){
 	var users []models.Users
 
-	value, ok := c.Get("email")
-
+	owner, ok := currentUser(c)
 	if !ok {
-		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "missing email in the context"})
-		return
-	}
-
-	owner, e := utils.FindUser(value)
-	if e != nil {
-		c.IndentedJSON(http.StatusNotFound, gin.H{"message": "user not found"})
 		return
 	}
 
@@ -183,4 +169,28 @@ func RetrieveReaders(c *gin.Context){
 	}
 
 	c.IndentedJSON(http.StatusOK, gin.H{"message": "users found", "list": users})
-}
\ No newline at end of file
+}
+
+// revoke every session of an admin of the owner's library
+func RevokeAdminSessions(c *gin.Context) {
+	var admin models.Users
+
+	owner, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	res := config.DB.Where("id = ? AND lib_id = ? AND role = ?", c.Param("id"), owner.LibID, "admin").First(&admin)
+	if res.Error != nil {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"message": "admin not found"})
+		return
+	}
+
+	err := utils.RevokeAllSessions(admin.ID)
+	if err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"message": "error revoking sessions"})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"message": "admin logged out of all devices"})
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"net/http"
+	"project/libraryManagement/config"
+	"project/libraryManagement/labels"
+	"project/libraryManagement/models"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeskScansCardAndCopy(t *testing.T) {
+	f := setupTenants(t)
+
+	var reader, otherReader models.Users
+	config.DB.Where("email = ?", "reader@own.test").First(&reader)
+	config.DB.Where("email = ?", "reader@other.test").First(&otherReader)
+
+	var item models.BookCopy
+	config.DB.Where("book_id = ?", f.ownBook.ID).First(&item)
+
+	// the qr code of the copy can be scanned instead of its barcode
+	w := f.do("POST", "/admin/desk/checkout", f.adminToken, gin.H{"card": reader.CardNumber, "code": labels.ItemURL(item.LibID, item.ID)})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var registry models.IssueRegistery
+	assert.NoError(t, config.DB.Where("copy_id = ? AND issue_status = ?", item.ID, "issued").First(&registry).Error)
+	assert.Equal(t, reader.ID, registry.ReaderID)
+
+	// cards of another library or with a wrong check digit are refused
+	w = f.do("POST", "/admin/desk/checkout", f.adminToken, gin.H{"card": otherReader.CardNumber, "code": item.Barcode})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = f.do("POST", "/admin/desk/checkout", f.adminToken, gin.H{"card": reader.CardNumber[:11] + "x", "code": item.Barcode})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// copies of another library are unknown
+	var otherItem models.BookCopy
+	config.DB.Where("book_id = ?", f.otherBook.ID).First(&otherItem)
+	w = f.do("POST", "/admin/desk/checkin", f.adminToken, gin.H{"code": labels.ItemURL(otherItem.LibID, otherItem.ID)})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = f.do("POST", "/admin/desk/checkin", f.adminToken, gin.H{"code": item.Barcode})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = f.do("POST", "/admin/desk/checkin", f.adminToken, gin.H{"code": item.Barcode})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// readers can't use the desk
+	w = f.do("POST", "/admin/desk/checkin", f.readerToken, gin.H{"code": item.Barcode})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
@@ -0,0 +1,372 @@
+package export
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"project/libraryManagement/marc"
+	"project/libraryManagement/models"
+	"project/libraryManagement/search"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// books read and written at a time, the export never holds more
+const batchSize = 500
+
+// export formats
+const (
+	FormatCSV     = "csv"
+	FormatJSON    = "jsonl"
+	FormatMARCXML = "marcxml"
+)
+
+var (
+	ErrUnknownFormat = errors.New("format must be csv, jsonl or marcxml")
+	ErrLoansFormat   = errors.New("loans are exported as csv or jsonl")
+)
+
+// content type and file extension of a format
+func ContentType(format string) (string, string, error) {
+	switch format {
+	case FormatCSV:
+		return "text/csv; charset=utf-8", "csv", nil
+	case FormatJSON:
+		return "application/x-ndjson", "jsonl", nil
+	case FormatMARCXML:
+		return "application/marcxml+xml", "xml", nil
+	default:
+		return "", "", ErrUnknownFormat
+	}
+}
+
+// a copy as exported
+type Copy struct {
+	ID              uint       `json:"id"`
+	Barcode         string     `json:"barcode"`
+	AccessionNumber uint       `json:"accessionNumber"`
+	Status          string     `json:"status"`
+	Condition       string     `json:"condition"`
+	AcquisitionDate *time.Time `json:"acquisitionDate"`
+	Price           uint       `json:"price"`
+}
+
+// a book as exported, with the fields POST /admin/import reads back
+type Book struct {
+	ID              uint     `json:"id"`
+	ISBN            string   `json:"isbn"`
+	Title           string   `json:"title"`
+	Authors         []string `json:"authors"`
+	Subjects        []string `json:"subjects"`
+	Publisher       string   `json:"publisher"`
+	Version         string   `json:"version"`
+	Category        string   `json:"category"`
+	CallNumber      string   `json:"callNumber"`
+	Language        string   `json:"language"`
+	Year            uint     `json:"year"`
+	TotalCopies     uint     `json:"totalCopies"`
+	AvailableCopies uint     `json:"availableCopies"`
+	TimesBorrowed   uint     `json:"timesBorrowed"`
+	Copies          []Copy   `json:"copies,omitempty"`
+}
+
+// a loan as exported, readers are only given by id
+type Loan struct {
+	ID                 uint       `json:"id"`
+	BookID             uint       `json:"bookId"`
+	ISBN               string     `json:"isbn"`
+	Title              string     `json:"title"`
+	CopyID             uint       `json:"copyId"`
+	Barcode            string     `json:"barcode"`
+	ReaderID           uint       `json:"readerId"`
+	Status             string     `json:"status"`
+	IssueDate          time.Time  `json:"issueDate"`
+	ExpectedReturnDate time.Time  `json:"expectedReturnDate"`
+	ReturnDate         *time.Time `json:"returnDate"`
+	RenewalCount       uint       `json:"renewalCount"`
+	Fine               uint       `json:"fine"`
+}
+
+func bookOf(book models.BookInventory) Book {
+	return Book{ID: book.ID, ISBN: book.ISBN, Title: book.Title, Authors: nonNil(book.Authors), Subjects: nonNil(book.Subjects), Publisher: book.Publisher,
+		Version: book.Version, Category: book.Category, CallNumber: book.CallNumber, Language: book.Language, Year: book.Year,
+		TotalCopies: book.TotalCopies, AvailableCopies: book.AvailableCopies, TimesBorrowed: book.TimesBorrowed}
+}
+
+func copyOf(item models.BookCopy) Copy {
+	return Copy{ID: item.ID, Barcode: item.Barcode, AccessionNumber: item.AccessionNumber, Status: item.Status, Condition: item.Condition,
+		AcquisitionDate: item.AcquisitionDate, Price: item.Price}
+}
+
+// empty lists are exported as [] rather than null
+func nonNil(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+
+	return values
+}
+
+// a number in csv
+func number(n uint) string {
+	return strconv.FormatUint(uint64(n), 10)
+}
+
+// a date in csv, empty when unset
+func date(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+
+	return t.Format(time.RFC3339)
+}
+
+// the output buffered, sent to the client after every batch
+type output struct {
+	*bufio.Writer
+	w io.Writer
+}
+
+func newOutput(w io.Writer) *output {
+	return &output{Writer: bufio.NewWriter(w), w: w}
+}
+
+func (o *output) flush() error {
+	if err := o.Writer.Flush(); err != nil {
+		return err
+	}
+	if flusher, ok := o.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+
+	return nil
+}
+
+// the copies of the books, by book
+func copiesOf(db *gorm.DB, books []models.BookInventory) (map[uint][]models.BookCopy, error) {
+	var copies []models.BookCopy
+
+	ids := make([]uint, len(books))
+	for i, book := range books {
+		ids[i] = book.ID
+	}
+
+	if err := db.Where("book_id IN ?", ids).Order("book_id, accession_number").Find(&copies).Error; err != nil {
+		return nil, err
+	}
+
+	byBook := map[uint][]models.BookCopy{}
+	for _, item := range copies {
+		byBook[item.BookID] = append(byBook[item.BookID], item)
+	}
+
+	return byBook, nil
+}
+
+// csv columns of the books, and of the copies when they are exported
+var (
+	bookColumns = []string{"id", "isbn", "title", "authors", "subjects", "publisher", "version", "category", "callNumber", "language", "year", "totalCopies", "availableCopies", "timesBorrowed"}
+	copyColumns = []string{"copyId", "barcode", "accessionNumber", "status", "condition", "acquisitionDate", "price"}
+	loanColumns = []string{"id", "bookId", "isbn", "title", "copyId", "barcode", "readerId", "status", "issueDate", "expectedReturnDate", "returnDate", "renewalCount", "fine"}
+)
+
+func bookRow(book Book) []string {
+	return []string{number(book.ID), book.ISBN, book.Title, strings.Join(book.Authors, "; "), strings.Join(book.Subjects, "; "), book.Publisher, book.Version,
+		book.Category, book.CallNumber, book.Language, number(book.Year), number(book.TotalCopies), number(book.AvailableCopies), number(book.TimesBorrowed)}
+}
+
+func copyRow(item Copy) []string {
+	return []string{number(item.ID), item.Barcode, number(item.AccessionNumber), item.Status, item.Condition, date(item.AcquisitionDate), number(item.Price)}
+}
+
+// stream the books of the library matching the query, db has to be scoped to the library.
+// With copies a csv has a line per copy, json lines nest them under their book and marcxml adds them as items (876)
+func Catalog(w io.Writer, db *gorm.DB, format string, query search.Query, withCopies bool) error {
+	out := newOutput(w)
+
+	// write a book, then at the end of every batch flush what the format buffers, and close the document at the end
+	var write func(book models.BookInventory, copies []models.BookCopy) error
+	flush := func() error { return nil }
+	finish := func() error { return nil }
+
+	switch format {
+	case FormatCSV:
+		writer := csv.NewWriter(out)
+		header := bookColumns
+		if withCopies {
+			header = append(append([]string{}, bookColumns...), copyColumns...)
+		}
+		if err := writer.Write(header); err != nil {
+			return err
+		}
+
+		write = func(book models.BookInventory, copies []models.BookCopy) error {
+			row := bookRow(bookOf(book))
+			if !withCopies {
+				return writer.Write(row)
+			}
+
+			// a book without copies still has its line
+			if len(copies) == 0 {
+				return writer.Write(append(row, make([]string, len(copyColumns))...))
+			}
+			for _, item := range copies {
+				if err := writer.Write(append(append([]string{}, row...), copyRow(copyOf(item))...)); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		flush = func() error {
+			writer.Flush()
+			return writer.Error()
+		}
+		finish = flush
+	case FormatJSON:
+		encoder := json.NewEncoder(out)
+		write = func(book models.BookInventory, copies []models.BookCopy) error {
+			exported := bookOf(book)
+			if withCopies {
+				exported.Copies = []Copy{}
+				for _, item := range copies {
+					exported.Copies = append(exported.Copies, copyOf(item))
+				}
+			}
+			return encoder.Encode(exported)
+		}
+	case FormatMARCXML:
+		writer := marc.NewXMLWriter(out)
+		write = func(book models.BookInventory, copies []models.BookCopy) error {
+			return writer.Write(marc.FromBook(book, copies))
+		}
+		finish = writer.Close
+	default:
+		return ErrUnknownFormat
+	}
+
+	err := search.Each(db, query, batchSize, func(books []models.BookInventory) error {
+		copies := map[uint][]models.BookCopy{}
+		if withCopies {
+			var err error
+			if copies, err = copiesOf(db, books); err != nil {
+				return err
+			}
+		}
+
+		for _, book := range books {
+			if err := write(book, copies[book.ID]); err != nil {
+				return err
+			}
+		}
+
+		if err := flush(); err != nil {
+			return err
+		}
+		return out.flush()
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := finish(); err != nil {
+		return err
+	}
+	return out.flush()
+}
+
+// stream the loans of the books matching the query, issued between from and to when given
+func Loans(w io.Writer, db *gorm.DB, format string, query search.Query, from *time.Time, to *time.Time) error {
+	out := newOutput(w)
+
+	var write func(loan Loan) error
+	flush := func() error { return nil }
+
+	switch format {
+	case FormatCSV:
+		writer := csv.NewWriter(out)
+		if err := writer.Write(loanColumns); err != nil {
+			return err
+		}
+
+		write = func(loan Loan) error {
+			return writer.Write([]string{number(loan.ID), number(loan.BookID), loan.ISBN, loan.Title, number(loan.CopyID), loan.Barcode, number(loan.ReaderID), loan.Status,
+				date(&loan.IssueDate), date(&loan.ExpectedReturnDate), date(loan.ReturnDate), number(loan.RenewalCount), number(loan.Fine)})
+		}
+		flush = func() error {
+			writer.Flush()
+			return writer.Error()
+		}
+	case FormatJSON:
+		encoder := json.NewEncoder(out)
+		write = func(loan Loan) error { return encoder.Encode(loan) }
+	case FormatMARCXML:
+		return ErrLoansFormat
+	default:
+		return ErrUnknownFormat
+	}
+
+	err := search.Each(db, query, batchSize, func(books []models.BookInventory) error {
+		var loans []models.IssueRegistery
+
+		byID := map[uint]models.BookInventory{}
+		ids := make([]uint, len(books))
+		for i, book := range books {
+			byID[book.ID], ids[i] = book, book.ID
+		}
+
+		tx := db.Where("book_id IN ?", ids)
+		if from != nil {
+			tx = tx.Where("issue_date >= ?", *from)
+		}
+		if to != nil {
+			tx = tx.Where("issue_date < ?", *to)
+		}
+
+		// popular books have many loans, they are read in batches as well
+		return tx.FindInBatches(&loans, batchSize, func(*gorm.DB, int) error {
+			var copies []models.BookCopy
+
+			copyIDs := make([]uint, len(loans))
+			for i, loan := range loans {
+				copyIDs[i] = loan.CopyID
+			}
+			if err := db.Where("id IN ?", copyIDs).Find(&copies).Error; err != nil {
+				return err
+			}
+
+			barcodes := map[uint]string{}
+			for _, item := range copies {
+				barcodes[item.ID] = item.Barcode
+			}
+
+			for _, loan := range loans {
+				book := byID[loan.BookID]
+				err := write(Loan{ID: loan.IssueID, BookID: loan.BookID, ISBN: book.ISBN, Title: book.Title, CopyID: loan.CopyID, Barcode: barcodes[loan.CopyID],
+					ReaderID: loan.ReaderID, Status: loan.IssueStatus, IssueDate: loan.IssueDate, ExpectedReturnDate: loan.ExpectedReturnDate, ReturnDate: loan.ReturnDate,
+					RenewalCount: loan.RenewalCount, Fine: loan.Fine})
+				if err != nil {
+					return err
+				}
+			}
+
+			if err := flush(); err != nil {
+				return err
+			}
+			return out.flush()
+		}).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := flush(); err != nil {
+		return err
+	}
+	return out.flush()
+}
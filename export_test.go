@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"project/libraryManagement/circulation"
+	"project/libraryManagement/config"
+	"project/libraryManagement/models"
+	"project/libraryManagement/tenant"
+	"project/libraryManagement/testutil"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExportCatalog(t *testing.T) {
+	f := setupTenants(t)
+
+	dune := testutil.CreateBook(t, f.ownBook.LibID, "Dune", 1)
+	config.DB.Model(dune).Updates(map[string]interface{}{"isbn": "9780441172719", "authors": models.StringArray{"Frank Herbert"}, "language": "en", "year": 1965})
+
+	// csv by default, the search filters apply
+	w := f.do("GET", "/admin/export/catalog?language=en", f.adminToken, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/csv; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Header().Get("Content-Disposition"), "attachment")
+
+	rows, err := csv.NewReader(strings.NewReader(w.Body.String())).ReadAll()
+	assert.NoError(t, err)
+	assert.Len(t, rows, 2)
+	assert.Equal(t, []string{"id", "isbn", "title", "authors"}, rows[0][:4])
+	assert.Equal(t, []string{"9780441172719", "Dune", "Frank Herbert"}, rows[1][1:4])
+
+	// copies nest under their book in json lines
+	w = f.do("GET", "/admin/export/catalog?format=jsonl&copies=true", f.adminToken, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	type exported struct {
+		Title  string `json:"title"`
+		Copies []struct {
+			Barcode string `json:"barcode"`
+		} `json:"copies"`
+	}
+	var books []exported
+	scanner := bufio.NewScanner(strings.NewReader(w.Body.String()))
+	for scanner.Scan() {
+		var book exported
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &book))
+		books = append(books, book)
+	}
+	assert.Len(t, books, 2)
+	assert.Equal(t, "Own Book", books[0].Title)
+	assert.Len(t, books[0].Copies, 2)
+	assert.Len(t, books[1].Copies, 1)
+
+	w = f.do("GET", "/admin/export/catalog?format=marcxml&query=dune", f.adminToken, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 1, strings.Count(w.Body.String(), "<record>"))
+	assert.Contains(t, w.Body.String(), `<subfield code="a">9780441172719</subfield>`)
+
+	// the other library's books are never exported
+	assert.NotContains(t, w.Body.String(), "Other Book")
+	w = f.do("GET", "/admin/export/catalog?format=jsonl", f.adminToken, nil)
+	assert.NotContains(t, w.Body.String(), "Other Book")
+
+	w = f.do("GET", "/admin/export/catalog?format=xlsx", f.adminToken, nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = f.do("GET", "/admin/export/catalog?yearFrom=2000&yearTo=1990", f.adminToken, nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "application/json; charset=utf-8", w.Header().Get("Content-Type"))
+	w = f.do("GET", "/admin/export/catalog", f.readerToken, nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// a csv export imports into another library
+	w = f.do("GET", "/admin/export/catalog", f.adminToken, nil)
+	other := testutil.CreateUser(t, f.otherBook.LibID, "admin", "admin@other.test")
+	var res importResponse
+	json.Unmarshal(f.upload("/admin/import", testutil.Token(t, other), "catalog.csv", w.Body.String(), nil).Body.Bytes(), &res)
+	assert.Equal(t, []uint{2, 0}, []uint{res.Job.Created, res.Job.Rejected})
+}
+
+func TestExportLoans(t *testing.T) {
+	f := setupTenants(t)
+
+	var admin, reader models.Users
+	config.DB.Where("email = ?", "admin@own.test").First(&admin)
+	config.DB.Where("email = ?", "reader@own.test").First(&reader)
+
+	_, err := circulation.Checkout(tenant.ForLibrary(admin.LibID), reader.ID, "00000001", admin.ID)
+	assert.NoError(t, err)
+
+	w := f.do("GET", "/admin/export/loans?format=jsonl", f.adminToken, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var loan struct {
+		Title    string `json:"title"`
+		Barcode  string `json:"barcode"`
+		ReaderID uint   `json:"readerId"`
+		Status   string `json:"status"`
+	}
+	assert.NoError(t, json.Unmarshal([]byte(strings.TrimSpace(w.Body.String())), &loan))
+	assert.Equal(t, "Own Book", loan.Title)
+	assert.Equal(t, "00000001", loan.Barcode)
+	assert.Equal(t, reader.ID, loan.ReaderID)
+	assert.Equal(t, "issued", loan.Status)
+
+	// loans issued before the range are left out
+	w = f.do("GET", "/admin/export/loans?from=2999-01-01", f.adminToken, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 1, strings.Count(strings.TrimSpace(w.Body.String()), "\n")+1)
+
+	w = f.do("GET", "/admin/export/loans?format=marcxml", f.adminToken, nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = f.do("GET", "/admin/export/loans?from=yesterday", f.adminToken, nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
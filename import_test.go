@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"project/libraryManagement/config"
+	"project/libraryManagement/marc"
+	"project/libraryManagement/models"
+	"project/libraryManagement/testutil"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+// upload a catalog file with the form fields
+func (f *tenantFixture) upload(path string, token string, fileName string, content string, fields map[string]string) *httptest.ResponseRecorder {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	for name, value := range fields {
+		form.WriteField(name, value)
+	}
+	part, _ := form.CreateFormFile("file", fileName)
+	part.Write([]byte(content))
+	form.Close()
+
+	req, _ := http.NewRequest("POST", path, &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	req.Header.Set("Authorization", token)
+
+	w := httptest.NewRecorder()
+	f.router.ServeHTTP(w, req)
+	return w
+}
+
+type importResponse struct {
+	Job  models.ImportJob   `json:"job"`
+	Rows []models.ImportRow `json:"rows"`
+}
+
+func TestImportCatalog(t *testing.T) {
+	f := setupTenants(t)
+
+	file := "title,authors,isbn,copies\n" +
+		"Own Book,,,1\n" +
+		"Dune,Frank Herbert,0441172717,2\n" +
+		",,,1\n"
+
+	var res importResponse
+	w := f.upload("/admin/import", f.adminToken, "catalog.csv", file, map[string]string{"dryRun": "true"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	json.Unmarshal(w.Body.Bytes(), &res)
+	assert.True(t, res.Job.DryRun)
+	assert.Equal(t, []uint{1, 1, 1}, []uint{res.Job.Created, res.Job.Updated, res.Job.Rejected})
+	assert.Equal(t, uint(4), res.Rows[2].Line)
+
+	var books int64
+	config.DB.Model(&models.BookInventory{}).Where("lib_id = ?", f.ownBook.LibID).Count(&books)
+	assert.Equal(t, int64(1), books)
+
+	w = f.upload("/admin/import", f.adminToken, "catalog.csv", file, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	json.Unmarshal(w.Body.Bytes(), &res)
+	assert.Equal(t, "finished", res.Job.Status)
+	assert.Equal(t, f.ownBook.ID, res.Rows[0].BookID)
+	assert.Len(t, res.Rows[1].Barcodes, 2)
+
+	var ownBook models.BookInventory
+	config.DB.First(&ownBook, f.ownBook.ID)
+	assert.Equal(t, uint(3), ownBook.TotalCopies)
+
+	// the reader and the other library can't import or see the import
+	w = f.upload("/admin/import", f.readerToken, "catalog.csv", file, nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	other := testutil.CreateUser(t, f.otherBook.LibID, "admin", "admin@other.test")
+	w = f.do("GET", fmt.Sprintf("/admin/import/%d", res.Job.ID), testutil.Token(t, other), nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = f.upload("/admin/import", f.adminToken, "catalog.xlsx", file, nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestFailedImportIsMarkedFailed(t *testing.T) {
+	f := setupTenants(t)
+
+	// the report of the lines can't be saved
+	config.DB.Callback().Create().Before("gorm:create").Register("test:fail", func(tx *gorm.DB) {
+		if tx.Statement.Table == "import_rows" {
+			tx.AddError(errors.New("out of disk"))
+		}
+	})
+
+	var res importResponse
+	w := f.upload("/admin/import", f.adminToken, "catalog.csv", "title,copies\nDune,1\n", nil)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	json.Unmarshal(w.Body.Bytes(), &res)
+	assert.Equal(t, "failed", res.Job.Status)
+
+	// the job isn't left running
+	var job models.ImportJob
+	config.DB.First(&job, res.Job.ID)
+	assert.Equal(t, "failed", job.Status)
+	assert.Equal(t, "out of disk", job.Error)
+	assert.NotNil(t, job.FinishedAt)
+}
+
+func TestImportLargeFileInTheBackground(t *testing.T) {
+	f := setupTenants(t)
+	t.Setenv("IMPORT_SYNC_ROWS", "2")
+
+	file := `{"title": "Dune", "authors": ["Frank Herbert"], "copies": 1}
+{"title": "Emma", "authors": "Jane Austen", "copies": 2}
+{"title": "Ulysses", "isbn": "not an isbn"}
+`
+
+	var res importResponse
+	w := f.upload("/admin/import", f.adminToken, "catalog.jsonl", file, nil)
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	json.Unmarshal(w.Body.Bytes(), &res)
+	assert.Equal(t, uint(3), res.Job.Total)
+
+	// poll the job until it is done
+	path := fmt.Sprintf("/admin/import/%d", res.Job.ID)
+	deadline := time.Now().Add(10 * time.Second)
+	for res.Job.Status != "finished" && time.Now().Before(deadline) {
+		time.Sleep(20 * time.Millisecond)
+		w = f.do("GET", path, f.adminToken, nil)
+		json.Unmarshal(w.Body.Bytes(), &res)
+	}
+
+	assert.Equal(t, "finished", res.Job.Status)
+	assert.Equal(t, uint(3), res.Job.Processed)
+	assert.Len(t, res.Rows, 3)
+
+	w = f.do("GET", path+"?status=rejected", f.adminToken, nil)
+	json.Unmarshal(w.Body.Bytes(), &res)
+	assert.Len(t, res.Rows, 1)
+	assert.Equal(t, uint(3), res.Rows[0].Line)
+
+	w = f.do("GET", "/admin/imports", f.adminToken, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestImportMARC(t *testing.T) {
+	f := setupTenants(t)
+
+	record := marc.Record{Leader: "00000cam a2200000 a 4500"}
+	record.AddControl("001", "ocm00123456")
+	record.AddControl("008", "650101s1965    pau           000 1 eng d")
+	record.AddField("020", "  ", marc.Subfield{Code: "a", Value: "0441172717 (pbk.)"})
+	record.AddField("035", "  ", marc.Subfield{Code: "a", Value: "(OCoLC)123456"})
+	record.AddField("100", "1 ", marc.Subfield{Code: "a", Value: "Herbert, Frank."})
+	record.AddField("245", "10", marc.Subfield{Code: "a", Value: "Dune /"}, marc.Subfield{Code: "c", Value: "Frank Herbert."})
+	record.AddField("250", "  ", marc.Subfield{Code: "a", Value: "1st ed."})
+	record.AddField("260", "  ", marc.Subfield{Code: "b", Value: "Chilton Books,"}, marc.Subfield{Code: "c", Value: "c1965."})
+	record.AddField("650", " 0", marc.Subfield{Code: "a", Value: "Science fiction."})
+	data, _ := record.MarshalBinary()
+
+	var res importResponse
+	w := f.upload("/admin/import", f.adminToken, "legacy.mrc", string(data), nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	json.Unmarshal(w.Body.Bytes(), &res)
+	assert.Equal(t, "marc", res.Job.Format)
+	assert.Equal(t, uint(1), res.Job.Created)
+	assert.Equal(t, models.StringArray{"001 (1)", "035 (1)"}, res.Job.Unmapped)
+	assert.Equal(t, models.StringArray{"001", "035"}, res.Rows[0].Unmapped)
+
+	var book models.BookInventory
+	config.DB.First(&book, res.Rows[0].BookID)
+	assert.Equal(t, "9780441172719", book.ISBN)
+	assert.Equal(t, "Dune", book.Title)
+	assert.Equal(t, models.StringArray{"Herbert, Frank"}, book.Authors)
+	assert.Equal(t, "1st ed.", book.Version)
+	assert.Equal(t, "Chilton Books", book.Publisher)
+	assert.Equal(t, models.StringArray{"Science fiction"}, book.Subjects)
+	assert.Equal(t, uint(1965), book.Year)
+	assert.Equal(t, "en", book.Language)
+	assert.Equal(t, uint(0), book.TotalCopies)
+
+	// a marcxml export of a library imports into another one with its copies
+	w = f.do("GET", "/admin/export/catalog?format=marcxml&copies=true&query=own", f.adminToken, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	other := testutil.CreateUser(t, f.otherBook.LibID, "admin", "admin@other.test")
+	w = f.upload("/admin/import", testutil.Token(t, other), "catalog.xml", w.Body.String(), nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	json.Unmarshal(w.Body.Bytes(), &res)
+	assert.Equal(t, "marcxml", res.Job.Format)
+	assert.Equal(t, uint(1), res.Job.Created)
+	assert.Equal(t, "Own Book", res.Rows[0].Title)
+	assert.Len(t, res.Rows[0].Barcodes, 2)
+
+	w = f.upload("/admin/import", f.adminToken, "broken.xml", "<collection><record>", nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
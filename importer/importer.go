@@ -0,0 +1,232 @@
+package importer
+
+import (
+	"errors"
+	"fmt"
+	"project/libraryManagement/circulation"
+	"project/libraryManagement/isbn"
+	"project/libraryManagement/models"
+	"project/libraryManagement/search"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// the most copies a line may add
+const MaxCopies = 500
+
+// rows imported between two progress updates of a job
+const batchSize = 100
+
+// status of a job
+const (
+	StatusQueued   = "queued"
+	StatusRunning  = "running"
+	StatusFinished = "finished"
+	StatusFailed   = "failed"
+)
+
+// outcome of a line
+const (
+	RowCreated  = "created"
+	RowUpdated  = "updated"
+	RowRejected = "rejected"
+)
+
+var (
+	ErrNoTitle       = errors.New("title is required")
+	ErrTooManyCopies = fmt.Errorf("a line may add at most %d copies", MaxCopies)
+	ErrInterrupted   = errors.New("the import was interrupted by a restart of the server")
+)
+
+// the book a line matches, by isbn when given and by title otherwise, as POST /admin/create/inventory does
+func existingBook(db *gorm.DB, record Record, normalized string) (*models.BookInventory, error) {
+	var book models.BookInventory
+
+	query := db.Where("title = ?", record.Title)
+	if normalized != "" {
+		query = db.Where("isbn = ?", normalized)
+	}
+
+	err := query.First(&book).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &book, nil
+}
+
+// check a line, returning its isbn as isbn-13
+func validate(record Record) (string, error) {
+	if record.Err != nil {
+		return "", record.Err
+	}
+	if record.Title == "" {
+		return "", ErrNoTitle
+	}
+	if record.Copies > MaxCopies {
+		return "", ErrTooManyCopies
+	}
+
+	if record.ISBN == "" {
+		return "", nil
+	}
+
+	normalized, err := isbn.Parse(record.ISBN)
+	if err != nil {
+		return "", fmt.Errorf("invalid isbn: %w", err)
+	}
+
+	return normalized, nil
+}
+
+// import a line: add its copies to the book it matches or create the book, in one transaction.
+// A dry run only checks the line, planned keeps the books earlier lines of the file would create
+func importRecord(db *gorm.DB, job *models.ImportJob, record Record, planned map[string]bool) models.ImportRow {
+	row := models.ImportRow{JobID: job.ID, Line: record.Line, ISBN: record.ISBN, Title: record.Title, Copies: record.Copies, Unmapped: append(models.StringArray{}, record.Unmapped...), LibID: job.LibID}
+
+	normalized, err := validate(record)
+	if err != nil {
+		row.Status, row.Error = RowRejected, err.Error()
+		return row
+	}
+	row.ISBN = normalized
+
+	if job.DryRun {
+		key := "title:" + record.Title
+		if normalized != "" {
+			key = "isbn:" + normalized
+		}
+
+		book, err := existingBook(db, record, normalized)
+		switch {
+		case err != nil:
+			row.Status, row.Error = RowRejected, err.Error()
+		case book != nil:
+			row.Status, row.BookID = RowUpdated, book.ID
+		case planned[key]:
+			row.Status = RowUpdated
+		default:
+			row.Status = RowCreated
+			planned[key] = true
+		}
+		return row
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		book, err := existingBook(tx, record, normalized)
+		if err != nil {
+			return err
+		}
+
+		row.Status = RowUpdated
+		if book == nil {
+			book = &models.BookInventory{ISBN: normalized, Title: record.Title, Authors: record.Authors, Subjects: record.Subjects, Publisher: record.Publisher, Version: record.Version,
+				Category: circulation.NormalizeCategory(record.Category), CallNumber: record.CallNumber, Language: strings.ToLower(strings.TrimSpace(record.Language)), Year: record.Year, LibID: job.LibID}
+			if err := tx.Create(book).Error; err != nil {
+				return err
+			}
+			row.Status = RowCreated
+		}
+		row.BookID = book.ID
+
+		// the new copies go to the readers waiting for the book first, each gets its barcode and qr code
+		row.Barcodes = models.StringArray{}
+		if record.Copies > 0 {
+			copies, err := circulation.AddCopies(tx, book.ID, record.Copies, circulation.CopyDetails{})
+			if err != nil {
+				return err
+			}
+			for _, item := range copies {
+				row.Barcodes = append(row.Barcodes, item.Barcode)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		row.Status, row.Error, row.BookID, row.Barcodes = RowRejected, err.Error(), 0, nil
+	}
+
+	return row
+}
+
+// import the lines of a job, saving their outcome and the progress of the job every batch,
+// db has to be scoped to the job's library
+func Run(db *gorm.DB, job *models.ImportJob, records []Record) error {
+	job.Status, job.Total = StatusRunning, uint(len(records))
+	if err := db.Model(job).Updates(map[string]interface{}{"status": job.Status, "total": job.Total}).Error; err != nil {
+		return err
+	}
+
+	planned := map[string]bool{}
+	rows := make([]models.ImportRow, 0, batchSize)
+
+	for i, record := range records {
+		row := importRecord(db, job, record, planned)
+		rows = append(rows, row)
+
+		switch row.Status {
+		case RowCreated:
+			job.Created++
+		case RowUpdated:
+			job.Updated++
+		default:
+			job.Rejected++
+		}
+
+		if len(rows) == batchSize || i == len(records)-1 {
+			if err := db.Create(&rows).Error; err != nil {
+				return err
+			}
+			rows = rows[:0]
+
+			job.Processed = uint(i + 1)
+			if err := db.Model(job).Updates(map[string]interface{}{"processed": job.Processed, "created": job.Created, "updated": job.Updated, "rejected": job.Rejected}).Error; err != nil {
+				return err
+			}
+		}
+	}
+
+	// the new titles are suggested as readers type
+	if !job.DryRun && job.Created > 0 {
+		search.RefreshSuggestions(job.LibID)
+	}
+
+	now := time.Now()
+	job.Status, job.FinishedAt = StatusFinished, &now
+	return db.Model(job).Updates(map[string]interface{}{"status": job.Status, "finished_at": job.FinishedAt}).Error
+}
+
+// run a job in the background on its own copy of the job, a failed job keeps the rows imported before the failure.
+// A panic fails the job instead of taking the server down with it
+func Start(db *gorm.DB, job models.ImportJob, records []Record) {
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				Fail(db, &job, fmt.Errorf("the import stopped unexpectedly: %v", r))
+			}
+		}()
+
+		if err := Run(db, &job, records); err != nil {
+			Fail(db, &job, err)
+		}
+	}()
+}
+
+// mark a job as failed
+func Fail(db *gorm.DB, job *models.ImportJob, err error) {
+	now := time.Now()
+	job.Status, job.Error, job.FinishedAt = StatusFailed, err.Error(), &now
+	db.Model(job).Updates(map[string]interface{}{"status": job.Status, "error": job.Error, "finished_at": job.FinishedAt})
+}
+
+// jobs left running by a stopped server won't finish, they are marked as failed when it starts again
+func Recover(db *gorm.DB) error {
+	return db.Model(&models.ImportJob{}).Where("status IN ?", []string{StatusQueued, StatusRunning}).
+		Updates(map[string]interface{}{"status": StatusFailed, "error": ErrInterrupted.Error(), "finished_at": time.Now()}).Error
+}
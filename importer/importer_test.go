@@ -0,0 +1,123 @@
+package importer
+
+import (
+	"project/libraryManagement/config"
+	"project/libraryManagement/models"
+	"project/libraryManagement/tenant"
+	"project/libraryManagement/testutil"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestRunMergesWithTheCatalog(t *testing.T) {
+	testutil.SetupDB(t)
+
+	library := testutil.CreateLibrary(t, "Library")
+	admin := testutil.CreateUser(t, library.ID, "admin", "admin@library.test")
+	existing := testutil.CreateBook(t, library.ID, "Existing", 1)
+	db := tenant.ForLibrary(library.ID)
+
+	records := []Record{
+		{Line: 2, Title: "Existing", Copies: 2},
+		{Line: 3, Title: "Dune", ISBN: "0-441-17271-7", Authors: []string{"Frank Herbert"}, Copies: 2},
+		{Line: 4, Title: "Dune (reprint)", ISBN: "9780441172719", Copies: 1},
+		{Line: 5, Title: "Broken", ISBN: "12345"},
+		{Line: 6, Copies: 1},
+		{Line: 7, Title: "Too Many", Copies: MaxCopies + 1},
+	}
+	statuses := func(rows []models.ImportRow) []string {
+		out := []string{}
+		for _, row := range rows {
+			out = append(out, row.Status)
+		}
+		return out
+	}
+	expected := []string{RowUpdated, RowCreated, RowUpdated, RowRejected, RowRejected, RowRejected}
+
+	// a dry run reports the same outcome without touching the catalog
+	dry := models.ImportJob{DryRun: true, CreatedByID: admin.ID, LibID: library.ID}
+	config.DB.Create(&dry)
+	assert.NoError(t, Run(db, &dry, records))
+
+	var rows []models.ImportRow
+	config.DB.Where("job_id = ?", dry.ID).Order("id").Find(&rows)
+	assert.Equal(t, expected, statuses(rows))
+	assert.Contains(t, rows[3].Error, "invalid isbn")
+	assert.Equal(t, "12345", rows[3].ISBN)
+	assert.Equal(t, ErrNoTitle.Error(), rows[4].Error)
+
+	var books int64
+	config.DB.Model(&models.BookInventory{}).Count(&books)
+	assert.Equal(t, int64(1), books)
+
+	job := models.ImportJob{CreatedByID: admin.ID, LibID: library.ID}
+	config.DB.Create(&job)
+	assert.NoError(t, Run(db, &job, records))
+	assert.Equal(t, StatusFinished, job.Status)
+	assert.Equal(t, []uint{6, 6, 1, 2, 3}, []uint{job.Total, job.Processed, job.Created, job.Updated, job.Rejected})
+
+	config.DB.Where("job_id = ?", job.ID).Order("id").Find(&rows)
+	assert.Equal(t, expected, statuses(rows))
+	assert.Equal(t, existing.ID, rows[0].BookID)
+	assert.Len(t, rows[0].Barcodes, 2)
+	assert.Equal(t, rows[1].BookID, rows[2].BookID)
+
+	var dune models.BookInventory
+	config.DB.First(&dune, rows[1].BookID)
+	assert.Equal(t, "9780441172719", dune.ISBN)
+	assert.Equal(t, uint(3), dune.TotalCopies)
+	assert.Equal(t, models.StringArray{"Frank Herbert"}, dune.Authors)
+
+	config.DB.First(existing, existing.ID)
+	assert.Equal(t, uint(3), existing.AvailableCopies)
+}
+
+func TestRecoverFailsInterruptedJobs(t *testing.T) {
+	testutil.SetupDB(t)
+
+	library := testutil.CreateLibrary(t, "Library")
+	running := models.ImportJob{Status: StatusRunning, LibID: library.ID}
+	finished := models.ImportJob{Status: StatusFinished, LibID: library.ID}
+	config.DB.Create(&running)
+	config.DB.Create(&finished)
+
+	assert.NoError(t, Recover(config.DB))
+
+	config.DB.First(&running, running.ID)
+	config.DB.First(&finished, finished.ID)
+	assert.Equal(t, StatusFailed, running.Status)
+	assert.Equal(t, ErrInterrupted.Error(), running.Error)
+	assert.Equal(t, StatusFinished, finished.Status)
+}
+
+func TestStartFailsAJobThatPanics(t *testing.T) {
+	testutil.SetupDB(t)
+
+	library := testutil.CreateLibrary(t, "Library")
+	admin := testutil.CreateUser(t, library.ID, "admin", "admin@library.test")
+	db := tenant.ForLibrary(library.ID)
+
+	// looking up the catalog panics
+	config.DB.Callback().Query().Before("gorm:query").Register("test:panic", func(tx *gorm.DB) {
+		if tx.Statement.Table == "book_inventories" {
+			panic("out of disk")
+		}
+	})
+
+	job := models.ImportJob{DryRun: true, CreatedByID: admin.ID, LibID: library.ID}
+	config.DB.Create(&job)
+	Start(db, job, []Record{{Line: 2, Title: "Dune", Copies: 1}})
+
+	deadline := time.Now().Add(10 * time.Second)
+	for job.Status != StatusFailed && time.Now().Before(deadline) {
+		time.Sleep(20 * time.Millisecond)
+		config.DB.First(&job, job.ID)
+	}
+
+	assert.Equal(t, StatusFailed, job.Status)
+	assert.Contains(t, job.Error, "out of disk")
+	assert.NotNil(t, job.FinishedAt)
+}
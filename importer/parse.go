@@ -0,0 +1,361 @@
+package importer
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"project/libraryManagement/marc"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// file formats: comma separated values with a header line, one json object per line, or marc records
+// in iso 2709 or marcxml
+const (
+	FormatCSV     = "csv"
+	FormatJSON    = "jsonl"
+	FormatMARC    = "marc"
+	FormatMARCXML = "marcxml"
+)
+
+// the most books a file may hold
+const MaxRows = 50000
+
+var (
+	ErrUnknownFormat = errors.New("format must be csv, jsonl, marc or marcxml")
+	ErrNoTitleColumn = errors.New("the csv header has no title column")
+	ErrEmpty         = errors.New("the file has no books")
+	ErrTooManyRows   = fmt.Errorf("a file may hold at most %d books", MaxRows)
+)
+
+// a book of the file, Err is set when its line couldn't be read. The line of a marc record is its position
+// in an iso 2709 file and the line it starts at in marcxml, Unmapped holds the tags of the fields the import leaves out
+type Record struct {
+	Line       uint
+	Title      string
+	Authors    []string
+	Subjects   []string
+	Publisher  string
+	Version    string
+	ISBN       string
+	Category   string
+	CallNumber string
+	Language   string
+	Year       uint
+	Copies     uint
+	Unmapped   []string
+	Err        error
+}
+
+// format of a file from its extension, empty when unknown
+func FormatOf(fileName string) string {
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".csv":
+		return FormatCSV
+	case ".jsonl", ".ndjson", ".json":
+		return FormatJSON
+	case ".mrc", ".marc":
+		return FormatMARC
+	case ".xml", ".marcxml":
+		return FormatMARCXML
+	default:
+		return ""
+	}
+}
+
+// books of a csv, json lines or marc file
+func Parse(format string, r io.Reader) ([]Record, error) {
+	var records []Record
+	var err error
+
+	switch format {
+	case FormatCSV:
+		records, err = parseCSV(r)
+	case FormatJSON:
+		records, err = parseJSONLines(r)
+	case FormatMARC:
+		reader := marc.NewReader(r)
+		records, err = parseMARC(reader.Read, func(n uint) uint { return n })
+	case FormatMARCXML:
+		reader := marc.NewXMLReader(r)
+		records, err = parseMARC(reader.Read, func(uint) uint { return uint(reader.Line()) })
+	default:
+		return nil, ErrUnknownFormat
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, ErrEmpty
+	}
+
+	return records, nil
+}
+
+// csv column of a header name, e.g. "Total Copies" and "total_copies" are both the copies
+var columns = map[string]string{
+	"title":       "title",
+	"author":      "authors",
+	"authors":     "authors",
+	"subject":     "subjects",
+	"subjects":    "subjects",
+	"publisher":   "publisher",
+	"version":     "version",
+	"edition":     "version",
+	"isbn":        "isbn",
+	"category":    "category",
+	"callnumber":  "callNumber",
+	"language":    "language",
+	"year":        "year",
+	"copies":      "copies",
+	"totalcopies": "copies",
+}
+
+// several authors or subjects of a cell are separated by semicolons
+func splitList(cell string) []string {
+	values := []string{}
+	for _, value := range strings.Split(cell, ";") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+
+	return values
+}
+
+// the cell as a number, empty cells are 0
+func parseNumber(cell string, column string) (uint, error) {
+	if cell == "" {
+		return 0, nil
+	}
+
+	n, err := strconv.ParseUint(cell, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("%s must be a positive number", column)
+	}
+
+	return uint(n), nil
+}
+
+// the first line names the columns, unknown columns are ignored
+func parseCSV(r io.Reader) ([]Record, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, ErrEmpty
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	index := map[string]int{}
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimPrefix(name, "\ufeff"))
+		name = strings.NewReplacer(" ", "", "_", "", "-", "").Replace(name)
+		if column, ok := columns[name]; ok {
+			index[column] = i
+		}
+	}
+	if _, ok := index["title"]; !ok {
+		return nil, ErrNoTitleColumn
+	}
+
+	records := []Record{}
+	for {
+		fields, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(records) == MaxRows {
+			return nil, ErrTooManyRows
+		}
+
+		cell := func(column string) string {
+			if i, ok := index[column]; ok && i < len(fields) {
+				return strings.TrimSpace(fields[i])
+			}
+			return ""
+		}
+
+		line, _ := reader.FieldPos(0)
+		record := Record{
+			Line:       uint(line),
+			Title:      cell("title"),
+			Authors:    splitList(cell("authors")),
+			Subjects:   splitList(cell("subjects")),
+			Publisher:  cell("publisher"),
+			Version:    cell("version"),
+			ISBN:       cell("isbn"),
+			Category:   cell("category"),
+			CallNumber: cell("callNumber"),
+			Language:   cell("language"),
+		}
+
+		if record.Year, err = parseNumber(cell("year"), "year"); err != nil {
+			record.Err = err
+		}
+		if record.Copies, err = parseNumber(cell("copies"), "copies"); err != nil {
+			record.Err = err
+		}
+
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
+// authors or subjects of a json line, a list or a single name
+type names []string
+
+func (n *names) UnmarshalJSON(data []byte) error {
+	var list []string
+	if err := json.Unmarshal(data, &list); err == nil {
+		*n = list
+		return nil
+	}
+
+	var single string
+	if err := json.Unmarshal(data, &single); err != nil {
+		return errors.New("authors and subjects must be a list of names")
+	}
+	*n = splitList(single)
+	return nil
+}
+
+// a book of a json lines file, with the fields of POST /admin/create/inventory
+type jsonRecord struct {
+	Title       string `json:"title"`
+	Authors     names  `json:"authors"`
+	Subjects    names  `json:"subjects"`
+	Publisher   string `json:"publisher"`
+	Version     string `json:"version"`
+	ISBN        string `json:"isbn"`
+	Category    string `json:"category"`
+	CallNumber  string `json:"callNumber"`
+	Language    string `json:"language"`
+	Year        uint   `json:"year"`
+	Copies      uint   `json:"copies"`
+	TotalCopies uint   `json:"totalCopies"`
+}
+
+// one object per line, blank lines are skipped
+func parseJSONLines(r io.Reader) ([]Record, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	records := []Record{}
+	for line := uint(1); scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		if len(records) == MaxRows {
+			return nil, ErrTooManyRows
+		}
+
+		var book jsonRecord
+		if err := json.Unmarshal([]byte(text), &book); err != nil {
+			records = append(records, Record{Line: line, Err: fmt.Errorf("invalid json: %w", err)})
+			continue
+		}
+
+		copies := book.Copies
+		if copies == 0 {
+			copies = book.TotalCopies
+		}
+
+		records = append(records, Record{
+			Line:       line,
+			Title:      strings.TrimSpace(book.Title),
+			Authors:    book.Authors,
+			Subjects:   book.Subjects,
+			Publisher:  strings.TrimSpace(book.Publisher),
+			Version:    strings.TrimSpace(book.Version),
+			ISBN:       strings.TrimSpace(book.ISBN),
+			Category:   book.Category,
+			CallNumber: strings.TrimSpace(book.CallNumber),
+			Language:   book.Language,
+			Year:       book.Year,
+			Copies:     copies,
+		})
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+// records read one by one, a record that couldn't be read is rejected and the next ones are still imported.
+// line gives the line of the nth record
+func parseMARC(read func() (marc.Record, error), line func(n uint) uint) ([]Record, error) {
+	records := []Record{}
+	for n := uint(1); ; n++ {
+		entry, err := read()
+		if err == io.EOF {
+			break
+		}
+		if len(records) == MaxRows {
+			return nil, ErrTooManyRows
+		}
+		if errors.Is(err, marc.ErrInvalidRecord) {
+			records = append(records, Record{Line: line(n), Err: err})
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		book, copies, unmapped := marc.ToBook(entry)
+		records = append(records, Record{
+			Line:       line(n),
+			Title:      book.Title,
+			Authors:    book.Authors,
+			Subjects:   book.Subjects,
+			Publisher:  book.Publisher,
+			Version:    book.Version,
+			ISBN:       book.ISBN,
+			CallNumber: book.CallNumber,
+			Language:   book.Language,
+			Year:       book.Year,
+			Copies:     copies,
+			Unmapped:   unmapped,
+		})
+	}
+
+	return records, nil
+}
+
+// tags the import left out of any record of the file, with the number of records holding them, e.g. "035 (120)"
+func Unmapped(records []Record) []string {
+	counts := map[string]int{}
+	for _, record := range records {
+		for _, tag := range record.Unmapped {
+			counts[tag]++
+		}
+	}
+
+	tags := make([]string, 0, len(counts))
+	for tag := range counts {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+
+	for i, tag := range tags {
+		tags[i] = fmt.Sprintf("%s (%d)", tag, counts[tag])
+	}
+	return tags
+}
@@ -0,0 +1,107 @@
+package importer
+
+import (
+	"bytes"
+	"project/libraryManagement/marc"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCSV(t *testing.T) {
+	file := "\ufeffTitle,Author,ISBN,Total Copies,Publisher,Shelf\n" +
+		"Dune,Frank Herbert,0-441-17271-7,2,Chilton,A1\n" +
+		"\"Good Omens, Nice and Accurate\",Terry Pratchett; Neil Gaiman,,1\n" +
+		"Emma,Jane Austen,,two\n"
+
+	records, err := Parse(FormatCSV, strings.NewReader(file))
+	assert.NoError(t, err)
+	assert.Len(t, records, 3)
+
+	assert.Equal(t, Record{Line: 2, Title: "Dune", Authors: []string{"Frank Herbert"}, Subjects: []string{}, Publisher: "Chilton", ISBN: "0-441-17271-7", Copies: 2}, records[0])
+	assert.Equal(t, "Good Omens, Nice and Accurate", records[1].Title)
+	assert.Equal(t, []string{"Terry Pratchett", "Neil Gaiman"}, records[1].Authors)
+	assert.Equal(t, uint(4), records[2].Line)
+	assert.EqualError(t, records[2].Err, "copies must be a positive number")
+
+	_, err = Parse(FormatCSV, strings.NewReader("name,isbn\nDune,123\n"))
+	assert.ErrorIs(t, err, ErrNoTitleColumn)
+	_, err = Parse(FormatCSV, strings.NewReader("title,isbn\n"))
+	assert.ErrorIs(t, err, ErrEmpty)
+}
+
+func TestParseJSONLines(t *testing.T) {
+	file := `{"title": "Dune", "authors": ["Frank Herbert"], "isbn": "0441172717", "copies": 2}
+
+{"title": "Emma", "authors": "Jane Austen", "totalCopies": 1, "year": 1815}
+{"title": "Broken"
+`
+
+	records, err := Parse(FormatJSON, strings.NewReader(file))
+	assert.NoError(t, err)
+	assert.Len(t, records, 3)
+
+	assert.Equal(t, Record{Line: 1, Title: "Dune", Authors: []string{"Frank Herbert"}, ISBN: "0441172717", Copies: 2}, records[0])
+	assert.Equal(t, Record{Line: 3, Title: "Emma", Authors: []string{"Jane Austen"}, Year: 1815, Copies: 1}, records[1])
+	assert.Equal(t, uint(4), records[2].Line)
+	assert.Error(t, records[2].Err)
+
+	_, err = Parse("xml", strings.NewReader(file))
+	assert.ErrorIs(t, err, ErrUnknownFormat)
+}
+
+func TestFormatOf(t *testing.T) {
+	assert.Equal(t, FormatCSV, FormatOf("catalog.CSV"))
+	assert.Equal(t, FormatJSON, FormatOf("catalog.ndjson"))
+	assert.Equal(t, "", FormatOf("catalog.xlsx"))
+}
+
+func TestParseMARC(t *testing.T) {
+	dune := marc.Record{Leader: marc.BookLeader}
+	dune.AddControl("001", "42")
+	dune.AddField("020", "  ", marc.Subfield{Code: "a", Value: "0441172717 (pbk.)"})
+	dune.AddField("100", "1 ", marc.Subfield{Code: "a", Value: "Herbert, Frank."})
+	dune.AddField("245", "10", marc.Subfield{Code: "a", Value: "Dune /"})
+	dune.AddField("490", "0 ", marc.Subfield{Code: "a", Value: "Dune chronicles"})
+	dune.AddField("876", "  ", marc.Subfield{Code: "p", Value: "000123"})
+
+	emma := marc.Record{Leader: marc.BookLeader}
+	emma.AddControl("001", "43")
+	emma.AddField("245", "10", marc.Subfield{Code: "a", Value: "Emma"})
+
+	// the middle record has a leader pointing past its end
+	var file bytes.Buffer
+	data, _ := dune.MarshalBinary()
+	file.Write(data)
+	file.WriteString("00042nam a2200099 i 4500\x1d")
+	data, _ = emma.MarshalBinary()
+	file.Write(data)
+
+	records, err := Parse(FormatMARC, &file)
+	assert.NoError(t, err)
+	assert.Len(t, records, 3)
+
+	assert.Equal(t, Record{Line: 1, Title: "Dune", Authors: []string{"Herbert, Frank"}, Subjects: []string{}, ISBN: "0441172717", Copies: 1, Unmapped: []string{"001", "490"}}, records[0])
+	assert.ErrorIs(t, records[1].Err, marc.ErrInvalidRecord)
+	assert.Equal(t, uint(3), records[2].Line)
+	assert.Equal(t, []string{"001 (2)", "490 (1)"}, Unmapped(records))
+
+	var xmlFile bytes.Buffer
+	writer := marc.NewXMLWriter(&xmlFile)
+	assert.NoError(t, writer.Write(dune))
+	assert.NoError(t, writer.Write(emma))
+	assert.NoError(t, writer.Close())
+
+	records, err = Parse(FormatOf("catalog.xml"), &xmlFile)
+	assert.NoError(t, err)
+	assert.Len(t, records, 2)
+	assert.Equal(t, "Dune", records[0].Title)
+	assert.Equal(t, uint(3), records[0].Line)
+	assert.Equal(t, "Emma", records[1].Title)
+
+	_, err = Parse(FormatMARCXML, strings.NewReader("<collection><record>"))
+	assert.Error(t, err)
+	_, err = Parse(FormatMARC, strings.NewReader("\n"))
+	assert.ErrorIs(t, err, ErrEmpty)
+}
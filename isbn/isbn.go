@@ -0,0 +1,154 @@
+package isbn
+
+import (
+	"errors"
+	"strings"
+)
+
+var (
+	ErrLength    = errors.New("isbn must have 10 or 13 digits")
+	ErrCharacter = errors.New("isbn can only contain digits, hyphens, spaces and a final X")
+	ErrChecksum  = errors.New("isbn check digit does not match")
+	ErrPrefix    = errors.New("only isbn-13 starting with 978 has an isbn-10 form")
+)
+
+// strip hyphens and spaces, the X check digit is upper cased
+func Clean(s string) string {
+	var b strings.Builder
+	for _, r := range strings.TrimSpace(s) {
+		switch {
+		case r == '-' || r == ' ':
+			continue
+		case r == 'x':
+			b.WriteRune('X')
+		default:
+			b.WriteRune(r)
+		}
+	}
+
+	return b.String()
+}
+
+// check digit of the first 9 digits of an isbn-10, 'X' stands for 10
+func checkDigit10(digits string) byte {
+	sum := 0
+	for i := 0; i < 9; i++ {
+		sum += int(digits[i]-'0') * (10 - i)
+	}
+
+	check := (11 - sum%11) % 11
+	if check == 10 {
+		return 'X'
+	}
+
+	return byte('0' + check)
+}
+
+// check digit of the first 12 digits of an isbn-13
+func checkDigit13(digits string) byte {
+	sum := 0
+	for i := 0; i < 12; i++ {
+		weight := 1
+		if i%2 == 1 {
+			weight = 3
+		}
+		sum += int(digits[i]-'0') * weight
+	}
+
+	return byte('0' + (10-sum%10)%10)
+}
+
+func allDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// validate a cleaned isbn-10
+func validate10(s string) error {
+	if !allDigits(s[:9]) || !(allDigits(s[9:]) || s[9] == 'X') {
+		return ErrCharacter
+	}
+	if checkDigit10(s) != s[9] {
+		return ErrChecksum
+	}
+
+	return nil
+}
+
+// validate a cleaned isbn-13
+func validate13(s string) error {
+	if !allDigits(s) {
+		return ErrCharacter
+	}
+	if checkDigit13(s) != s[12] {
+		return ErrChecksum
+	}
+
+	return nil
+}
+
+// parse an isbn-10 or isbn-13, with or without hyphens, into its canonical isbn-13 form
+func Parse(s string) (string, error) {
+	cleaned := Clean(s)
+
+	switch len(cleaned) {
+	case 10:
+		if err := validate10(cleaned); err != nil {
+			return "", err
+		}
+		return to13(cleaned), nil
+	case 13:
+		if err := validate13(cleaned); err != nil {
+			return "", err
+		}
+		return cleaned, nil
+	default:
+		return "", ErrLength
+	}
+}
+
+// check whether s is a valid isbn-10 or isbn-13
+func Valid(s string) bool {
+	_, err := Parse(s)
+	return err == nil
+}
+
+func to13(isbn10 string) string {
+	body := "978" + isbn10[:9]
+	return body + string(checkDigit13(body))
+}
+
+// convert an isbn-10 to isbn-13
+func To13(s string) (string, error) {
+	cleaned := Clean(s)
+	if len(cleaned) != 10 {
+		return "", ErrLength
+	}
+	if err := validate10(cleaned); err != nil {
+		return "", err
+	}
+
+	return to13(cleaned), nil
+}
+
+// convert an isbn-13 to isbn-10, only possible for the 978 prefix
+func To10(s string) (string, error) {
+	cleaned := Clean(s)
+	if len(cleaned) != 13 {
+		return "", ErrLength
+	}
+	if err := validate13(cleaned); err != nil {
+		return "", err
+	}
+	if !strings.HasPrefix(cleaned, "978") {
+		return "", ErrPrefix
+	}
+
+	body := cleaned[3:12]
+	return body + string(checkDigit10(body)), nil
+}
@@ -0,0 +1,55 @@
+package isbn
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	cases := []struct {
+		in   string
+		want string
+		err  error
+	}{
+		{"978-0-306-40615-7", "9780306406157", nil},
+		{"0-306-40615-2", "9780306406157", nil},
+		{"0306406152", "9780306406157", nil},
+		{" 978 0 306 40615 7 ", "9780306406157", nil},
+		{"0-8044-2957-X", "9780804429573", nil},
+		{"0-8044-2957-x", "9780804429573", nil},
+		{"979-10-90636-07-1", "9791090636071", nil},
+		{"0-306-40615-3", "", ErrChecksum},
+		{"978-0-306-40615-8", "", ErrChecksum},
+		{"X306406152", "", ErrCharacter},
+		{"97803064061X7", "", ErrCharacter},
+		{"12345", "", ErrLength},
+		{"", "", ErrLength},
+	}
+
+	for _, c := range cases {
+		got, err := Parse(c.in)
+		assert.ErrorIs(t, err, c.err, c.in)
+		assert.Equal(t, c.want, got, c.in)
+	}
+}
+
+func TestConversions(t *testing.T) {
+	isbn13, err := To13("0-8044-2957-X")
+	assert.NoError(t, err)
+	assert.Equal(t, "9780804429573", isbn13)
+
+	isbn10, err := To10(isbn13)
+	assert.NoError(t, err)
+	assert.Equal(t, "080442957X", isbn10)
+
+	isbn10, err = To10("9780306406157")
+	assert.NoError(t, err)
+	assert.Equal(t, "0306406152", isbn10)
+
+	_, err = To10("979-10-90636-07-1")
+	assert.ErrorIs(t, err, ErrPrefix)
+
+	_, err = To13("9780306406157")
+	assert.ErrorIs(t, err, ErrLength)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"project/libraryManagement/circulation"
+	"project/libraryManagement/config"
+	"project/libraryManagement/outbox"
+	"project/libraryManagement/scheduler"
+	"time"
+)
+
+// background jobs of the server, also runnable once with -run-job
+func newScheduler() *scheduler.Scheduler {
+	s := scheduler.New()
+
+	// roll uncollected holds to the next reader in line
+	s.Add(scheduler.Job{
+		Name:     "hold-expiry",
+		Interval: config.GetEnvDuration("HOLD_EXPIRY_INTERVAL", 15*time.Minute),
+		Run: func(now time.Time) error {
+			expired, err := circulation.ExpireHolds(config.DB, now)
+			if expired > 0 {
+				fmt.Printf("expired %d holds\n", expired)
+			}
+			return err
+		},
+	})
+
+	// remind readers of due books and chase overdue ones
+	s.Add(scheduler.Job{
+		Name:     "due-notices",
+		Interval: config.GetEnvDuration("NOTICE_INTERVAL", time.Hour),
+		Run: func(now time.Time) error {
+			sent, err := circulation.SendDueNotices(config.DB, now)
+			if sent > 0 {
+				fmt.Printf("sent %d due date notices\n", sent)
+			}
+			return err
+		},
+	})
+
+	// deliver queued emails, retrying failures with backoff
+	s.Add(scheduler.Job{
+		Name:     "outbox",
+		Interval: config.GetEnvDuration("OUTBOX_INTERVAL", 30*time.Second),
+		Run: func(now time.Time) error {
+			sent, failed, err := outbox.Deliver(config.DB, now, config.GetEnvInt("OUTBOX_BATCH", 50))
+			if sent > 0 || failed > 0 {
+				fmt.Printf("delivered %d notifications, %d failed\n", sent, failed)
+			}
+			return err
+		},
+	})
+
+	return s
+}
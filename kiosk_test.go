@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"project/libraryManagement/cards"
+	"project/libraryManagement/config"
+	"project/libraryManagement/labels"
+	"project/libraryManagement/models"
+	"project/libraryManagement/testutil"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKioskCheckoutAndCheckin(t *testing.T) {
+	f := setupTenants(t)
+
+	var ownBook models.BookInventory
+	config.DB.First(&ownBook, f.ownBook.ID)
+	owner := testutil.CreateUser(t, ownBook.LibID, "owner", "owner@own.test")
+	ownerToken := testutil.Token(t, owner)
+
+	var reader models.Users
+	config.DB.Where("email = ?", "reader@own.test").First(&reader)
+
+	var item models.BookCopy
+	config.DB.Where("book_id = ?", f.ownBook.ID).First(&item)
+
+	// only owners register kiosks
+	w := f.do("POST", "/owner/kiosk", f.adminToken, gin.H{"name": "Entrance"})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = f.do("POST", "/owner/kiosk", ownerToken, gin.H{"name": "Entrance"})
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	var res struct {
+		Kiosk      models.Kiosk `json:"kiosk"`
+		Credential string       `json:"credential"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &res)
+	kioskToken := "Kiosk " + res.Credential
+
+	// a reader needs a pin to use the kiosk
+	w = f.do("POST", "/kiosk/checkout", kioskToken, gin.H{"card": reader.CardNumber, "pin": "1234", "code": item.Barcode})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = f.do("PUT", "/reader/pin", f.readerToken, gin.H{"pin": "12"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = f.do("PUT", "/reader/pin", f.readerToken, gin.H{"pin": "1234"})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = f.do("POST", "/kiosk/checkout", kioskToken, gin.H{"card": reader.CardNumber, "pin": "4321", "code": item.Barcode})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = f.do("POST", "/kiosk/checkout", kioskToken, gin.H{"card": reader.CardNumber, "pin": "1234", "code": item.Barcode})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// the loan is approved by the kiosk, not by a staff member
+	var registry models.IssueRegistery
+	assert.NoError(t, config.DB.Where("copy_id = ? AND issue_status = ?", item.ID, "issued").First(&registry).Error)
+	assert.Equal(t, res.Kiosk.ID, *registry.IssueKioskID)
+	assert.Equal(t, uint(0), registry.IssueApproverID)
+
+	// copies of another library are unknown at the kiosk
+	var otherItem models.BookCopy
+	config.DB.Where("book_id = ?", f.otherBook.ID).First(&otherItem)
+	w = f.do("POST", "/kiosk/checkout", kioskToken, gin.H{"card": reader.CardNumber, "pin": "1234", "code": labels.ItemURL(otherItem.LibID, otherItem.ID)})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = f.do("POST", "/kiosk/checkin", kioskToken, gin.H{"card": reader.CardNumber, "pin": "1234", "code": item.Barcode})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	config.DB.First(&registry, registry.IssueID)
+	assert.Equal(t, "returned", registry.IssueStatus)
+	assert.Equal(t, res.Kiosk.ID, *registry.ReturnKioskID)
+	assert.Nil(t, registry.ReturnApproverID)
+
+	// both transactions are in the audit trail of the kiosk
+	w = f.do("GET", fmt.Sprintf("/owner/kiosk/%d/transactions", res.Kiosk.ID), ownerToken, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var trail struct {
+		Transactions []models.RequestEvent `json:"transactions"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &trail)
+	assert.Len(t, trail.Transactions, 2)
+
+	// a revoked kiosk is refused
+	w = f.do("DELETE", fmt.Sprintf("/owner/kiosk/%d", res.Kiosk.ID), ownerToken, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = f.do("POST", "/kiosk/account", kioskToken, gin.H{"card": reader.CardNumber, "pin": "1234"})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestKioskLocksCardAfterWrongPINs(t *testing.T) {
+	testutil.SetupDB(t)
+
+	library := testutil.CreateLibrary(t, "Library")
+	reader := testutil.CreateUser(t, library.ID, "reader", "reader@library.test")
+	assert.NoError(t, cards.SetPIN(config.DB, reader, "2468"))
+
+	for i := 0; i < cards.MaxPINAttempts-1; i++ {
+		_, err := cards.Authenticate(config.DB, library.ID, reader.CardNumber, "0000")
+		assert.ErrorIs(t, err, cards.ErrWrongPIN)
+	}
+
+	_, err := cards.Authenticate(config.DB, library.ID, reader.CardNumber, "0000")
+	assert.ErrorIs(t, err, cards.ErrPINLocked)
+
+	// even the right pin is refused until the lockout ends
+	_, err = cards.Authenticate(config.DB, library.ID, reader.CardNumber, "2468")
+	assert.ErrorIs(t, err, cards.ErrPINLocked)
+
+	// setting a new pin lifts the lockout
+	assert.NoError(t, cards.SetPIN(config.DB, reader, "1357"))
+	found, err := cards.Authenticate(config.DB, library.ID, reader.CardNumber, "1357")
+	assert.NoError(t, err)
+	assert.Equal(t, reader.ID, found.ID)
+}
+
+func TestParallelWrongPINsLockTheCard(t *testing.T) {
+	testutil.SetupDB(t)
+
+	library := testutil.CreateLibrary(t, "Library")
+	reader := testutil.CreateUser(t, library.ID, "reader", "reader@library.test")
+	assert.NoError(t, cards.SetPIN(config.DB, reader, "2468"))
+
+	// twice as many wrong pins as allowed, all at once
+	errs := make([]error, 2*cards.MaxPINAttempts)
+	start := make(chan struct{})
+
+	var wg sync.WaitGroup
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			_, errs[i] = cards.Authenticate(config.DB, library.ID, reader.CardNumber, "0000")
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+
+	wrong := 0
+	for _, err := range errs {
+		if errors.Is(err, cards.ErrWrongPIN) {
+			wrong++
+		} else {
+			assert.ErrorIs(t, err, cards.ErrPINLocked)
+		}
+	}
+	assert.Equal(t, cards.MaxPINAttempts-1, wrong)
+
+	_, err := cards.Authenticate(config.DB, library.ID, reader.CardNumber, "2468")
+	assert.ErrorIs(t, err, cards.ErrPINLocked)
+}
@@ -0,0 +1,62 @@
+package labels
+
+import (
+	"github.com/skip2/go-qrcode"
+)
+
+// library cards are credit card sized (iso/iec 7810 id-1, 85.6 x 53.98 mm), in pdf points
+const (
+	CardWidth  = 242.65
+	CardHeight = 153.01
+)
+
+// what is printed on a library card, the qr code holds the card number
+type Card struct {
+	Library string
+	Name    string
+	Number  string
+	// the number as printed, e.g. grouped in blocks of digits
+	Printed string
+}
+
+// one page pdf of a library card: the library and the reader on the left,
+// the qr code on the right and the card number along the bottom
+func CardPDF(card Card, level qrcode.RecoveryLevel) ([]byte, error) {
+	modules, err := Modules(card.Number, level)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := newPDF(CardWidth, CardHeight)
+	page := &pdfPage{}
+
+	padding := CardHeight * 0.08
+	numberSize := CardHeight * 0.1
+	size := CardHeight - 3*padding - numberSize
+	drawCode(page, CardWidth-padding-size, CardHeight-padding-size, size, modules)
+
+	available := CardWidth - 3*padding - size
+	titleSize := CardHeight * 0.09
+	smallSize := CardHeight * 0.065
+
+	lineY := CardHeight - padding - titleSize
+	for _, line := range wrapText(card.Library, titleSize, true, available, 2) {
+		page.text(fontBold, titleSize, padding, lineY, line)
+		lineY -= titleSize * 1.2
+	}
+
+	page.text(fontRegular, smallSize, padding, lineY-smallSize*0.4, "Library card")
+
+	if card.Name != "" {
+		page.text(fontBold, smallSize*1.2, padding, CardHeight-padding-size+smallSize*0.2, fitText(card.Name, smallSize*1.2, true, available))
+	}
+
+	printed := card.Printed
+	if printed == "" {
+		printed = card.Number
+	}
+	page.text(fontBold, numberSize, padding, padding, fitText(printed, numberSize, true, CardWidth-2*padding))
+
+	doc.addPage(page)
+	return doc.bytes(), nil
+}
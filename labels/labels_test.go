@@ -0,0 +1,116 @@
+package labels
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/skip2/go-qrcode"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestItemTokenRoundTrip(t *testing.T) {
+	t.Setenv("SECRET", "test-secret")
+
+	token := ItemToken(3, 42)
+	libID, copyID, err := ParseItemToken(token)
+	assert.NoError(t, err)
+	assert.Equal(t, uint(3), libID)
+	assert.Equal(t, uint(42), copyID)
+
+	// another copy or library can't be reached by editing the token
+	_, _, err = ParseItemToken(strings.Replace(token, "3.42", "3.43", 1))
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	_, _, err = ParseItemToken("3.42")
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	t.Setenv("SECRET", "other-secret")
+	_, _, err = ParseItemToken(token)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestItemURL(t *testing.T) {
+	t.Setenv("SECRET", "test-secret")
+	t.Setenv("ITEM_BASE_URL", "https://library.test/")
+
+	assert.Equal(t, "https://library.test/item/"+ItemToken(1, 2), ItemURL(1, 2))
+}
+
+func TestCodes(t *testing.T) {
+	_, err := ParseLevel("X")
+	assert.ErrorIs(t, err, ErrInvalidLevel)
+
+	level, err := ParseLevel("h")
+	assert.NoError(t, err)
+	assert.Equal(t, qrcode.Highest, level)
+
+	png, err := PNG("https://library.test/item/1.2.abc", 128, level)
+	assert.NoError(t, err)
+	assert.True(t, bytes.HasPrefix(png, []byte("\x89PNG")))
+
+	_, err = PNG("https://library.test/item/1.2.abc", 10, level)
+	assert.ErrorIs(t, err, ErrInvalidSize)
+
+	svg, err := SVG("https://library.test/item/1.2.abc", 256, level)
+	assert.NoError(t, err)
+	assert.Contains(t, string(svg), `width="256"`)
+	assert.Contains(t, string(svg), `<path d="M`)
+}
+
+func TestSheet(t *testing.T) {
+	layout, err := FindLayout("")
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultLayout, layout.Name)
+
+	_, err = FindLayout("avery-0000")
+	assert.ErrorIs(t, err, ErrUnknownLayout)
+
+	items := []Label{}
+	for i := 0; i < 31; i++ {
+		items = append(items, Label{Title: "A Rather Long Title (Second Edition) Über Alles", CallNumber: "823.914 ROW", Barcode: fmt.Sprintf("%08d", i), Code: "https://library.test/item/1.2.abc"})
+	}
+
+	pdf, err := Sheet(layout, items, 0, qrcode.Medium)
+	assert.NoError(t, err)
+	assert.True(t, bytes.HasPrefix(pdf, []byte("%PDF-1.4")))
+	assert.Contains(t, string(pdf), "/Count 2")
+	assert.Contains(t, string(pdf), `(823.914 ROW)`)
+	assert.Contains(t, string(pdf), `\(Second`)
+
+	// 29 labels after a skip of 1 fill one sheet
+	pdf, err = Sheet(layout, items[:29], 1, qrcode.Medium)
+	assert.NoError(t, err)
+	assert.Contains(t, string(pdf), "/Count 1")
+
+	// every xref entry points at its object
+	startxref := regexp.MustCompile(`startxref\n(\d+)`).FindSubmatch(pdf)
+	offset, _ := strconv.Atoi(string(startxref[1]))
+	assert.True(t, bytes.HasPrefix(pdf[offset:], []byte("xref")))
+
+	entries := regexp.MustCompile(`(\d{10}) 00000 n`).FindAllSubmatch(pdf, -1)
+	for i, entry := range entries {
+		at, _ := strconv.Atoi(string(entry[1]))
+		assert.True(t, bytes.HasPrefix(pdf[at:], []byte(fmt.Sprintf("%d 0 obj", i+1))))
+	}
+}
+
+func TestWrapText(t *testing.T) {
+	lines := wrapText("The Quick Brown Fox Jumps Over The Lazy Dog Again And Again", 10, false, 80, 2)
+	assert.Len(t, lines, 2)
+	assert.True(t, strings.HasSuffix(lines[1], "..."))
+
+	assert.Equal(t, `\(a\\b\) \374?`, escapePDF(`(a\b) ü€`))
+}
+
+func TestCardPDF(t *testing.T) {
+	pdf, err := CardPDF(Card{Library: "Own Library", Name: "Ada Reader", Number: "200000000006", Printed: "2000 0000 0006"}, qrcode.Medium)
+	assert.NoError(t, err)
+	assert.True(t, bytes.HasPrefix(pdf, []byte("%PDF-1.4")))
+	assert.Contains(t, string(pdf), "/MediaBox [0 0 242.65 153.01]")
+	assert.Contains(t, string(pdf), "(2000 0000 0006)")
+	assert.Contains(t, string(pdf), "(Ada Reader)")
+}
@@ -0,0 +1,166 @@
+package labels
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// fonts every page can use, the standard 14 fonts need no embedding
+const (
+	fontRegular = "F1"
+	fontBold    = "F2"
+)
+
+// a minimal pdf writer: pages of a fixed size drawing filled rectangles and helvetica text
+type pdfDocument struct {
+	width  float64
+	height float64
+	pages  []string
+}
+
+// content of a page, in pdf points with the origin at the bottom left
+type pdfPage struct {
+	content strings.Builder
+}
+
+func newPDF(width float64, height float64) *pdfDocument {
+	return &pdfDocument{width: width, height: height}
+}
+
+func (d *pdfDocument) addPage(page *pdfPage) {
+	d.pages = append(d.pages, page.content.String())
+}
+
+// fill a rectangle in black
+func (p *pdfPage) rect(x float64, y float64, w float64, h float64) {
+	fmt.Fprintf(&p.content, "%s %s %s %s re f\n", num(x), num(y), num(w), num(h))
+}
+
+// write a line of text with its baseline at y
+func (p *pdfPage) text(font string, size float64, x float64, y float64, s string) {
+	fmt.Fprintf(&p.content, "BT /%s %s Tf %s %s Td (%s) Tj ET\n", font, num(size), num(x), num(y), escapePDF(s))
+}
+
+// serialize the document with its cross reference table
+func (d *pdfDocument) bytes() []byte {
+	var out bytes.Buffer
+	var offsets []int
+
+	object := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	// catalog, page tree and fonts come first, every page then takes two objects
+	kids := make([]string, len(d.pages))
+	for i := range d.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 5+2*i)
+	}
+
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(d.pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+
+	for i, content := range d.pages {
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %s %s] /Resources << /Font << /%s 3 0 R /%s 4 0 R >> >> /Contents %d 0 R >>",
+			num(d.width), num(d.height), fontRegular, fontBold, 6+2*i))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", len(content), content))
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+
+	return out.Bytes()
+}
+
+// number with at most two decimals
+func num(f float64) string {
+	s := fmt.Sprintf("%.2f", f)
+	s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	if s == "" || s == "-0" {
+		return "0"
+	}
+	return s
+}
+
+// pdf string literal of the text, latin-1 characters map to winansi and others become '?'
+func escapePDF(s string) string {
+	var out strings.Builder
+
+	for _, r := range s {
+		switch {
+		case r == '\\' || r == '(' || r == ')':
+			out.WriteByte('\\')
+			out.WriteRune(r)
+		case r >= 32 && r < 127:
+			out.WriteRune(r)
+		case r >= 160 && r <= 255:
+			fmt.Fprintf(&out, "\\%03o", r)
+		default:
+			out.WriteByte('?')
+		}
+	}
+
+	return out.String()
+}
+
+// approximate width of helvetica text, good enough to fit text into a label
+func textWidth(s string, size float64, bold bool) float64 {
+	average := 0.52
+	if bold {
+		average = 0.57
+	}
+
+	return float64(len([]rune(s))) * size * average
+}
+
+// text cut to fit the width, ending with an ellipsis when cut
+func fitText(s string, size float64, bold bool, width float64) string {
+	if textWidth(s, size, bold) <= width {
+		return s
+	}
+
+	runes := []rune(s)
+	for len(runes) > 0 && textWidth(string(runes)+"...", size, bold) > width {
+		runes = runes[:len(runes)-1]
+	}
+
+	return strings.TrimSpace(string(runes)) + "..."
+}
+
+// words of the text over at most maxLines lines fitting the width
+func wrapText(s string, size float64, bold bool, width float64, maxLines int) []string {
+	var lines []string
+	line := ""
+
+	words := strings.Fields(s)
+	for i, word := range words {
+		candidate := strings.TrimSpace(line + " " + word)
+		if line == "" || textWidth(candidate, size, bold) <= width {
+			line = candidate
+			continue
+		}
+
+		if len(lines) == maxLines-1 {
+			line = strings.Join(append([]string{line}, words[i:]...), " ")
+			break
+		}
+
+		lines = append(lines, line)
+		line = word
+	}
+
+	if line != "" {
+		lines = append(lines, fitText(line, size, bold, width))
+	}
+
+	return lines
+}
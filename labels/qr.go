@@ -0,0 +1,86 @@
+package labels
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/skip2/go-qrcode"
+)
+
+var (
+	ErrInvalidLevel = errors.New("error correction level must be L, M, Q or H")
+	ErrInvalidSize  = errors.New("size must be between 64 and 2048 pixels")
+)
+
+const (
+	MinSize = 64
+	MaxSize = 2048
+)
+
+// error correction level from its letter, medium when empty
+func ParseLevel(level string) (qrcode.RecoveryLevel, error) {
+	switch strings.ToUpper(level) {
+	case "L":
+		return qrcode.Low, nil
+	case "", "M":
+		return qrcode.Medium, nil
+	case "Q":
+		return qrcode.High, nil
+	case "H":
+		return qrcode.Highest, nil
+	default:
+		return 0, ErrInvalidLevel
+	}
+}
+
+// modules of the qr code of the content, quiet zone included
+func Modules(content string, level qrcode.RecoveryLevel) ([][]bool, error) {
+	code, err := qrcode.New(content, level)
+	if err != nil {
+		return nil, err
+	}
+
+	return code.Bitmap(), nil
+}
+
+// qr code of the content as a png of size x size pixels
+func PNG(content string, size int, level qrcode.RecoveryLevel) ([]byte, error) {
+	if size < MinSize || size > MaxSize {
+		return nil, ErrInvalidSize
+	}
+
+	code, err := qrcode.New(content, level)
+	if err != nil {
+		return nil, err
+	}
+
+	return code.PNG(size)
+}
+
+// qr code of the content as an svg of size x size pixels, one path for every dark module
+func SVG(content string, size int, level qrcode.RecoveryLevel) ([]byte, error) {
+	if size < MinSize || size > MaxSize {
+		return nil, ErrInvalidSize
+	}
+
+	modules, err := Modules(content, level)
+	if err != nil {
+		return nil, err
+	}
+
+	var path strings.Builder
+	for y, row := range modules {
+		for x, dark := range row {
+			if dark {
+				fmt.Fprintf(&path, "M%d %dh1v1h-1z", x, y)
+			}
+		}
+	}
+
+	n := len(modules)
+	svg := fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`+
+		`<rect width="%d" height="%d" fill="#fff"/><path d="%s" fill="#000"/></svg>`, size, size, n, n, n, n, path.String())
+
+	return []byte(svg), nil
+}
@@ -0,0 +1,156 @@
+package labels
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/skip2/go-qrcode"
+)
+
+var ErrUnknownLayout = errors.New("unknown label layout")
+
+// label stock, sizes are in pdf points (1/72 inch)
+type Layout struct {
+	Name       string  `json:"name"`
+	PageWidth  float64 `json:"pageWidth"`
+	PageHeight float64 `json:"pageHeight"`
+	Columns    int     `json:"columns"`
+	Rows       int     `json:"rows"`
+	Width      float64 `json:"width"`
+	Height     float64 `json:"height"`
+	MarginTop  float64 `json:"marginTop"`
+	MarginLeft float64 `json:"marginLeft"`
+	PitchX     float64 `json:"pitchX"`
+	PitchY     float64 `json:"pitchY"`
+}
+
+// supported label stocks
+var layouts = map[string]Layout{
+	// us letter, 3 x 10 labels of 2 5/8" x 1"
+	"avery-5160": {Name: "avery-5160", PageWidth: 612, PageHeight: 792, Columns: 3, Rows: 10, Width: 189, Height: 72, MarginTop: 36, MarginLeft: 13.5, PitchX: 198, PitchY: 72},
+	// a4, 3 x 7 labels of 63.5 x 38.1 mm
+	"avery-l7160": {Name: "avery-l7160", PageWidth: 595.28, PageHeight: 841.89, Columns: 3, Rows: 7, Width: 180, Height: 108, MarginTop: 42.94, MarginLeft: 20.41, PitchX: 187.09, PitchY: 108},
+	// a4, 3 x 8 labels of 64 x 33.9 mm
+	"avery-l7159": {Name: "avery-l7159", PageWidth: 595.28, PageHeight: 841.89, Columns: 3, Rows: 8, Width: 181.42, Height: 96.09, MarginTop: 36.57, MarginLeft: 18.43, PitchX: 188.5, PitchY: 96.09},
+}
+
+const DefaultLayout = "avery-5160"
+
+// layout by name, the default layout when empty
+func FindLayout(name string) (Layout, error) {
+	if name == "" {
+		name = DefaultLayout
+	}
+
+	layout, ok := layouts[name]
+	if !ok {
+		return Layout{}, ErrUnknownLayout
+	}
+
+	return layout, nil
+}
+
+// names of the supported layouts
+func Layouts() []string {
+	names := []string{}
+	for name := range layouts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// what is printed on a label, Code is encoded in the qr code
+type Label struct {
+	Title      string
+	CallNumber string
+	Barcode    string
+	Code       string
+}
+
+// pdf of label sheets, the first skip labels of the first sheet are left blank
+// so a partly used sheet can be printed on
+func Sheet(layout Layout, items []Label, skip int, level qrcode.RecoveryLevel) ([]byte, error) {
+	doc := newPDF(layout.PageWidth, layout.PageHeight)
+	perPage := layout.Columns * layout.Rows
+	if skip < 0 || skip >= perPage {
+		skip = 0
+	}
+
+	var page *pdfPage
+	for i, item := range items {
+		slot := skip + i
+		if slot%perPage == 0 || page == nil {
+			if page != nil {
+				doc.addPage(page)
+			}
+			page = &pdfPage{}
+		}
+
+		slot %= perPage
+		x := layout.MarginLeft + float64(slot%layout.Columns)*layout.PitchX
+		y := layout.PageHeight - layout.MarginTop - float64(slot/layout.Columns)*layout.PitchY - layout.Height
+
+		if err := drawLabel(page, layout, x, y, item, level); err != nil {
+			return nil, err
+		}
+	}
+	if page != nil {
+		doc.addPage(page)
+	} else {
+		doc.addPage(&pdfPage{})
+	}
+
+	return doc.bytes(), nil
+}
+
+// draw a label with its bottom left corner at x, y: the qr code on the left, the text on the right
+func drawLabel(page *pdfPage, layout Layout, x float64, y float64, item Label, level qrcode.RecoveryLevel) error {
+	padding := layout.Height * 0.08
+
+	modules, err := Modules(item.Code, level)
+	if err != nil {
+		return err
+	}
+
+	size := layout.Height - 2*padding
+	drawCode(page, x+padding, y+padding, size, modules)
+
+	textX := x + padding + size + padding
+	available := x + layout.Width - padding - textX
+	titleSize := layout.Height * 0.13
+	smallSize := layout.Height * 0.11
+
+	lineY := y + layout.Height - padding - titleSize
+	for _, line := range wrapText(item.Title, titleSize, true, available, 2) {
+		page.text(fontBold, titleSize, textX, lineY, line)
+		lineY -= titleSize * 1.2
+	}
+
+	if item.CallNumber != "" {
+		page.text(fontRegular, smallSize, textX, lineY-smallSize*0.2, fitText(item.CallNumber, smallSize, false, available))
+	}
+
+	page.text(fontRegular, smallSize, textX, y+padding+smallSize*0.2, fitText(item.Barcode, smallSize, false, available))
+
+	return nil
+}
+
+// draw a qr code as vector rectangles, x and y are its bottom left corner
+func drawCode(page *pdfPage, x float64, y float64, size float64, modules [][]bool) {
+	module := size / float64(len(modules))
+	for row, line := range modules {
+		// consecutive dark modules are drawn as one rectangle
+		for col := 0; col < len(line); col++ {
+			if !line[col] {
+				continue
+			}
+			start := col
+			for col+1 < len(line) && line[col+1] {
+				col++
+			}
+			page.rect(x+float64(start)*module, y+size-float64(row+1)*module, float64(col-start+1)*module, module)
+		}
+	}
+}
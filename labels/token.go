@@ -0,0 +1,54 @@
+package labels
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"project/libraryManagement/config"
+	"strings"
+)
+
+var ErrInvalidToken = errors.New("invalid item token")
+
+// signature of the library and copy ids, truncated to keep the qr code small
+func sign(payload string) string {
+	mac := hmac.New(sha256.New, []byte(os.Getenv("SECRET")))
+	mac.Write([]byte("item:" + payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:12])
+}
+
+// stable token identifying a copy, it only changes with the SECRET
+func ItemToken(libID uint, copyID uint) string {
+	payload := fmt.Sprintf("%d.%d", libID, copyID)
+	return payload + "." + sign(payload)
+}
+
+// library and copy of a token, checking its signature
+func ParseItemToken(token string) (uint, uint, error) {
+	var libID, copyID uint
+
+	i := strings.LastIndex(token, ".")
+	if i < 0 {
+		return 0, 0, ErrInvalidToken
+	}
+
+	payload := token[:i]
+	if _, err := fmt.Sscanf(payload, "%d.%d", &libID, &copyID); err != nil || fmt.Sprintf("%d.%d", libID, copyID) != payload {
+		return 0, 0, ErrInvalidToken
+	}
+
+	if !hmac.Equal([]byte(sign(payload)), []byte(token[i+1:])) {
+		return 0, 0, ErrInvalidToken
+	}
+
+	return libID, copyID, nil
+}
+
+// public url of a copy, encoded in its qr code
+func ItemURL(libID uint, copyID uint) string {
+	base := strings.TrimRight(config.GetEnv("ITEM_BASE_URL", "http://localhost:3001"), "/")
+	return base + "/item/" + ItemToken(libID, copyID)
+}
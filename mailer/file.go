@@ -0,0 +1,99 @@
+package mailer
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+// writes every email to a maildir (tmp, new, cur), handy for local development
+type FileMailer struct {
+	Dir string
+}
+
+var fileCounter uint64
+
+func NewFileMailer(dir string) (*FileMailer, error) {
+	for _, sub := range []string{"tmp", "new", "cur"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0o755); err != nil {
+			return nil, err
+		}
+	}
+
+	return &FileMailer{Dir: dir}, nil
+}
+
+func (f *FileMailer) Send(msg Message) error {
+	host, _ := os.Hostname()
+	name := fmt.Sprintf("%d.%d_%d.%s", time.Now().Unix(), os.Getpid(), atomic.AddUint64(&fileCounter, 1), host)
+
+	content, err := encode(msg)
+	if err != nil {
+		return err
+	}
+
+	// written to tmp first so readers of new never see half a message
+	tmp := filepath.Join(f.Dir, "tmp", name)
+	if err := os.WriteFile(tmp, content, 0o644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, filepath.Join(f.Dir, "new", name))
+}
+
+// encode a message as MIME, multipart/alternative when it has an html body
+func encode(msg Message) ([]byte, error) {
+	var out bytes.Buffer
+
+	fmt.Fprintf(&out, "From: %s\r\nTo: %s\r\nSubject: %s\r\nDate: %s\r\nMIME-Version: 1.0\r\n",
+		msg.From, msg.To, mime.QEncoding.Encode("utf-8", msg.Subject), time.Now().Format(time.RFC1123Z))
+
+	if msg.HTML == "" {
+		out.WriteString("Content-Type: text/plain; charset=UTF-8\r\nContent-Transfer-Encoding: quoted-printable\r\n\r\n")
+		if err := writeQuotedPrintable(&out, msg.Body); err != nil {
+			return nil, err
+		}
+		return out.Bytes(), nil
+	}
+
+	var parts bytes.Buffer
+	writer := multipart.NewWriter(&parts)
+
+	for _, part := range []struct{ contentType, body string }{{"text/plain", msg.Body}, {"text/html", msg.HTML}} {
+		w, err := writer.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType + "; charset=UTF-8"},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err := writeQuotedPrintable(w, part.body); err != nil {
+			return nil, err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	fmt.Fprintf(&out, "Content-Type: multipart/alternative; boundary=%s\r\n\r\n", writer.Boundary())
+	out.Write(parts.Bytes())
+
+	return out.Bytes(), nil
+}
+
+func writeQuotedPrintable(w io.Writer, body string) error {
+	qp := quotedprintable.NewWriter(w)
+	if _, err := qp.Write([]byte(body)); err != nil {
+		return err
+	}
+
+	return qp.Close()
+}
@@ -0,0 +1,81 @@
+package mailer
+
+import (
+	"fmt"
+	"project/libraryManagement/config"
+	"strings"
+	"sync"
+)
+
+// an email with a plain text body and an optional html alternative
+type Message struct {
+	From    string
+	To      string
+	Subject string
+	Body    string
+	HTML    string
+}
+
+// delivers emails, implementations must be safe for concurrent use
+type Mailer interface {
+	Send(msg Message) error
+}
+
+var (
+	mu      sync.RWMutex
+	current Mailer
+)
+
+// replace the mailer used by Send, returns the previous one
+func Set(m Mailer) Mailer {
+	mu.Lock()
+	defer mu.Unlock()
+
+	previous := current
+	current = m
+
+	return previous
+}
+
+// mailer used by Send, built from the environment the first time it's needed
+func Default() Mailer {
+	mu.RLock()
+	m := current
+	mu.RUnlock()
+
+	if m != nil {
+		return m
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if current == nil {
+		m, err := FromEnv()
+		if err != nil {
+			panic(err)
+		}
+		current = m
+	}
+
+	return current
+}
+
+// send an email with the default mailer, html may be empty for a plain text email
+func Send(to string, subject string, body string, html string) error {
+	return Default().Send(Message{From: config.GetEnv("MAIL_FROM", config.GetEnv("EMAIL", "")), To: to, Subject: subject, Body: body, HTML: html})
+}
+
+// build the mailer selected by MAIL_DRIVER: smtp (default), file or memory
+func FromEnv() (Mailer, error) {
+	switch driver := strings.ToLower(config.GetEnv("MAIL_DRIVER", "smtp")); driver {
+	case "smtp":
+		return SMTPFromEnv()
+	case "file":
+		return NewFileMailer(config.GetEnv("MAIL_DIR", "mail"))
+	case "memory":
+		return NewRecorder(), nil
+	default:
+		return nil, fmt.Errorf("unknown MAIL_DRIVER %q, use smtp, file or memory", driver)
+	}
+}
@@ -0,0 +1,84 @@
+package mailer
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileMailerWritesToMaildir(t *testing.T) {
+	dir := t.TempDir()
+
+	m, err := NewFileMailer(dir)
+	assert.NoError(t, err)
+
+	assert.NoError(t, m.Send(Message{From: "library@test", To: "reader@test", Subject: "Hello", Body: "first"}))
+	assert.NoError(t, m.Send(Message{From: "library@test", To: "reader@test", Subject: "Hello", Body: "second"}))
+
+	files, _ := os.ReadDir(filepath.Join(dir, "new"))
+	assert.Len(t, files, 2)
+
+	tmp, _ := os.ReadDir(filepath.Join(dir, "tmp"))
+	assert.Empty(t, tmp)
+
+	content, _ := os.ReadFile(filepath.Join(dir, "new", files[0].Name()))
+	assert.True(t, strings.HasPrefix(string(content), "From: library@test\r\nTo: reader@test\r\nSubject: Hello\r\n"))
+	assert.Contains(t, string(content), "Content-Type: text/plain")
+}
+
+func TestHTMLEmailsAreMultipart(t *testing.T) {
+	content, err := encode(Message{From: "library@test", To: "reader@test", Subject: "Hello", Body: "plain body", HTML: "<p>html body</p>"})
+	assert.NoError(t, err)
+
+	msg, err := mail.ReadMessage(bytes.NewReader(content))
+	assert.NoError(t, err)
+
+	mediaType, params, _ := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	assert.Equal(t, "multipart/alternative", mediaType)
+
+	reader := multipart.NewReader(msg.Body, params["boundary"])
+	var types, bodies []string
+	for {
+		part, err := reader.NextPart()
+		if err != nil {
+			break
+		}
+		body, _ := io.ReadAll(part)
+		types = append(types, strings.Split(part.Header.Get("Content-Type"), ";")[0])
+		bodies = append(bodies, string(body))
+	}
+
+	assert.Equal(t, []string{"text/plain", "text/html"}, types)
+	assert.Equal(t, []string{"plain body", "<p>html body</p>"}, bodies)
+}
+
+func TestFromEnvSelectsDriver(t *testing.T) {
+	t.Setenv("MAIL_DRIVER", "memory")
+	m, err := FromEnv()
+	assert.NoError(t, err)
+	assert.IsType(t, &Recorder{}, m)
+
+	t.Setenv("MAIL_DRIVER", "smtp")
+	t.Setenv("SMTP_HOST", "localhost")
+	t.Setenv("SMTP_PORT", "1025")
+	t.Setenv("SMTP_TLS", "none")
+	m, err = FromEnv()
+	assert.NoError(t, err)
+	assert.Equal(t, &SMTPMailer{Host: "localhost", Port: 1025, TLSMode: TLSNone, Username: os.Getenv("EMAIL"), Password: os.Getenv("EMAIL_PASSWORD")}, m)
+
+	t.Setenv("SMTP_TLS", "sometimes")
+	_, err = FromEnv()
+	assert.Error(t, err)
+
+	t.Setenv("MAIL_DRIVER", "pigeon")
+	_, err = FromEnv()
+	assert.Error(t, err)
+}
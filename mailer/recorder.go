@@ -0,0 +1,71 @@
+package mailer
+
+import "sync"
+
+// keeps sent emails in memory, used by tests
+type Recorder struct {
+	mu       sync.Mutex
+	messages []Message
+	err      error
+}
+
+func NewRecorder() *Recorder {
+	return &Recorder{}
+}
+
+func (r *Recorder) Send(msg Message) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.err != nil {
+		return r.err
+	}
+
+	r.messages = append(r.messages, msg)
+	return nil
+}
+
+// make the following sends fail with err, nil to succeed again
+func (r *Recorder) Fail(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.err = err
+}
+
+// every email sent so far
+func (r *Recorder) Messages() []Message {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]Message(nil), r.messages...)
+}
+
+// emails sent to an address
+func (r *Recorder) To(address string) []Message {
+	var sent []Message
+	for _, msg := range r.Messages() {
+		if msg.To == address {
+			sent = append(sent, msg)
+		}
+	}
+
+	return sent
+}
+
+// last email sent to an address
+func (r *Recorder) Last(address string) (Message, bool) {
+	sent := r.To(address)
+	if len(sent) == 0 {
+		return Message{}, false
+	}
+
+	return sent[len(sent)-1], true
+}
+
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.messages = nil
+}
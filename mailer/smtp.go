@@ -0,0 +1,69 @@
+package mailer
+
+import (
+	"crypto/tls"
+	"fmt"
+	"project/libraryManagement/config"
+	"strings"
+
+	gomail "gopkg.in/mail.v2"
+)
+
+// tls modes of the smtp connection
+const (
+	TLSStartTLS = "starttls" // plain connection upgraded with STARTTLS, required
+	TLSImplicit = "tls"      // tls from the start, usually port 465
+	TLSNone     = "none"     // no encryption, for local relays only
+)
+
+// sends emails through an smtp server
+type SMTPMailer struct {
+	Host               string
+	Port               int
+	Username           string
+	Password           string
+	TLSMode            string
+	InsecureSkipVerify bool
+}
+
+// smtp mailer configured by SMTP_HOST, SMTP_PORT, SMTP_TLS, SMTP_INSECURE_SKIP_VERIFY, EMAIL and EMAIL_PASSWORD
+func SMTPFromEnv() (*SMTPMailer, error) {
+	mode := strings.ToLower(config.GetEnv("SMTP_TLS", TLSStartTLS))
+	if mode != TLSStartTLS && mode != TLSImplicit && mode != TLSNone {
+		return nil, fmt.Errorf("unknown SMTP_TLS %q, use starttls, tls or none", mode)
+	}
+
+	return &SMTPMailer{
+		Host:               config.GetEnv("SMTP_HOST", "smtp.gmail.com"),
+		Port:               config.GetEnvInt("SMTP_PORT", 587),
+		Username:           config.GetEnv("SMTP_USERNAME", config.GetEnv("EMAIL", "")),
+		Password:           config.GetEnv("EMAIL_PASSWORD", ""),
+		TLSMode:            mode,
+		InsecureSkipVerify: config.GetEnv("SMTP_INSECURE_SKIP_VERIFY", "false") == "true",
+	}, nil
+}
+
+func (s *SMTPMailer) Send(msg Message) error {
+	m := gomail.NewMessage()
+	m.SetHeader("From", msg.From)
+	m.SetHeader("To", msg.To)
+	m.SetHeader("Subject", msg.Subject)
+	m.SetBody("text/plain", msg.Body)
+	if msg.HTML != "" {
+		m.AddAlternative("text/html", msg.HTML)
+	}
+
+	d := gomail.NewDialer(s.Host, s.Port, s.Username, s.Password)
+	d.TLSConfig = &tls.Config{ServerName: s.Host, InsecureSkipVerify: s.InsecureSkipVerify}
+
+	switch s.TLSMode {
+	case TLSImplicit:
+		d.SSL = true
+	case TLSNone:
+		d.StartTLSPolicy = gomail.NoStartTLS
+	default:
+		d.StartTLSPolicy = gomail.MandatoryStartTLS
+	}
+
+	return d.DialAndSend(m)
+}
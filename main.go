@@ -1,20 +1,57 @@
 package main
 
 import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
 	"project/libraryManagement/config"
 	"project/libraryManagement/controllers"
+	"project/libraryManagement/importer"
+	"project/libraryManagement/mailer"
 	"project/libraryManagement/middlewares"
+	"project/libraryManagement/tenant"
 	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 )
 
-func init() {
+func main() {
+	runJob := flag.String("run-job", "", "run a background job once and exit, e.g. due-notices or hold-expiry")
+	flag.Parse()
+
 	config.ConnectToDB()
-}
 
-func main() {
+	// smtp, maildir or in-memory mailer depending on MAIL_DRIVER
+	mail, err := mailer.FromEnv()
+	if err != nil {
+		panic(err)
+	}
+	mailer.Set(mail)
+
+	// constrain library owned tables to the library of the authenticated user
+	if err := tenant.Setup(config.DB); err != nil {
+		panic("failed to register tenant scoping")
+	}
+
+	jobs := newScheduler()
+
+	if *runJob != "" {
+		if err := jobs.RunOnce(*runJob); err != nil {
+			fmt.Println(err, "- available jobs:", jobs.Names())
+			os.Exit(1)
+		}
+		return
+	}
+
+	// imports stopped with the previous server won't finish
+	if err := importer.Recover(config.DB); err != nil {
+		fmt.Println("failed to recover imports:", err)
+	}
+
+	jobs.Start(context.Background())
+
 	r := gin.Default()
 
 	// cors
@@ -27,7 +64,13 @@ func main() {
         MaxAge: 12 * time.Hour,
     }))
 	  
+	registerRoutes(r)
+
+	r.Run("0.0.0.0:3001")
+}
 
+// register every route of the api
+func registerRoutes(r *gin.Engine) {
 	r.GET("/", controllers.Health)
 
 	// auth routes
@@ -36,41 +79,97 @@ func main() {
 	authRoutes.POST("/login", controllers.Login)
 	authRoutes.POST("/demo-login", controllers.DemoLogin)
 	authRoutes.POST("/otp/verify", controllers.VerifyUserOTP)
+	authRoutes.POST("/refresh", controllers.RefreshToken)
+	authRoutes.POST("/logout", middlewares.Authenticate, controllers.Logout)
+	authRoutes.POST("/logout/all", middlewares.Authenticate, controllers.LogoutAll)
 
 	// owner routes
 	ownerRoutes := r.Group("/owner")
-	ownerRoutes.Use(middlewares.AuthOwner)
-	ownerRoutes.POST("/onboard/admin", controllers.OnboardAdmin)
-	ownerRoutes.GET("/admin/list", controllers.RetrieveAdminByLib)
+	ownerRoutes.Use(middlewares.Authenticate)
+	ownerRoutes.POST("/onboard/admin", middlewares.RequirePermission(middlewares.PermAdminsManage), controllers.OnboardAdmin)
+	ownerRoutes.GET("/admin/list", middlewares.RequirePermission(middlewares.PermAdminsManage), controllers.RetrieveAdminByLib)
+	ownerRoutes.POST("/admin/:id/logout", middlewares.RequirePermission(middlewares.PermAdminsManage), controllers.RevokeAdminSessions)
+	ownerRoutes.GET("/policies", middlewares.RequirePermission(middlewares.PermLibraryManage), controllers.RetrievePolicies)
+	ownerRoutes.GET("/policy/effective", middlewares.RequirePermission(middlewares.PermLibraryManage), controllers.RetrieveEffectivePolicy)
+	ownerRoutes.PUT("/policy", middlewares.RequirePermission(middlewares.PermLibraryManage), controllers.SavePolicy)
+	ownerRoutes.DELETE("/policy/:id", middlewares.RequirePermission(middlewares.PermLibraryManage), controllers.DeletePolicy)
+	ownerRoutes.GET("/templates", middlewares.RequirePermission(middlewares.PermLibraryManage), controllers.RetrieveTemplates)
+	ownerRoutes.PUT("/template/:name", middlewares.RequirePermission(middlewares.PermLibraryManage), controllers.SaveTemplate)
+	ownerRoutes.DELETE("/template/:name", middlewares.RequirePermission(middlewares.PermLibraryManage), controllers.DeleteTemplate)
+	ownerRoutes.GET("/template/:name/preview", middlewares.RequirePermission(middlewares.PermLibraryManage), controllers.PreviewTemplate)
+	ownerRoutes.PATCH("/library/branding", middlewares.RequirePermission(middlewares.PermLibraryManage), controllers.UpdateBranding)
+	ownerRoutes.POST("/kiosk", middlewares.RequirePermission(middlewares.PermKiosksManage), controllers.RegisterKiosk)
+	ownerRoutes.GET("/kiosks", middlewares.RequirePermission(middlewares.PermKiosksManage), controllers.RetrieveKiosks)
+	ownerRoutes.DELETE("/kiosk/:id", middlewares.RequirePermission(middlewares.PermKiosksManage), controllers.RevokeKiosk)
+	ownerRoutes.GET("/kiosk/:id/transactions", middlewares.RequirePermission(middlewares.PermKiosksManage), controllers.RetrieveKioskTransactions)
 
 	// admin routes
 	adminRoutes := r.Group("/admin")
-	adminRoutes.Use(middlewares.AuthAdmin)
-	adminRoutes.POST("/onboard/reader", controllers.OnboardReader)
-	adminRoutes.POST("/create/inventory", controllers.CreateInventory)
-	adminRoutes.DELETE("/delete/book/:id", controllers.RemoveBook)
-	adminRoutes.POST("/add/book", controllers.AddBook)
-	adminRoutes.PATCH("/update/book", controllers.UpdateBook)
-	adminRoutes.POST("/issue/approve", controllers.ApproveIssueRequest)
-	adminRoutes.POST("/return/approve", controllers.ApproveReturnRequest)
-	adminRoutes.POST("/reject/request", controllers.RejectRequest)
-	adminRoutes.GET("/reader/list", controllers.RetrieveReaders)
+	adminRoutes.Use(middlewares.Authenticate)
+	adminRoutes.POST("/onboard/reader", middlewares.RequirePermission(middlewares.PermReadersManage), controllers.OnboardReader)
+	adminRoutes.GET("/reader/list", middlewares.RequirePermission(middlewares.PermReadersManage), controllers.RetrieveReaders)
+	adminRoutes.PATCH("/reader/:id/category", middlewares.RequirePermission(middlewares.PermReadersManage), controllers.UpdatePatronCategory)
+	adminRoutes.GET("/reader/:id/card", middlewares.RequirePermission(middlewares.PermReadersManage), controllers.PrintReaderCard)
+	adminRoutes.POST("/reader/:id/card/replace", middlewares.RequirePermission(middlewares.PermReadersManage), controllers.ReplaceReaderCard)
+	adminRoutes.DELETE("/reader/:id/pin", middlewares.RequirePermission(middlewares.PermReadersManage), controllers.ClearReaderPIN)
+	adminRoutes.GET("/card/:number", middlewares.RequirePermission(middlewares.PermReadersManage), controllers.LookupCard)
+	adminRoutes.POST("/create/inventory", middlewares.RequirePermission(middlewares.PermInventoryWrite), controllers.CreateInventory)
+	adminRoutes.DELETE("/delete/book/:id", middlewares.RequirePermission(middlewares.PermInventoryWrite), controllers.RemoveBook)
+	adminRoutes.POST("/add/book", middlewares.RequirePermission(middlewares.PermInventoryWrite), controllers.AddBook)
+	adminRoutes.PATCH("/update/book", middlewares.RequirePermission(middlewares.PermInventoryWrite), controllers.UpdateBook)
+	adminRoutes.POST("/import", middlewares.RequirePermission(middlewares.PermInventoryWrite), controllers.ImportCatalog)
+	adminRoutes.GET("/imports", middlewares.RequirePermission(middlewares.PermInventoryWrite), controllers.RetrieveImportJobs)
+	adminRoutes.GET("/import/:id", middlewares.RequirePermission(middlewares.PermInventoryWrite), controllers.RetrieveImportJob)
+	adminRoutes.GET("/export/catalog", middlewares.RequirePermission(middlewares.PermCatalogExport), controllers.ExportCatalog)
+	adminRoutes.GET("/export/loans", middlewares.RequirePermission(middlewares.PermCatalogExport), controllers.ExportLoans)
+	adminRoutes.GET("/book/:id/copies", middlewares.RequirePermission(middlewares.PermInventoryWrite), controllers.RetrieveCopies)
+	adminRoutes.POST("/book/:id/copies", middlewares.RequirePermission(middlewares.PermInventoryWrite), controllers.AddBookCopies)
+	adminRoutes.GET("/copy/:barcode", middlewares.RequirePermission(middlewares.PermInventoryWrite), controllers.RetrieveCopy)
+	adminRoutes.PATCH("/copy/:barcode", middlewares.RequirePermission(middlewares.PermInventoryWrite), controllers.UpdateCopy)
+	adminRoutes.POST("/labels", middlewares.RequirePermission(middlewares.PermInventoryWrite), controllers.PrintLabels)
+	adminRoutes.POST("/issue/approve", middlewares.RequirePermission(middlewares.PermCirculationManage), controllers.ApproveIssueRequest)
+	adminRoutes.POST("/return/approve", middlewares.RequirePermission(middlewares.PermCirculationManage), controllers.ApproveReturnRequest)
+	adminRoutes.POST("/reject/request", middlewares.RequirePermission(middlewares.PermCirculationManage), controllers.RejectRequest)
+	adminRoutes.POST("/renew/approve", middlewares.RequirePermission(middlewares.PermCirculationManage), controllers.ApproveRenewRequest)
+	adminRoutes.POST("/desk/checkout", middlewares.RequirePermission(middlewares.PermCirculationManage), controllers.DeskCheckout)
+	adminRoutes.POST("/desk/checkin", middlewares.RequirePermission(middlewares.PermCirculationManage), controllers.DeskCheckin)
+	adminRoutes.GET("/holds", middlewares.RequirePermission(middlewares.PermCirculationManage), controllers.RetrieveHolds)
+	adminRoutes.GET("/notifications", middlewares.RequirePermission(middlewares.PermNotificationsManage), controllers.RetrieveNotifications)
+	adminRoutes.POST("/notification/:id/retry", middlewares.RequirePermission(middlewares.PermNotificationsManage), controllers.RetryNotification)
+	adminRoutes.POST("/notification/:id/cancel", middlewares.RequirePermission(middlewares.PermNotificationsManage), controllers.CancelNotification)
+	adminRoutes.GET("/reader/:id/ledger", middlewares.RequirePermission(middlewares.PermFinesManage), controllers.RetrieveReaderLedger)
+	adminRoutes.POST("/reader/:id/ledger", middlewares.RequirePermission(middlewares.PermFinesManage), controllers.RecordLedgerEntry)
 
 	// reader routes
 	readerRoutes := r.Group("/reader")
-	readerRoutes.Use(middlewares.AuthReader)
-	readerRoutes.POST("/book/search", controllers.SearchBook)
-	readerRoutes.POST("/issue/request", controllers.IssueRequest)
-	readerRoutes.POST("/return/request", controllers.ReturnRequest)
+	readerRoutes.Use(middlewares.Authenticate)
+	readerRoutes.POST("/book/search", middlewares.RequirePermission(middlewares.PermCatalogSearch), controllers.SearchBook)
+	readerRoutes.GET("/book/suggest", middlewares.RequirePermission(middlewares.PermCatalogSearch), controllers.SuggestBooks)
+	readerRoutes.POST("/issue/request", middlewares.RequirePermission(middlewares.PermLoansRequest), controllers.IssueRequest)
+	readerRoutes.POST("/return/request", middlewares.RequirePermission(middlewares.PermLoansRequest), controllers.ReturnRequest)
+	readerRoutes.POST("/renew/request", middlewares.RequirePermission(middlewares.PermLoansRequest), controllers.RenewRequest)
+	readerRoutes.POST("/hold", middlewares.RequirePermission(middlewares.PermLoansRequest), controllers.PlaceHold)
+	readerRoutes.GET("/holds", middlewares.RequirePermission(middlewares.PermLoansRequest), controllers.RetrieveReaderHolds)
+	readerRoutes.DELETE("/hold/:id", middlewares.RequirePermission(middlewares.PermLoansRequest), controllers.CancelHold)
+	readerRoutes.GET("/balance", middlewares.RequirePermission(middlewares.PermAccountRead), controllers.RetrieveBalance)
+	readerRoutes.GET("/card", middlewares.RequirePermission(middlewares.PermAccountRead), controllers.RetrieveReaderCard)
+	readerRoutes.PUT("/pin", middlewares.RequirePermission(middlewares.PermAccountWrite), controllers.SetReaderPIN)
+
+	// self-service kiosk routes, the reader signs in with card and pin on every request
+	kioskRoutes := r.Group("/kiosk")
+	kioskRoutes.Use(middlewares.AuthenticateKiosk)
+	kioskRoutes.POST("/account", controllers.KioskAccount)
+	kioskRoutes.POST("/checkout", controllers.KioskCheckout)
+	kioskRoutes.POST("/checkin", controllers.KioskCheckin)
 
 	// admin + reader routes
 	userRoutes := r.Group("/user")
-	userRoutes.Use(middlewares.AuthAdminAndReader)
-	userRoutes.GET("/issues", controllers.RetrieveRequets)
-	userRoutes.GET("/registry", controllers.RetrieveRegistry)
+	userRoutes.Use(middlewares.Authenticate)
+	userRoutes.GET("/issues", middlewares.RequirePermission(middlewares.PermRequestsRead), controllers.RetrieveRequets)
+	userRoutes.GET("/registry", middlewares.RequirePermission(middlewares.PermRegistryRead), controllers.RetrieveRegistry)
 
 	// public routes
 	r.GET("/book/lib/:id", controllers.RetrieveBooksByLib)
-
-	r.Run("0.0.0.0:3001")
+	r.GET("/item/:token", controllers.RetrieveItem)
+	r.GET("/item/:token/qr", controllers.RetrieveItemCode)
 }
@@ -0,0 +1,189 @@
+package marc
+
+import (
+	"project/libraryManagement/isbn"
+	"project/libraryManagement/models"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// tags ToBook reads, the fields of any other tag are reported as unmapped
+var mappedTags = map[string]bool{
+	"008": true, // publication year and language
+	"020": true, // isbn
+	"050": true, // library of congress call number
+	"082": true, // dewey call number
+	"090": true, // local call number
+	"100": true, // main author
+	"245": true, // title
+	"250": true, // edition
+	"260": true, // publisher and year, before rda
+	"264": true, // publisher and year
+	"650": true, // subjects
+	"700": true, // other authors
+	"876": true, // items, one per copy
+}
+
+var yearPattern = regexp.MustCompile(`\d{4}`)
+
+// strip the isbd punctuation cataloguers end values with, e.g. "Dune :" or "Herbert, Frank.",
+// keeping the period of an initial such as "Tolkien, J. R. R."
+func clean(value string) string {
+	value = strings.TrimRight(strings.TrimSpace(value), " /:;,=")
+
+	if strings.HasSuffix(value, ".") {
+		words := strings.Fields(value)
+		last := strings.TrimSuffix(words[len(words)-1], ".")
+		if len([]rune(last)) > 1 && !strings.Contains(last, ".") {
+			value = strings.TrimSuffix(value, ".")
+		}
+	}
+
+	return strings.TrimSpace(value)
+}
+
+// values of the subfields with the given codes joined, e.g. a call number "QA76.73 .G63"
+func join(field Field, separator string, codes ...string) string {
+	var values []string
+	for _, subfield := range field.Subfields {
+		for _, code := range codes {
+			if subfield.Code == code {
+				if value := clean(subfield.Value); value != "" {
+					values = append(values, value)
+				}
+			}
+		}
+	}
+
+	return strings.Join(values, separator)
+}
+
+// append a value unless it is empty or already there
+func appendUnique(values models.StringArray, value string) models.StringArray {
+	if value == "" {
+		return values
+	}
+	for _, existing := range values {
+		if strings.EqualFold(existing, value) {
+			return values
+		}
+	}
+
+	return append(values, value)
+}
+
+// the first valid isbn of the record, 020 $a holds qualifiers after the number such as "(pbk.)".
+// Without a valid one the first is kept so that the import reports it
+func isbnOf(record Record) string {
+	first := ""
+	for _, field := range record.FieldsOf("020") {
+		words := strings.Fields(field.Subfield("a"))
+		if len(words) == 0 {
+			continue
+		}
+		if isbn.Valid(words[0]) {
+			return words[0]
+		}
+		if first == "" {
+			first = words[0]
+		}
+	}
+
+	return first
+}
+
+// publisher and year of the publication statement, 264 with second indicator 1 or the older 260
+func publicationOf(record Record) (string, string) {
+	for _, field := range record.FieldsOf("264") {
+		if field.Ind2 == "1" {
+			return clean(field.Subfield("b")), field.Subfield("c")
+		}
+	}
+	if fields := record.FieldsOf("260"); len(fields) > 0 {
+		return clean(fields[0].Subfield("b")), fields[0].Subfield("c")
+	}
+
+	return "", ""
+}
+
+// the book of a record with the number of its items (876), and the tags of the fields that weren't mapped:
+// isbn (020), authors (100, 700), title and subtitle (245), edition (250), publisher and year (264 or 260, else 008),
+// subjects with their subdivisions (650), language (008) and call number (090, else 050 or 082)
+func ToBook(record Record) (models.BookInventory, uint, []string) {
+	book := models.BookInventory{ISBN: isbnOf(record), Authors: models.StringArray{}, Subjects: models.StringArray{}}
+
+	unmapped := map[string]bool{}
+	for _, field := range record.Fields {
+		if !mappedTags[field.Tag] {
+			unmapped[field.Tag] = true
+		}
+	}
+
+	if fields := record.FieldsOf("245"); len(fields) > 0 {
+		book.Title = join(fields[0], ": ", "a", "b")
+	}
+	// "2nd ed." keeps its period
+	if fields := record.FieldsOf("250"); len(fields) > 0 {
+		book.Version = strings.TrimRight(strings.TrimSpace(fields[0].Subfield("a")), " /:;,=")
+	}
+
+	for _, tag := range []string{"100", "700"} {
+		for _, field := range record.FieldsOf(tag) {
+			book.Authors = appendUnique(book.Authors, clean(field.Subfield("a")))
+		}
+	}
+	for _, field := range record.FieldsOf("650") {
+		book.Subjects = appendUnique(book.Subjects, join(field, " -- ", "a", "x", "y", "z"))
+	}
+
+	publisher, date := publicationOf(record)
+	book.Publisher = publisher
+
+	for _, field := range record.FieldsOf("008") {
+		// date 1 of a single or probable date, and the language code
+		if len(field.Value) >= 11 && strings.ContainsRune("sqrtm", rune(field.Value[6])) {
+			if year, err := strconv.ParseUint(field.Value[7:11], 10, 32); err == nil {
+				book.Year = uint(year)
+			}
+		}
+		if len(field.Value) >= 38 {
+			book.Language = languageOf(field.Value[35:38])
+		}
+	}
+	if year := yearPattern.FindString(date); book.Year == 0 && year != "" {
+		parsed, _ := strconv.ParseUint(year, 10, 32)
+		book.Year = uint(parsed)
+	}
+
+	for _, tag := range []string{"090", "050", "082"} {
+		if fields := record.FieldsOf(tag); len(fields) > 0 {
+			book.CallNumber = join(fields[0], " ", "a", "b")
+			break
+		}
+	}
+
+	tags := make([]string, 0, len(unmapped))
+	for tag := range unmapped {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+
+	return book, uint(len(record.FieldsOf("876"))), tags
+}
+
+// iso 639-1 code of a marc language code, unknown codes are kept as they are and blank or undetermined ones dropped
+func languageOf(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	for short, long := range languageCodes {
+		if long == code {
+			return short
+		}
+	}
+
+	if len(code) != 3 || code == "und" || code == "zxx" || strings.Trim(code, "abcdefghijklmnopqrstuvwxyz") != "" {
+		return ""
+	}
+	return code
+}
@@ -0,0 +1,186 @@
+package marc
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"unicode/utf8"
+)
+
+// delimiters of iso 2709
+const (
+	subfieldDelimiter = 0x1f
+	fieldTerminator   = 0x1e
+	recordTerminator  = 0x1d
+)
+
+// the lengths iso 2709 gives its parts
+const (
+	leaderLength    = 24
+	directoryEntry  = 12
+	maxRecordLength = 99999
+)
+
+// a record that couldn't be read, the records after it still are
+var ErrInvalidRecord = errors.New("invalid marc record")
+
+func invalid(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrInvalidRecord, fmt.Sprintf(format, args...))
+}
+
+// the record as iso 2709 (binary marc), with the record length and base address of its leader filled in
+func (r Record) MarshalBinary() ([]byte, error) {
+	var directory, data bytes.Buffer
+
+	for _, field := range r.Fields {
+		start := data.Len()
+		if field.Control() {
+			data.WriteString(field.Value)
+		} else {
+			data.WriteString(indicator(field.Ind1) + indicator(field.Ind2))
+			for _, subfield := range field.Subfields {
+				data.WriteByte(subfieldDelimiter)
+				data.WriteString(subfield.Code + subfield.Value)
+			}
+		}
+		data.WriteByte(fieldTerminator)
+
+		if len(field.Tag) != 3 {
+			return nil, invalid("tag %q must have 3 characters", field.Tag)
+		}
+		fmt.Fprintf(&directory, "%s%04d%05d", field.Tag, data.Len()-start, start)
+	}
+	directory.WriteByte(fieldTerminator)
+	data.WriteByte(recordTerminator)
+
+	base := leaderLength + directory.Len()
+	length := base + data.Len()
+	if length > maxRecordLength {
+		return nil, invalid("the record is longer than %d bytes", maxRecordLength)
+	}
+
+	leader := []byte(BookLeader)
+	if len(r.Leader) == leaderLength {
+		leader = []byte(r.Leader)
+	}
+	copy(leader[0:5], fmt.Sprintf("%05d", length))
+	copy(leader[12:17], fmt.Sprintf("%05d", base))
+
+	return append(append(leader, directory.Bytes()...), data.Bytes()...), nil
+}
+
+// a missing indicator is blank
+func indicator(value string) string {
+	if value == "" {
+		return " "
+	}
+
+	return value[:1]
+}
+
+// read a record from iso 2709, fields are found through the directory of the record
+func (r *Record) UnmarshalBinary(data []byte) error {
+	data = bytes.TrimSuffix(data, []byte{recordTerminator})
+	if len(data) < leaderLength {
+		return invalid("the record is shorter than its leader")
+	}
+
+	leader := string(data[:leaderLength])
+	base, err := strconv.Atoi(leader[12:17])
+	if err != nil || base <= leaderLength || base > len(data) {
+		return invalid("the leader has no valid base address")
+	}
+
+	// records in marc-8 (leader/09 blank) are only read when they hold no other character than ascii
+	if !utf8.Valid(data) {
+		if leader[9] != 'a' {
+			return invalid("only unicode (utf-8) records can be read, this one is in marc-8")
+		}
+		return invalid("the record is not valid utf-8")
+	}
+
+	directory := bytes.TrimSuffix(data[leaderLength:base], []byte{fieldTerminator})
+	if len(directory)%directoryEntry != 0 {
+		return invalid("the directory is %d bytes long, not a multiple of %d", len(directory), directoryEntry)
+	}
+
+	record := Record{Leader: leader}
+	for entry := 0; entry < len(directory); entry += directoryEntry {
+		tag := string(directory[entry : entry+3])
+		length, err := strconv.Atoi(string(directory[entry+3 : entry+7]))
+		if err != nil || length < 1 {
+			return invalid("field %s has no valid length", tag)
+		}
+		start, err := strconv.Atoi(string(directory[entry+7 : entry+12]))
+		if err != nil || start < 0 {
+			return invalid("field %s has no valid start", tag)
+		}
+		// compared by what is left of the record so that the sum can't overflow
+		if start > len(data)-base || length > len(data)-base-start {
+			return invalid("field %s ends after the record", tag)
+		}
+
+		content := bytes.TrimSuffix(data[base+start:base+start+length], []byte{fieldTerminator})
+		field := Field{Tag: tag}
+		if field.Control() {
+			field.Value = string(content)
+			record.Fields = append(record.Fields, field)
+			continue
+		}
+
+		if len(content) < 2 {
+			return invalid("field %s has no indicators", tag)
+		}
+		field.Ind1, field.Ind2 = string(content[0]), string(content[1])
+
+		// the text before the first delimiter has no subfield code, it is not part of the field
+		parts := bytes.Split(content[2:], []byte{subfieldDelimiter})
+		for _, part := range parts[1:] {
+			if len(part) > 0 {
+				field.Subfields = append(field.Subfields, Subfield{Code: string(part[:1]), Value: string(part[1:])})
+			}
+		}
+		record.Fields = append(record.Fields, field)
+	}
+
+	*r = record
+	return nil
+}
+
+// reads the records of an iso 2709 file one by one. An invalid record is reported with ErrInvalidRecord
+// and skipped, the line breaks some systems put between records are ignored
+type Reader struct {
+	r *bufio.Reader
+}
+
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: bufio.NewReader(r)}
+}
+
+// the next record, io.EOF after the last one
+func (x *Reader) Read() (Record, error) {
+	var record Record
+
+	for {
+		data, err := x.r.ReadBytes(recordTerminator)
+		if err != nil && err != io.EOF {
+			return record, err
+		}
+
+		data = bytes.TrimLeft(data, "\r\n\t ")
+		if len(data) == 0 {
+			if err == io.EOF {
+				return record, io.EOF
+			}
+			continue
+		}
+		if len(data) > maxRecordLength {
+			return record, invalid("the record is longer than %d bytes", maxRecordLength)
+		}
+
+		return record, record.UnmarshalBinary(data)
+	}
+}
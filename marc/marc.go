@@ -0,0 +1,173 @@
+package marc
+
+import (
+	"fmt"
+	"project/libraryManagement/models"
+	"strconv"
+	"strings"
+)
+
+// leader of a book record: a new (n) language material (a) monograph (m) in unicode (a),
+// the record length and base address are filled in when it is written as iso 2709
+const BookLeader = "00000nam a2200000 i 4500"
+
+// marc language codes of the iso 639-1 codes books are usually tagged with, other codes are kept as they are
+var languageCodes = map[string]string{
+	"ar": "ara",
+	"bn": "ben",
+	"de": "ger",
+	"en": "eng",
+	"es": "spa",
+	"fr": "fre",
+	"hi": "hin",
+	"it": "ita",
+	"ja": "jpn",
+	"nl": "dut",
+	"pt": "por",
+	"ru": "rus",
+	"zh": "chi",
+}
+
+// a subfield of a data field, e.g. $a Dune
+type Subfield struct {
+	Code  string
+	Value string
+}
+
+// a control field (001 to 009) holds a value, a data field its indicators and subfields
+type Field struct {
+	Tag       string
+	Value     string
+	Ind1      string
+	Ind2      string
+	Subfields []Subfield
+}
+
+// whether the field is a control field
+func (f Field) Control() bool {
+	return f.Tag < "010"
+}
+
+// the first value of a subfield, empty when the field has none
+func (f Field) Subfield(code string) string {
+	for _, subfield := range f.Subfields {
+		if subfield.Code == code {
+			return subfield.Value
+		}
+	}
+
+	return ""
+}
+
+// a bibliographic record
+type Record struct {
+	Leader string
+	Fields []Field
+}
+
+// the fields with a tag
+func (r Record) FieldsOf(tag string) []Field {
+	var fields []Field
+	for _, field := range r.Fields {
+		if field.Tag == tag {
+			fields = append(fields, field)
+		}
+	}
+
+	return fields
+}
+
+// add a control field, empty values are left out
+func (r *Record) AddControl(tag string, value string) {
+	if value != "" {
+		r.Fields = append(r.Fields, Field{Tag: tag, Value: value})
+	}
+}
+
+// add a data field with its two indicators, e.g. "10", empty subfields are left out and so is a field without any
+func (r *Record) AddField(tag string, indicators string, subfields ...Subfield) {
+	field := Field{Tag: tag, Ind1: indicators[:1], Ind2: indicators[1:2]}
+	for _, subfield := range subfields {
+		if subfield.Value != "" {
+			field.Subfields = append(field.Subfields, subfield)
+		}
+	}
+
+	if len(field.Subfields) > 0 {
+		r.Fields = append(r.Fields, field)
+	}
+}
+
+// fixed length data of a book (008): the publication year and language, everything else is left uncoded
+func fixedData(book models.BookInventory) string {
+	dateType, year := "n", "uuuu"
+	if book.Year > 0 {
+		dateType, year = "s", fmt.Sprintf("%04d", book.Year)
+	}
+
+	language := book.Language
+	if code, ok := languageCodes[language]; ok {
+		language = code
+	}
+	if len(language) != 3 {
+		language = "|||"
+	}
+
+	return "      " + dateType + year + "    " + "xx " + strings.Repeat("|", 17) + language + " d"
+}
+
+// the record of a book: isbn (020), call number (090), authors (100, 700), title (245), edition (250),
+// publisher and year (264) and subjects (650), with an item (876) for each of its copies
+func FromBook(book models.BookInventory, copies []models.BookCopy) Record {
+	record := Record{Leader: BookLeader}
+
+	record.AddControl("001", strconv.FormatUint(uint64(book.ID), 10))
+	record.AddControl("008", fixedData(book))
+
+	record.AddField("020", "  ", Subfield{"a", book.ISBN})
+	record.AddField("090", "  ", Subfield{"a", book.CallNumber})
+
+	// the title is filed under the main author when there is one
+	titleIndicators := "00"
+	if len(book.Authors) > 0 {
+		record.AddField("100", "1 ", Subfield{"a", book.Authors[0]})
+		titleIndicators = "10"
+	}
+	record.AddField("245", titleIndicators, Subfield{"a", book.Title})
+	record.AddField("250", "  ", Subfield{"a", book.Version})
+
+	year := ""
+	if book.Year > 0 {
+		year = strconv.FormatUint(uint64(book.Year), 10)
+	}
+	record.AddField("264", " 1", Subfield{"b", book.Publisher}, Subfield{"c", year})
+
+	for _, subject := range book.Subjects {
+		record.AddField("650", " 4", Subfield{"a", subject})
+	}
+	if len(book.Authors) > 1 {
+		for _, author := range book.Authors[1:] {
+			record.AddField("700", "1 ", Subfield{"a", author})
+		}
+	}
+
+	for _, item := range copies {
+		acquired, accession := "", ""
+		if item.AcquisitionDate != nil {
+			acquired = item.AcquisitionDate.Format("20060102")
+		}
+		if item.AccessionNumber > 0 {
+			accession = strconv.FormatUint(uint64(item.AccessionNumber), 10)
+		}
+		record.AddField("876", "  ",
+			Subfield{"a", strconv.FormatUint(uint64(item.ID), 10)},
+			Subfield{"p", item.Barcode},
+			Subfield{"t", accession},
+			Subfield{"j", item.Status},
+			Subfield{"d", acquired},
+			Subfield{"x", item.Condition},
+		)
+	}
+
+	return record
+}
@@ -0,0 +1,187 @@
+package marc
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"project/libraryManagement/models"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFromBook(t *testing.T) {
+	book := models.BookInventory{ID: 7, ISBN: "9780441172719", Title: "Dune", Authors: models.StringArray{"Frank Herbert", "John Schoenherr"}, Subjects: models.StringArray{"Science fiction"},
+		Publisher: "Chilton", Year: 1965, Language: "en"}
+	record := FromBook(book, []models.BookCopy{{ID: 3, Barcode: "00000003", AccessionNumber: 3, Status: "available"}})
+
+	tags := []string{}
+	for _, field := range record.Fields {
+		tags = append(tags, field.Tag)
+	}
+	assert.Equal(t, []string{"001", "008", "020", "100", "245", "264", "650", "700", "876"}, tags)
+
+	assert.Equal(t, "7", record.Fields[0].Value)
+	assert.Len(t, record.Fields[1].Value, 40)
+	assert.Equal(t, "1965", record.Fields[1].Value[7:11])
+	assert.Equal(t, "eng", record.Fields[1].Value[35:38])
+	assert.Equal(t, Field{Tag: "245", Ind1: "1", Ind2: "0", Subfields: []Subfield{{"a", "Dune"}}}, record.Fields[4])
+	assert.Equal(t, []Subfield{{"b", "Chilton"}, {"c", "1965"}}, record.Fields[5].Subfields)
+	assert.Equal(t, []Subfield{{"a", "3"}, {"p", "00000003"}, {"t", "3"}, {"j", "available"}}, record.Fields[8].Subfields)
+
+	// without authors the title is its own entry
+	record = FromBook(models.BookInventory{ID: 8, Title: "Anonymous"}, nil)
+	assert.Equal(t, "0", record.Fields[2].Ind1)
+	assert.Equal(t, "uuuu", record.Fields[1].Value[7:11])
+}
+
+func TestXMLWriter(t *testing.T) {
+	var out bytes.Buffer
+
+	writer := NewXMLWriter(&out)
+	assert.NoError(t, writer.Write(FromBook(models.BookInventory{ID: 1, Title: "Fish & <Chips>"}, nil)))
+	assert.NoError(t, writer.Write(FromBook(models.BookInventory{ID: 2, Title: "Emma"}, nil)))
+	assert.NoError(t, writer.Close())
+
+	var collection struct {
+		XMLName xml.Name    `xml:"http://www.loc.gov/MARC21/slim collection"`
+		Records []xmlRecord `xml:"record"`
+	}
+	assert.NoError(t, xml.Unmarshal(out.Bytes(), &collection))
+	assert.Len(t, collection.Records, 2)
+	assert.Equal(t, "Fish & <Chips>", collection.Records[0].DataFields[0].Subfields[0].Value)
+
+	// an empty export is still a document
+	out.Reset()
+	assert.NoError(t, NewXMLWriter(&out).Close())
+	assert.True(t, strings.HasSuffix(out.String(), `<collection xmlns="http://www.loc.gov/MARC21/slim"></collection>`+"\n"))
+}
+
+// a record of a legacy system, catalogued before rda with isbd punctuation
+func legacyRecord() Record {
+	record := Record{Leader: "00000cam a2200000 a 4500"}
+	record.AddControl("001", "ocm00123456")
+	record.AddControl("008", "650101s1965    pau           000 1 eng d")
+	record.AddField("020", "  ", Subfield{"a", "0306406153"})
+	record.AddField("020", "  ", Subfield{"a", "0441172717 (pbk.)"})
+	record.AddField("035", "  ", Subfield{"a", "(OCoLC)123456"})
+	record.AddField("050", "00", Subfield{"a", "PS3558.E63"}, Subfield{"b", "D8 1965"})
+	record.AddField("100", "1 ", Subfield{"a", "Herbert, Frank."}, Subfield{"d", "1920-1986"})
+	record.AddField("245", "10", Subfield{"a", "Dune :"}, Subfield{"b", "a novel /"}, Subfield{"c", "Frank Herbert."})
+	record.AddField("250", "  ", Subfield{"a", "1st ed."})
+	record.AddField("260", "  ", Subfield{"a", "Philadelphia :"}, Subfield{"b", "Chilton Books,"}, Subfield{"c", "c1965."})
+	record.AddField("650", " 0", Subfield{"a", "Dune (Imaginary place)"}, Subfield{"v", "Fiction."})
+	record.AddField("650", " 0", Subfield{"a", "Science fiction"}, Subfield{"x", "History and criticism."})
+	record.AddField("700", "1 ", Subfield{"a", "Tolkien, J. R. R."})
+
+	return record
+}
+
+func TestToBook(t *testing.T) {
+	book, copies, unmapped := ToBook(legacyRecord())
+
+	assert.Equal(t, "0441172717", book.ISBN)
+	assert.Equal(t, "Dune: a novel", book.Title)
+	assert.Equal(t, models.StringArray{"Herbert, Frank", "Tolkien, J. R. R."}, book.Authors)
+	assert.Equal(t, "1st ed.", book.Version)
+	assert.Equal(t, "Chilton Books", book.Publisher)
+	assert.Equal(t, models.StringArray{"Dune (Imaginary place)", "Science fiction -- History and criticism"}, book.Subjects)
+	assert.Equal(t, uint(1965), book.Year)
+	assert.Equal(t, "en", book.Language)
+	assert.Equal(t, "PS3558.E63 D8 1965", book.CallNumber)
+	assert.Equal(t, uint(0), copies)
+	assert.Equal(t, []string{"001", "035"}, unmapped)
+
+	// an exported book reads back, with a copy per item
+	exported := models.BookInventory{ID: 7, ISBN: "9780441172719", Title: "Dune", Authors: models.StringArray{"Frank Herbert", "John Schoenherr"}, Subjects: models.StringArray{"Science fiction"},
+		Publisher: "Chilton", Version: "2nd ed.", CallNumber: "823.914 HER", Year: 1965, Language: "fr"}
+	book, copies, unmapped = ToBook(FromBook(exported, []models.BookCopy{{ID: 3}, {ID: 4}}))
+	exported.ID = 0
+	assert.Equal(t, exported, book)
+	assert.Equal(t, uint(2), copies)
+	assert.Equal(t, []string{"001"}, unmapped)
+
+	// without a 008 the year comes from the publication statement
+	record := Record{}
+	record.AddField("245", "00", Subfield{"a", "Anonymous."})
+	record.AddField("264", " 4", Subfield{"c", "©2001"})
+	record.AddField("264", " 1", Subfield{"b", "Penguin,"}, Subfield{"c", "[2003]"})
+	book, _, _ = ToBook(record)
+	assert.Equal(t, "Anonymous", book.Title)
+	assert.Equal(t, "Penguin", book.Publisher)
+	assert.Equal(t, uint(2003), book.Year)
+	assert.Equal(t, "", book.Language)
+}
+
+func TestISO2709(t *testing.T) {
+	data, err := legacyRecord().MarshalBinary()
+	assert.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("%05d", len(data)), string(data[:5]))
+	assert.Equal(t, byte(recordTerminator), data[len(data)-1])
+
+	var record Record
+	assert.NoError(t, record.UnmarshalBinary(data))
+	assert.Equal(t, legacyRecord().Fields, record.Fields)
+	assert.Equal(t, string(data[:24]), record.Leader)
+
+	// a broken record is skipped, the line breaks between records are ignored
+	unicode, _ := FromBook(models.BookInventory{ID: 2, Title: "Café Society"}, nil).MarshalBinary()
+	broken := append([]byte("00042nam a2200099 i 4500"), recordTerminator)
+	reader := NewReader(bytes.NewReader(bytes.Join([][]byte{data, broken, unicode}, []byte("\n"))))
+
+	record, err = reader.Read()
+	assert.NoError(t, err)
+	assert.Equal(t, "ocm00123456", record.Fields[0].Value)
+
+	_, err = reader.Read()
+	assert.ErrorIs(t, err, ErrInvalidRecord)
+
+	record, err = reader.Read()
+	assert.NoError(t, err)
+	assert.Equal(t, "Café Society", record.FieldsOf("245")[0].Subfield("a"))
+
+	_, err = reader.Read()
+	assert.Equal(t, io.EOF, err)
+
+	// marc-8 records are only read when they hold nothing but ascii
+	marc8 := bytes.Replace(unicode, []byte("Café"), []byte("Caf\xe2e"), 1)
+	marc8[9] = ' '
+	assert.ErrorContains(t, record.UnmarshalBinary(marc8), "marc-8")
+
+	// directory entries with negative or out of range lengths and starts are refused, not sliced
+	for _, entry := range []string{"245-00100000", "245000000000", "24500050-001", "245999900000", "245000599999"} {
+		broken := []byte("00000nam a2200037 i 4500" + entry + "\x1e" + "00\x1faDune\x1e\x1d")
+		assert.ErrorIs(t, record.UnmarshalBinary(broken), ErrInvalidRecord, entry)
+	}
+}
+
+func TestXMLReader(t *testing.T) {
+	var out bytes.Buffer
+
+	writer := NewXMLWriter(&out)
+	assert.NoError(t, writer.Write(legacyRecord()))
+	assert.NoError(t, writer.Write(FromBook(models.BookInventory{ID: 2, Title: "Emma"}, nil)))
+	assert.NoError(t, writer.Close())
+
+	reader := NewXMLReader(&out)
+	record, err := reader.Read()
+	assert.NoError(t, err)
+	assert.Equal(t, legacyRecord(), record)
+	assert.Equal(t, 3, reader.Line())
+
+	record, err = reader.Read()
+	assert.NoError(t, err)
+	assert.Equal(t, "Emma", record.FieldsOf("245")[0].Subfield("a"))
+
+	_, err = reader.Read()
+	assert.Equal(t, io.EOF, err)
+
+	// a single record with a namespace prefix
+	single := `<marc:record xmlns:marc="http://www.loc.gov/MARC21/slim"><marc:leader>00000nam a2200000 i 4500</marc:leader>` +
+		`<marc:datafield tag="245" ind1="0" ind2="0"><marc:subfield code="a">Ulysses</marc:subfield></marc:datafield></marc:record>`
+	record, err = NewXMLReader(strings.NewReader(single)).Read()
+	assert.NoError(t, err)
+	assert.Equal(t, []Field{{Tag: "245", Ind1: "0", Ind2: "0", Subfields: []Subfield{{"a", "Ulysses"}}}}, record.Fields)
+}
@@ -0,0 +1,161 @@
+package marc
+
+import (
+	"encoding/xml"
+	"io"
+)
+
+// namespace of marcxml documents
+const Namespace = "http://www.loc.gov/MARC21/slim"
+
+type xmlSubfield struct {
+	Code  string `xml:"code,attr"`
+	Value string `xml:",chardata"`
+}
+
+type xmlControlField struct {
+	Tag   string `xml:"tag,attr"`
+	Value string `xml:",chardata"`
+}
+
+type xmlDataField struct {
+	Tag       string        `xml:"tag,attr"`
+	Ind1      string        `xml:"ind1,attr"`
+	Ind2      string        `xml:"ind2,attr"`
+	Subfields []xmlSubfield `xml:"subfield"`
+}
+
+// a record as marcxml: the leader, then the control fields, then the data fields
+type xmlRecord struct {
+	XMLName       xml.Name          `xml:"record"`
+	Leader        string            `xml:"leader"`
+	ControlFields []xmlControlField `xml:"controlfield"`
+	DataFields    []xmlDataField    `xml:"datafield"`
+}
+
+func toXML(record Record) xmlRecord {
+	out := xmlRecord{Leader: record.Leader}
+
+	for _, field := range record.Fields {
+		if field.Control() {
+			out.ControlFields = append(out.ControlFields, xmlControlField{Tag: field.Tag, Value: field.Value})
+			continue
+		}
+
+		data := xmlDataField{Tag: field.Tag, Ind1: field.Ind1, Ind2: field.Ind2}
+		for _, subfield := range field.Subfields {
+			data.Subfields = append(data.Subfields, xmlSubfield(subfield))
+		}
+		out.DataFields = append(out.DataFields, data)
+	}
+
+	return out
+}
+
+func fromXML(in xmlRecord) Record {
+	record := Record{Leader: in.Leader}
+
+	for _, field := range in.ControlFields {
+		record.Fields = append(record.Fields, Field{Tag: field.Tag, Value: field.Value})
+	}
+	for _, data := range in.DataFields {
+		field := Field{Tag: data.Tag, Ind1: indicator(data.Ind1), Ind2: indicator(data.Ind2)}
+		for _, subfield := range data.Subfields {
+			field.Subfields = append(field.Subfields, Subfield(subfield))
+		}
+		record.Fields = append(record.Fields, field)
+	}
+
+	return record
+}
+
+// reads the records of a marcxml document one by one, whether they are in a collection or not
+type XMLReader struct {
+	decoder *xml.Decoder
+	line    int
+}
+
+func NewXMLReader(r io.Reader) *XMLReader {
+	return &XMLReader{decoder: xml.NewDecoder(r)}
+}
+
+// the next record, io.EOF after the last one
+func (x *XMLReader) Read() (Record, error) {
+	for {
+		token, err := x.decoder.Token()
+		if err != nil {
+			return Record{}, err
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "record" {
+			continue
+		}
+
+		x.line, _ = x.decoder.InputPos()
+		var record xmlRecord
+		if err := x.decoder.DecodeElement(&record, &start); err != nil {
+			return Record{}, err
+		}
+		return fromXML(record), nil
+	}
+}
+
+// line of the document the last record read starts at
+func (x *XMLReader) Line() int {
+	return x.line
+}
+
+// writes records one by one into a marcxml collection, nothing is buffered between two records
+type XMLWriter struct {
+	encoder *xml.Encoder
+	w       io.Writer
+	started bool
+}
+
+func NewXMLWriter(w io.Writer) *XMLWriter {
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+
+	return &XMLWriter{encoder: encoder, w: w}
+}
+
+// the xml declaration and the opening collection tag, before the first record
+func (x *XMLWriter) start() error {
+	if x.started {
+		return nil
+	}
+	x.started = true
+
+	if _, err := io.WriteString(x.w, xml.Header); err != nil {
+		return err
+	}
+
+	return x.encoder.EncodeToken(xml.StartElement{Name: xml.Name{Space: Namespace, Local: "collection"}})
+}
+
+// write a record
+func (x *XMLWriter) Write(record Record) error {
+	if err := x.start(); err != nil {
+		return err
+	}
+
+	return x.encoder.Encode(toXML(record))
+}
+
+// close the collection, an empty export is still a valid document
+func (x *XMLWriter) Close() error {
+	if err := x.start(); err != nil {
+		return err
+	}
+
+	if err := x.encoder.EncodeToken(xml.EndElement{Name: xml.Name{Space: Namespace, Local: "collection"}}); err != nil {
+		return err
+	}
+	if err := x.encoder.Flush(); err != nil {
+		return err
+	}
+
+	_, err := io.WriteString(x.w, "\n")
+	return err
+}
@@ -0,0 +1,48 @@
+package middlewares
+
+import (
+	"net/http"
+	"project/libraryManagement/models"
+	"project/libraryManagement/tenant"
+	"project/libraryManagement/utils"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const kioskKey = "kiosk"
+
+// retrieve the kiosk set by AuthenticateKiosk
+func CurrentKiosk(c *gin.Context) (*models.Kiosk, bool) {
+	value, ok := c.Get(kioskKey)
+	if !ok {
+		return nil, false
+	}
+
+	kiosk, ok := value.(*models.Kiosk)
+	return kiosk, ok
+}
+
+// kiosk authentication middleware, validates the device credential and binds the request to its library
+func AuthenticateKiosk(c *gin.Context) {
+	credential := strings.TrimPrefix(c.Request.Header.Get("Authorization"), "Kiosk ")
+	if credential == "" {
+		c.IndentedJSON(http.StatusUnauthorized, gin.H{"error": "no kiosk credential provided"})
+		c.Abort()
+		return
+	}
+
+	kiosk, err := utils.FindKiosk(credential)
+	if err != nil {
+		c.IndentedJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		c.Abort()
+		return
+	}
+
+	c.Set(kioskKey, kiosk)
+
+	// a kiosk only ever works with the library it was registered for
+	c.Request = c.Request.WithContext(tenant.WithLibrary(c.Request.Context(), kiosk.LibID))
+
+	c.Next()
+}
@@ -1,203 +1,92 @@
 package middlewares
 
 import (
-	"fmt"
 	"net/http"
-	"os"
+	"project/libraryManagement/config"
+	"project/libraryManagement/models"
+	"project/libraryManagement/tenant"
+	"project/libraryManagement/utils"
+	"strings"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
 )
 
-// authentication middleware
-func AuthOwner(c *gin.Context) {
-	clientToken := c.Request.Header.Get("Authorization")
+const principalKey = "principal"
 
-	if clientToken == "" {
-
-		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "no authorization token provided"})
-
-		c.Abort()
-
-		return
-
-	}
-	secret := []byte(os.Getenv("SECRET"))
-
-	token, err := jwt.Parse(clientToken, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-
-		return secret, nil
-	})
-
-	if err != nil {
-		c.IndentedJSON(http.StatusInternalServerError, gin.H{"message": "error validating token", "error": err.Error()})
-		c.Abort()
-		return
-	}
-
-	if !token.Valid {
-		c.IndentedJSON(http.StatusInternalServerError, gin.H{"message": "invalid token"})
-		c.Abort()
-		return
-	}
-
-	claims, _ := token.Claims.(jwt.MapClaims)
-	fmt.Printf("claims %v", claims["role"])
-
-	if claims["role"] != "owner" {
-		c.IndentedJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized, only owner can access the route"})
-		c.Abort()
-		return
-	}
-
-	c.Set("email", claims["email"])
-
-	c.Next()
+// authenticated user attached to the request
+type Principal struct {
+	User      models.Users
+	Library   models.Library
+	Role      string
+	SessionID uint
 }
 
-// validate Admin
-func AuthAdmin(c *gin.Context) {
-	clientToken := c.Request.Header.Get("Authorization")
-	if clientToken == "" {
-
-		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "no authorization token provided"})
-
-		c.Abort()
-
-		return
-
-	}
-	secret := []byte(os.Getenv("SECRET"))
-
-	token, err := jwt.Parse(clientToken, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-
-		return secret, nil
-	})
-
-	if err != nil {
-		c.IndentedJSON(http.StatusInternalServerError, gin.H{"message": "error validating token", "error": err.Error()})
-		c.Abort()
-		return
-	}
-
-	if !token.Valid {
-		c.IndentedJSON(http.StatusInternalServerError, gin.H{"message": "invalid token"})
-		c.Abort()
-		return
-	}
-
-	claims, _ := token.Claims.(jwt.MapClaims)
-	fmt.Printf("claims %v", claims["role"])
+// check if the principal's role grants the permission
+func (p *Principal) Can(permission string) bool {
+	return HasPermission(p.Role, permission)
+}
 
-	if claims["role"] != "admin" {
-		c.IndentedJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized, only admin can access the route"})
-		c.Abort()
-		return
+// retrieve the principal set by Authenticate
+func CurrentPrincipal(c *gin.Context) (*Principal, bool) {
+	value, ok := c.Get(principalKey)
+	if !ok {
+		return nil, false
 	}
 
-	c.Set("email", claims["email"])
-
-	c.Next()
+	principal, ok := value.(*Principal)
+	return principal, ok
 }
 
-// validate reader
-func AuthReader(c *gin.Context) {
-	clientToken := c.Request.Header.Get("Authorization")
+// authentication middleware, validates the token and loads the user and library
+func Authenticate(c *gin.Context) {
+	clientToken := strings.TrimPrefix(c.Request.Header.Get("Authorization"), "Bearer ")
 	if clientToken == "" {
-
-		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "no authorization token provided"})
-
+		c.IndentedJSON(http.StatusUnauthorized, gin.H{"error": "no authorization token provided"})
 		c.Abort()
-
 		return
-
 	}
-	secret := []byte(os.Getenv("SECRET"))
-
-	token, err := jwt.Parse(clientToken, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-
-		return secret, nil
-	})
 
+	claims, err := utils.ParseToken(clientToken)
 	if err != nil {
-		c.IndentedJSON(http.StatusInternalServerError, gin.H{"message": "error validating token", "error": err.Error()})
+		c.IndentedJSON(http.StatusUnauthorized, gin.H{"message": "error validating token", "error": err.Error()})
 		c.Abort()
 		return
 	}
 
-	if !token.Valid {
-		c.IndentedJSON(http.StatusInternalServerError, gin.H{"message": "invalid token"})
+	var user models.Users
+	res := config.DB.Preload("Library").Where("id = ?", claims.Subject).First(&user)
+	if res.Error != nil {
+		c.IndentedJSON(http.StatusUnauthorized, gin.H{"error": "user no longer exists"})
 		c.Abort()
 		return
 	}
 
-	claims, _ := token.Claims.(jwt.MapClaims)
-	fmt.Printf("claims %v", claims["role"])
+	c.Set(principalKey, &Principal{User: user, Library: user.Library, Role: user.Role, SessionID: claims.SessionID})
 
-	if claims["role"] != "reader" {
-		c.IndentedJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized, only reader can access the route"})
-		c.Abort()
-		return
-	}
-
-	c.Set("email", claims["email"])
+	// every library owned query of the request is constrained to the user's library
+	c.Request = c.Request.WithContext(tenant.WithLibrary(c.Request.Context(), user.LibID))
 
 	c.Next()
 }
 
-// validate both reader and admin
-func AuthAdminAndReader(c *gin.Context) {
-	clientToken := c.Request.Header.Get("Authorization")
-	if clientToken == "" {
-
-		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "no authorization token provided"})
-
-		c.Abort()
-
-		return
-
-	}
-	secret := []byte(os.Getenv("SECRET"))
-
-	token, err := jwt.Parse(clientToken, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+// authorization middleware, the principal needs every listed permission
+func RequirePermission(permissions ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, ok := CurrentPrincipal(c)
+		if !ok {
+			c.IndentedJSON(http.StatusUnauthorized, gin.H{"error": "not authenticated"})
+			c.Abort()
+			return
 		}
 
-		return secret, nil
-	})
-
-	if err != nil {
-		c.IndentedJSON(http.StatusInternalServerError, gin.H{"message": "error validating token", "error": err.Error()})
-		c.Abort()
-		return
-	}
-
-	if !token.Valid {
-		c.IndentedJSON(http.StatusInternalServerError, gin.H{"message": "invalid token"})
-		c.Abort()
-		return
-	}
-
-	claims, _ := token.Claims.(jwt.MapClaims)
-	fmt.Printf("claims %v", claims["role"])
+		for _, permission := range permissions {
+			if !principal.Can(permission) {
+				c.IndentedJSON(http.StatusForbidden, gin.H{"error": "forbidden, missing permission " + permission})
+				c.Abort()
+				return
+			}
+		}
 
-	if claims["role"] == "owner" {
-		c.IndentedJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized, only admin and reader can access the route"})
-		c.Abort()
-		return
+		c.Next()
 	}
-
-	c.Set("email", claims["email"])
-
-	c.Next()
 }
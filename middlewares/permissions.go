@@ -0,0 +1,57 @@
+package middlewares
+
+import "sync"
+
+// permissions checked by RequirePermission
+const (
+	PermAdminsManage        = "admins:manage"
+	PermLibraryManage       = "library:manage"
+	PermReadersManage       = "readers:manage"
+	PermInventoryWrite      = "inventory:write"
+	PermCirculationManage   = "circulation:manage"
+	PermCatalogSearch       = "catalog:search"
+	PermLoansRequest        = "loans:request"
+	PermRequestsRead        = "requests:read"
+	PermRegistryRead        = "registry:read"
+	PermFinesManage         = "fines:manage"
+	PermAccountRead         = "account:read"
+	PermNotificationsManage = "notifications:manage"
+	PermKiosksManage        = "kiosks:manage"
+	PermAccountWrite        = "account:write"
+	PermCatalogExport       = "catalog:export"
+)
+
+var (
+	permissionsMu sync.RWMutex
+
+	// role -> permissions granted to it
+	rolePermissions = map[string]map[string]bool{}
+)
+
+func init() {
+	RegisterRole("owner", PermAdminsManage, PermLibraryManage, PermKiosksManage)
+	RegisterRole("admin", PermReadersManage, PermInventoryWrite, PermCirculationManage, PermRequestsRead, PermRegistryRead, PermFinesManage, PermNotificationsManage, PermCatalogExport)
+	RegisterRole("reader", PermCatalogSearch, PermLoansRequest, PermRequestsRead, PermRegistryRead, PermAccountRead, PermAccountWrite)
+}
+
+// grant permissions to a role, creating the role if it doesn't exist yet
+func RegisterRole(role string, permissions ...string) {
+	permissionsMu.Lock()
+	defer permissionsMu.Unlock()
+
+	if rolePermissions[role] == nil {
+		rolePermissions[role] = map[string]bool{}
+	}
+
+	for _, permission := range permissions {
+		rolePermissions[role][permission] = true
+	}
+}
+
+// check if a role has a permission
+func HasPermission(role string, permission string) bool {
+	permissionsMu.RLock()
+	defer permissionsMu.RUnlock()
+
+	return rolePermissions[role][permission]
+}
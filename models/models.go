@@ -2,12 +2,29 @@ package models
 
 import (
 	"time"
-	pq "github.com/lib/pq"
 )
 
 type Library struct {
-	ID   uint `json:"id" gorm:"primaryKey"`
-	Name string	`json:"name" gorm:"unique"`
+	ID           uint         `json:"id" gorm:"primaryKey"`
+	Name         string       `json:"name" gorm:"unique"`
+	LogoURL      string       `json:"logoUrl"`
+	LoanPolicies []LoanPolicy `json:"loanPolicies,omitempty" gorm:"foreignKey:LibID"`
+}
+
+// loan rules of a library, rows with a patron and/or book category override the library default
+// and unset (null) fields are inherited from the less specific policy
+type LoanPolicy struct {
+	ID              uint   `json:"id" gorm:"primaryKey"`
+	LibID           uint   `json:"libId" gorm:"uniqueIndex:idx_loan_policy_scope"`
+	PatronCategory  string `json:"patronCategory" gorm:"uniqueIndex:idx_loan_policy_scope"`
+	BookCategory    string `json:"bookCategory" gorm:"uniqueIndex:idx_loan_policy_scope"`
+	LoanPeriodDays  *uint  `json:"loanPeriodDays"`
+	MaxLoans        *uint  `json:"maxLoans"`
+	MaxRenewals     *uint  `json:"maxRenewals"`
+	RenewalApproval *bool  `json:"renewalApproval"`
+	GracePeriodDays *uint  `json:"gracePeriodDays"`
+	FinePerDay      *uint  `json:"finePerDay"`
+	MaxBalance      *uint  `json:"maxBalance"`
 }
 
 type Users struct {
@@ -16,24 +33,98 @@ type Users struct {
 	Email         string  	`json:"email" gorm:"unique"`
 	ContactNumber string    `json:"contactNumber"`
 	Role          string  	`json:"role"`
+	PatronCategory string	`json:"patronCategory"`
+	CardNumber    string    `json:"cardNumber" gorm:"uniqueIndex:idx_user_card,where:card_number <> ''"`
+	PINHash       string    `json:"-"`
+	PINAttempts   uint      `json:"-"`
+	PINLockedUntil *time.Time `json:"-"`
 	LibID         uint  	`json:"libId"`
 	Library       Library 	`gorm:"foreignKey:ID;references:LibID"`
-	OTP			  string 	`json:"otp"`
+}
+
+// card number a reader no longer uses, it is never given out again
+type ReplacedCard struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	Number       string    `json:"number" gorm:"uniqueIndex"`
+	UserID       uint      `json:"userId" gorm:"index"`
+	ReplacedByID uint      `json:"replacedById"`
+	ReplacedAt   time.Time `json:"replacedAt"`
+	LibID        uint      `json:"libId" gorm:"index"`
+}
+
+// a self-service device of a library, it authenticates with a credential only stored as a hash
+type Kiosk struct {
+	ID             uint       `json:"id" gorm:"primaryKey"`
+	Name           string     `json:"name"`
+	CredentialHash string     `json:"-" gorm:"uniqueIndex"`
+	CreatedByID    uint       `json:"createdById"`
+	LastSeenAt     *time.Time `json:"lastSeenAt"`
+	RevokedAt      *time.Time `json:"revokedAt"`
+	CreatedAt      time.Time  `json:"createdAt"`
+	LibID          uint       `json:"libId" gorm:"index"`
+}
+
+type OTPChallenge struct {
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	UserID      uint       `json:"userId" gorm:"index"`
+	Purpose     string     `json:"purpose" gorm:"index"`
+	CodeHash    string     `json:"-"`
+	Attempts    uint       `json:"attempts"`
+	MaxAttempts uint       `json:"maxAttempts"`
+	ExpiresAt   time.Time  `json:"expiresAt"`
+	LastSentAt  time.Time  `json:"lastSentAt"`
+	LockedUntil *time.Time `json:"lockedUntil"`
+	ConsumedAt  *time.Time `json:"consumedAt"`
+	CreatedAt   time.Time  `json:"createdAt"`
+}
+
+type Session struct {
+	ID               uint       `json:"id" gorm:"primaryKey"`
+	UserID           uint       `json:"userId" gorm:"index"`
+	RefreshTokenHash string     `json:"-" gorm:"uniqueIndex"`
+	UserAgent        string     `json:"userAgent"`
+	IP               string     `json:"ip"`
+	ExpiresAt        time.Time  `json:"expiresAt"`
+	LastUsedAt       time.Time  `json:"lastUsedAt"`
+	RevokedAt        *time.Time `json:"revokedAt"`
+	ReplacedByID     *uint      `json:"replacedById"`
+	CreatedAt        time.Time  `json:"createdAt"`
 }
 
 type BookInventory struct {
-	ISBN            uint         	`json:"isbn" gorm:"primaryKey"`
+	ID              uint         	`json:"id" gorm:"primaryKey"`
+	ISBN            string         	`json:"isbn" gorm:"size:13;uniqueIndex:idx_book_isbn_lib,where:isbn <> ''"`
 	Title           string         	`json:"title"`
-	Authors         pq.StringArray 	`json:"authors" gorm:"type: varchar(200)[]"`
+	Authors         StringArray 	`json:"authors"`
+	Subjects        StringArray 	`json:"subjects"`
 	Publisher       string         	`json:"publisher"`
 	Version         string         	`json:"version"`
 	TotalCopies     uint           	`json:"totalCopies"`
 	AvailableCopies uint           	`json:"availableCopies"`
-	QrCode 			[]byte			`json:"qrCode"`
-	LibID           uint         	`json:"libID"`
+	Category        string         	`json:"category"`
+	CallNumber      string         	`json:"callNumber"`
+	Language        string         	`json:"language" gorm:"index"`
+	Year            uint           	`json:"year" gorm:"index"`
+	TimesBorrowed   uint           	`json:"timesBorrowed"`
+	LibID           uint         	`json:"libID" gorm:"uniqueIndex:idx_book_isbn_lib,where:isbn <> ''"`
 	Library         Library        	`gorm:"foreignKey:ID;references:LibID"`
 }		
 
+// a physical copy of a book, the book's counters are derived from the status of its copies
+type BookCopy struct {
+	ID              uint          `json:"id" gorm:"primaryKey"`
+	BookID          uint          `json:"bookId" gorm:"index"`
+	Barcode         string        `json:"barcode" gorm:"uniqueIndex:idx_copy_barcode_lib"`
+	AccessionNumber uint          `json:"accessionNumber" gorm:"uniqueIndex:idx_copy_accession_lib"`
+	Condition       string        `json:"condition"`
+	Status          string        `json:"status" gorm:"index"`
+	AcquisitionDate *time.Time    `json:"acquisitionDate"`
+	Price           uint          `json:"price"`
+	HoldID          *uint         `json:"holdId"`
+	LibID           uint          `json:"libId" gorm:"uniqueIndex:idx_copy_barcode_lib;uniqueIndex:idx_copy_accession_lib"`
+	BookInventory   BookInventory `gorm:"foreignKey:ID;references:BookID"`
+}
+
 type RequestEvent struct {
 	ReqId         uint        	`json:"reqId" gorm:"primaryKey"`
 	BookId        uint        	`json:"bookId"`
@@ -41,15 +132,18 @@ type RequestEvent struct {
 	RequestDate   time.Time     `json:"requestDate"`
 	ApprovalDate  *time.Time    `json:"approvalDate"`
 	ApproverID    *uint        	`json:"approverId"`
+	KioskID       *uint         `json:"kioskId" gorm:"index"`
 	RequestType   string        `json:"requestType"`
 	Status		  string		`json:"status"`
-	BookInventory BookInventory `gorm:"foreignKey:ISBN;references:BookId"`
+	LibID         uint          `json:"libId" gorm:"index"`
+	BookInventory BookInventory `gorm:"foreignKey:ID;references:BookId"`
 	Users         Users         `gorm:"foreignKey:ID;references:ReaderId,ApproverID"`
 }
 
 type IssueRegistery struct {
 	IssueID         	uint    		`json:"issueId" gorm:"primaryKey"`
-	ISBN            	uint    		`json:"isbn"`
+	BookID            	uint    		`json:"bookId"`
+	CopyID				uint			`json:"copyId" gorm:"index"`
 	ReaderID        	uint    		`json:"readerId"`
 	IssueApproverID 	uint    		`json:"issueApproverId"`
 	IssueStatus     	string    		`json:"issueStatus"`
@@ -57,6 +151,114 @@ type IssueRegistery struct {
 	ExpectedReturnDate	time.Time		`json:"expectedReturnDate"`
 	ReturnDate			*time.Time		`json:"returnDate"`
 	ReturnApproverID	*uint			`json:"returnApproverId"`
-	BookInventory 		BookInventory	`gorm:"foreignKey:ISBN;references:ISBN"`
+	IssueKioskID		*uint			`json:"issueKioskId"`
+	ReturnKioskID		*uint			`json:"returnKioskId"`
+	RenewalCount		uint			`json:"renewalCount"`
+	Fine				uint			`json:"fine"`
+	LibID				uint			`json:"libId" gorm:"index"`
+	BookInventory 		BookInventory	`gorm:"foreignKey:ID;references:BookID"`
 	Users				Users			`gorm:"foreignKey:ID;references:ReaderID,IssueApproverID,ReturnApproverID"`
 }
+
+type Hold struct {
+	ID             uint          `json:"id" gorm:"primaryKey"`
+	BookId         uint          `json:"bookId" gorm:"index"`
+	ReaderId       uint          `json:"readerId" gorm:"index"`
+	Status         string        `json:"status"`
+	QueuedAt       time.Time     `json:"queuedAt"`
+	ReadyAt        *time.Time    `json:"readyAt"`
+	PickupDeadline *time.Time    `json:"pickupDeadline"`
+	ClosedAt       *time.Time    `json:"closedAt"`
+	LibID          uint          `json:"libId" gorm:"index"`
+	BookInventory  BookInventory `gorm:"foreignKey:ID;references:BookId"`
+}
+
+// an entry of a reader's account, amounts are in the smallest currency unit,
+// charges are positive and payments or waivers negative
+type LedgerEntry struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	ReaderID     uint      `json:"readerId" gorm:"index"`
+	Type         string    `json:"type"`
+	Amount       int64     `json:"amount"`
+	Note         string    `json:"note"`
+	IssueID      *uint     `json:"issueId"`
+	RecordedByID *uint     `json:"recordedById"`
+	LibID        uint      `json:"libId" gorm:"index"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+// a reminder or overdue notice sent for a loan, a notice is sent once per due date
+type NoticeLog struct {
+	ID      uint      `json:"id" gorm:"primaryKey"`
+	IssueID uint      `json:"issueId" gorm:"uniqueIndex:idx_notice_once"`
+	Kind    string    `json:"kind" gorm:"uniqueIndex:idx_notice_once"`
+	DueDate time.Time `json:"dueDate" gorm:"uniqueIndex:idx_notice_once"`
+	Email   string    `json:"email"`
+	SentAt  time.Time `json:"sentAt"`
+	LibID   uint      `json:"libId" gorm:"index"`
+}
+
+// an email waiting to be delivered, written in the same transaction as the change it announces.
+// The bodies are not listed to admins, they may hold what only the reader should read
+type OutboxMessage struct {
+	ID            uint       `json:"id" gorm:"primaryKey"`
+	To            string     `json:"to"`
+	Subject       string     `json:"subject"`
+	Body          string     `json:"-"`
+	HTMLBody      string     `json:"-"`
+	Status        string     `json:"status" gorm:"index"`
+	Attempts      uint       `json:"attempts"`
+	MaxAttempts   uint       `json:"maxAttempts"`
+	NextAttemptAt time.Time  `json:"nextAttemptAt" gorm:"index"`
+	LastError     string     `json:"lastError"`
+	SentAt        *time.Time `json:"sentAt"`
+	LibID         uint       `json:"libId" gorm:"index"`
+	CreatedAt     time.Time  `json:"createdAt"`
+}
+
+// a library's override of an email template, empty parts fall back to the default template
+type EmailTemplate struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	LibID     uint      `json:"libId" gorm:"uniqueIndex:idx_email_template_name"`
+	Name      string    `json:"name" gorm:"uniqueIndex:idx_email_template_name"`
+	Subject   string    `json:"subject"`
+	Text      string    `json:"text"`
+	HTML      string    `json:"html"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// a bulk catalog import, large files are imported in the background and report their progress
+type ImportJob struct {
+	ID          uint        `json:"id" gorm:"primaryKey"`
+	FileName    string      `json:"fileName"`
+	Format      string      `json:"format"`
+	DryRun      bool        `json:"dryRun"`
+	Status      string      `json:"status" gorm:"index"`
+	Total       uint        `json:"total"`
+	Processed   uint        `json:"processed"`
+	Created     uint        `json:"created"`
+	Updated     uint        `json:"updated"`
+	Rejected    uint        `json:"rejected"`
+	Unmapped    StringArray `json:"unmapped"`
+	Error       string      `json:"error"`
+	CreatedByID uint        `json:"createdById"`
+	CreatedAt   time.Time   `json:"createdAt"`
+	FinishedAt  *time.Time  `json:"finishedAt"`
+	LibID       uint        `json:"libId" gorm:"index"`
+}
+
+// outcome of a line of an import: the book it created or added copies to, or why it was rejected
+type ImportRow struct {
+	ID       uint        `json:"id" gorm:"primaryKey"`
+	JobID    uint        `json:"jobId" gorm:"index"`
+	Line     uint        `json:"line"`
+	Status   string      `json:"status"`
+	BookID   uint        `json:"bookId"`
+	ISBN     string      `json:"isbn"`
+	Title    string      `json:"title"`
+	Copies   uint        `json:"copies"`
+	Barcodes StringArray `json:"barcodes"`
+	Unmapped StringArray `json:"unmapped"`
+	Error    string      `json:"error"`
+	LibID    uint        `json:"libId" gorm:"index"`
+}
@@ -0,0 +1,32 @@
+package models
+
+import (
+	"database/sql/driver"
+
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// string array stored as a native array in postgres and as text in other databases
+type StringArray []string
+
+func (a StringArray) Value() (driver.Value, error) {
+	return pq.StringArray(a).Value()
+}
+
+func (a *StringArray) Scan(src interface{}) error {
+	return (*pq.StringArray)(a).Scan(src)
+}
+
+func (StringArray) GormDataType() string {
+	return "string_array"
+}
+
+func (StringArray) GormDBDataType(db *gorm.DB, field *schema.Field) string {
+	if db.Dialector.Name() == "postgres" {
+		return "varchar(200)[]"
+	}
+
+	return "text"
+}
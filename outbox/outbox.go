@@ -0,0 +1,228 @@
+package outbox
+
+import (
+	"errors"
+	"fmt"
+	"project/libraryManagement/config"
+	"project/libraryManagement/mailer"
+	"project/libraryManagement/models"
+	"project/libraryManagement/templates"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// message statuses
+const (
+	StatusPending   = "pending"
+	StatusSent      = "sent"
+	StatusDead      = "dead"
+	StatusCancelled = "cancelled"
+)
+
+var (
+	ErrMessageNotFound = errors.New("notification does not exists")
+	ErrNotRetryable    = errors.New("only failed or cancelled notifications can be retried")
+	ErrNotCancellable  = errors.New("only pending or failed notifications can be cancelled")
+)
+
+// how long a worker owns a message it is delivering before another worker may pick it up
+const claimLease = 5 * time.Minute
+
+func maxAttempts() uint {
+	return uint(config.GetEnvInt("OUTBOX_MAX_ATTEMPTS", 8))
+}
+
+// wait before the next attempt, doubling after every failure
+func backoff(attempts uint) time.Duration {
+	base := config.GetEnvDuration("OUTBOX_BACKOFF", 30*time.Second)
+	limit := config.GetEnvDuration("OUTBOX_MAX_BACKOFF", 6*time.Hour)
+
+	wait := base
+	for i := uint(1); i < attempts && wait < limit; i++ {
+		wait *= 2
+	}
+	if wait > limit {
+		wait = limit
+	}
+
+	return wait
+}
+
+// queue a plain text email, pass the transaction of the change it belongs to
+func Enqueue(tx *gorm.DB, libID uint, to string, subject string, body string) (*models.OutboxMessage, error) {
+	return enqueue(tx, libID, to, templates.Rendered{Subject: subject, Text: body})
+}
+
+// render a template for the library and queue it, pass the transaction of the change it belongs to
+func EnqueueTemplate(tx *gorm.DB, libID uint, to string, name string, data templates.Data) (*models.OutboxMessage, error) {
+	rendered, err := templates.Render(tx, libID, name, data)
+	if err != nil {
+		return nil, err
+	}
+
+	return enqueue(tx, libID, to, *rendered)
+}
+
+func enqueue(tx *gorm.DB, libID uint, to string, email templates.Rendered) (*models.OutboxMessage, error) {
+	msg := models.OutboxMessage{
+		To:            to,
+		Subject:       email.Subject,
+		Body:          email.Text,
+		HTMLBody:      email.HTML,
+		Status:        StatusPending,
+		MaxAttempts:   maxAttempts(),
+		NextAttemptAt: time.Now(),
+		LibID:         libID,
+	}
+
+	if err := tx.Create(&msg).Error; err != nil {
+		return nil, err
+	}
+
+	return &msg, nil
+}
+
+// take a due message so no other worker delivers it at the same time
+func claim(db *gorm.DB, msg *models.OutboxMessage, now time.Time) (bool, error) {
+	res := db.Model(&models.OutboxMessage{}).
+		Where("id = ? AND status = ? AND next_attempt_at <= ?", msg.ID, StatusPending, now).
+		Update("next_attempt_at", now.Add(claimLease))
+	if res.Error != nil {
+		return false, res.Error
+	}
+
+	return res.RowsAffected == 1, nil
+}
+
+// deliver a claimed message, failures are rescheduled or dead-lettered
+func deliver(db *gorm.DB, msg *models.OutboxMessage, now time.Time) error {
+	sendErr := mailer.Send(msg.To, msg.Subject, msg.Body, msg.HTMLBody)
+
+	msg.Attempts += 1
+	if sendErr == nil {
+		msg.Status = StatusSent
+		msg.SentAt = &now
+		msg.LastError = ""
+	} else {
+		msg.LastError = sendErr.Error()
+		if msg.Attempts >= msg.MaxAttempts {
+			msg.Status = StatusDead
+		} else {
+			msg.NextAttemptAt = now.Add(backoff(msg.Attempts))
+		}
+	}
+
+	if err := db.Model(msg).Select("status", "attempts", "next_attempt_at", "last_error", "sent_at").Updates(msg).Error; err != nil {
+		return err
+	}
+
+	return sendErr
+}
+
+// deliver the due messages, oldest first, returns how many were sent and how many failed
+func Deliver(db *gorm.DB, now time.Time, limit int) (int, int, error) {
+	var due []models.OutboxMessage
+
+	res := db.Where("status = ? AND next_attempt_at <= ?", StatusPending, now).Order("id").Limit(limit).Find(&due)
+	if res.Error != nil {
+		return 0, 0, res.Error
+	}
+
+	sent, failed := 0, 0
+	for i := range due {
+		ok, err := claim(db, &due[i], now)
+		if err != nil {
+			return sent, failed, err
+		}
+		if !ok {
+			continue
+		}
+
+		if err := deliver(db, &due[i], now); err != nil {
+			fmt.Println("error delivering notification", due[i].ID, err)
+			failed++
+		} else {
+			sent++
+		}
+	}
+
+	return sent, failed, nil
+}
+
+// try to deliver queued messages right away instead of waiting for the worker,
+// errors are left for the worker to retry
+func Flush(db *gorm.DB, messages ...*models.OutboxMessage) {
+	now := time.Now()
+
+	for _, msg := range messages {
+		if msg == nil {
+			continue
+		}
+
+		ok, err := claim(db, msg, now)
+		if err != nil || !ok {
+			continue
+		}
+
+		if err := deliver(db, msg, now); err != nil {
+			fmt.Println("error delivering notification", msg.ID, err)
+		}
+	}
+}
+
+// find a message for an admin action
+func find(tx *gorm.DB, id uint) (*models.OutboxMessage, error) {
+	var msg models.OutboxMessage
+
+	res := tx.Where("id = ?", id).First(&msg)
+	if res.Error != nil {
+		if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+			return nil, ErrMessageNotFound
+		}
+		return nil, res.Error
+	}
+
+	return &msg, nil
+}
+
+// queue a dead or cancelled message again with a fresh set of attempts
+func Retry(db *gorm.DB, id uint) (*models.OutboxMessage, error) {
+	msg, err := find(db, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if msg.Status != StatusDead && msg.Status != StatusCancelled {
+		return nil, ErrNotRetryable
+	}
+
+	res := db.Model(&models.OutboxMessage{}).Where("id = ? AND status = ?", msg.ID, msg.Status).
+		Updates(map[string]interface{}{"status": StatusPending, "attempts": 0, "max_attempts": maxAttempts(), "next_attempt_at": time.Now()})
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, ErrNotRetryable
+	}
+
+	return find(db, id)
+}
+
+// stop delivering a pending or dead message
+func Cancel(db *gorm.DB, id uint) (*models.OutboxMessage, error) {
+	msg, err := find(db, id)
+	if err != nil {
+		return nil, err
+	}
+
+	res := db.Model(&models.OutboxMessage{}).Where("id = ? AND status IN ?", msg.ID, []string{StatusPending, StatusDead}).Update("status", StatusCancelled)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, ErrNotCancellable
+	}
+
+	return find(db, id)
+}
@@ -0,0 +1,66 @@
+package outbox_test
+
+import (
+	"errors"
+	"project/libraryManagement/config"
+	"project/libraryManagement/outbox"
+	"project/libraryManagement/testutil"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFailingMessagesBackOffThenDeadLetter(t *testing.T) {
+	testutil.SetupDB(t)
+	mail := testutil.Mailer(t)
+	t.Setenv("OUTBOX_MAX_ATTEMPTS", "3")
+	t.Setenv("OUTBOX_BACKOFF", "1m")
+
+	library := testutil.CreateLibrary(t, "Library")
+	msg, err := outbox.Enqueue(config.DB, library.ID, "reader@library.test", "Hello", "body")
+	assert.NoError(t, err)
+
+	mail.Fail(errors.New("smtp down"))
+	now := time.Now()
+
+	_, failed, _ := outbox.Deliver(config.DB, now, 10)
+	assert.Equal(t, 1, failed)
+
+	// not due again before the backoff
+	sent, failed, _ := outbox.Deliver(config.DB, now.Add(30*time.Second), 10)
+	assert.Equal(t, 0, sent+failed)
+
+	_, failed, _ = outbox.Deliver(config.DB, now.Add(time.Minute), 10)
+	assert.Equal(t, 1, failed)
+
+	// the wait doubles
+	sent, failed, _ = outbox.Deliver(config.DB, now.Add(2*time.Minute), 10)
+	assert.Equal(t, 0, sent+failed)
+
+	_, failed, _ = outbox.Deliver(config.DB, now.Add(4*time.Minute), 10)
+	assert.Equal(t, 1, failed)
+
+	config.DB.First(msg, msg.ID)
+	assert.Equal(t, outbox.StatusDead, msg.Status)
+	assert.Equal(t, "smtp down", msg.LastError)
+
+	_, err = outbox.Cancel(config.DB, msg.ID)
+	assert.NoError(t, err)
+
+	// retried by an admin once the mailer works again
+	mail.Fail(nil)
+	msg, err = outbox.Retry(config.DB, msg.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, outbox.StatusPending, msg.Status)
+	assert.Equal(t, uint(0), msg.Attempts)
+
+	sent, _, _ = outbox.Deliver(config.DB, time.Now(), 10)
+	assert.Equal(t, 1, sent)
+	assert.Len(t, mail.To("reader@library.test"), 1)
+
+	_, err = outbox.Retry(config.DB, msg.ID)
+	assert.ErrorIs(t, err, outbox.ErrNotRetryable)
+	_, err = outbox.Cancel(config.DB, msg.ID)
+	assert.ErrorIs(t, err, outbox.ErrNotCancellable)
+}
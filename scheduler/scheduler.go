@@ -0,0 +1,102 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var ErrUnknownJob = errors.New("unknown job")
+
+// a task run periodically in the background
+type Job struct {
+	Name     string
+	Interval time.Duration
+	Run      func(now time.Time) error
+}
+
+// runs registered jobs on their interval, each job runs one at a time
+type Scheduler struct {
+	mu   sync.Mutex
+	jobs []Job
+}
+
+func New() *Scheduler {
+	return &Scheduler{}
+}
+
+// register a job, replacing a job with the same name
+func (s *Scheduler) Add(job Job) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, existing := range s.jobs {
+		if existing.Name == job.Name {
+			s.jobs[i] = job
+			return
+		}
+	}
+
+	s.jobs = append(s.jobs, job)
+}
+
+// names of the registered jobs
+func (s *Scheduler) Names() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	names := make([]string, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		names = append(names, job.Name)
+	}
+
+	return names
+}
+
+// run a job once right away, e.g. from the command line
+func (s *Scheduler) RunOnce(name string) error {
+	s.mu.Lock()
+	var found *Job
+	for i := range s.jobs {
+		if s.jobs[i].Name == name {
+			found = &s.jobs[i]
+			break
+		}
+	}
+	s.mu.Unlock()
+
+	if found == nil {
+		return fmt.Errorf("%w: %s", ErrUnknownJob, name)
+	}
+
+	return found.Run(time.Now())
+}
+
+// run every job on its interval until the context is cancelled
+func (s *Scheduler) Start(ctx context.Context) {
+	s.mu.Lock()
+	jobs := append([]Job(nil), s.jobs...)
+	s.mu.Unlock()
+
+	for _, job := range jobs {
+		go run(ctx, job)
+	}
+}
+
+func run(ctx context.Context, job Job) {
+	ticker := time.NewTicker(job.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if err := job.Run(now); err != nil {
+				fmt.Printf("error running job %s: %v\n", job.Name, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package search
+
+import (
+	"encoding/base64"
+	"encoding/json"
+)
+
+// where a hit is in the sort order, the cursor of a page is the position of its last hit
+type position struct {
+	Sort   string  `json:"s"`
+	Title  string  `json:"t,omitempty"`
+	Number float64 `json:"n,omitempty"`
+	ID     uint    `json:"id"`
+}
+
+// position of the hit for the sort: its title, rank or count and its id to break ties
+func positionOf(hit Hit, sort string) position {
+	p := position{Sort: sort, ID: hit.ID}
+
+	switch sort {
+	case SortRelevance:
+		p.Number = hit.Rank
+	case SortTitle:
+		p.Title = hit.Title
+	case SortBorrowed:
+		p.Number = float64(hit.TimesBorrowed)
+	case SortAvailability:
+		p.Number = float64(hit.AvailableCopies)
+	}
+
+	return p
+}
+
+// whether a comes before b: titles ascending, newest first, everything else descending,
+// ties in id order
+func (a position) before(b position) bool {
+	switch a.Sort {
+	case SortTitle:
+		if a.Title != b.Title {
+			return a.Title < b.Title
+		}
+	case SortNewest:
+		return a.ID > b.ID
+	default:
+		if a.Number != b.Number {
+			return a.Number > b.Number
+		}
+	}
+
+	return a.ID < b.ID
+}
+
+// opaque cursor of a position
+func encodeCursor(p position) string {
+	raw, _ := json.Marshal(p)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// position of a cursor, nil for the first page, the cursor has to come from a query with the same sort
+func decodeCursor(cursor string, sort string) (*position, error) {
+	if cursor == "" {
+		return nil, nil
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var p position
+	if err := json.Unmarshal(raw, &p); err != nil || p.Sort != sort {
+		return nil, ErrInvalidCursor
+	}
+
+	return &p, nil
+}
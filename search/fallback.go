@@ -0,0 +1,286 @@
+package search
+
+import (
+	"html"
+	"project/libraryManagement/models"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"gorm.io/gorm"
+)
+
+// how much a word counts when the term only starts it or is a misspelling of it
+const (
+	prefixMatch = 0.8
+	fuzzyMatch  = 0.5
+)
+
+// search without postgres (sqlite in tests and local runs): the books of the library are filtered, scored and counted
+// in memory the same way postgres does it, which is fine for small catalogs
+func fallbackFind(db *gorm.DB, query Query, terms []string, normalized string, after *position) (*Page, error) {
+	var books []models.BookInventory
+
+	if err := db.Find(&books).Error; err != nil {
+		return nil, err
+	}
+
+	hits := []Hit{}
+	for _, book := range books {
+		if !matchesFilters(book, query) {
+			continue
+		}
+
+		if len(terms) == 0 {
+			hits = append(hits, Hit{BookInventory: book, Highlight: html.EscapeString(book.Title)})
+			continue
+		}
+
+		rank, ok := score(book, terms)
+		if normalized != "" && book.ISBN == normalized {
+			rank, ok = rank+1, true
+		}
+		if !ok {
+			continue
+		}
+
+		hits = append(hits, Hit{
+			BookInventory: book,
+			Rank:          rank,
+			Highlight:     highlight(book.Title, terms, true),
+			Snippet:       highlight(snippetText(book), terms, false),
+		})
+	}
+
+	page := &Page{Total: int64(len(hits)), Facets: countFacets(hits)}
+
+	sort.SliceStable(hits, func(i, j int) bool {
+		return positionOf(hits[i], query.Sort).before(positionOf(hits[j], query.Sort))
+	})
+
+	// the page starts after the last hit of the previous one
+	if after != nil {
+		start := sort.Search(len(hits), func(i int) bool {
+			return after.before(positionOf(hits[i], query.Sort))
+		})
+		hits = hits[start:]
+	}
+
+	page.Results, page.NextCursor = paginate(hits, query.Limit, query.Sort)
+	return page, nil
+}
+
+// whether the book passes the filters of the query, names are compared case insensitively
+func matchesFilters(book models.BookInventory, query Query) bool {
+	contains := func(values []string, value string) bool {
+		for _, v := range values {
+			if strings.EqualFold(v, value) {
+				return true
+			}
+		}
+		return false
+	}
+
+	switch {
+	case query.Author != "" && !contains(book.Authors, query.Author),
+		query.Subject != "" && !contains(book.Subjects, query.Subject),
+		query.Publisher != "" && !strings.EqualFold(book.Publisher, query.Publisher),
+		query.Language != "" && book.Language != query.Language,
+		query.YearFrom != 0 && book.Year < query.YearFrom,
+		query.YearTo != 0 && book.Year > query.YearTo,
+		query.AvailableOnly && book.AvailableCopies == 0:
+		return false
+	}
+
+	return true
+}
+
+// facet counts of the hits, most common values first
+func countFacets(hits []Hit) Facets {
+	authors, publishers, subjects, languages, years := map[string]int64{}, map[string]int64{}, map[string]int64{}, map[string]int64{}, map[string]int64{}
+	facets := Facets{}
+
+	add := func(counts map[string]int64, values ...string) {
+		seen := map[string]bool{}
+		for _, value := range values {
+			if value != "" && !seen[value] {
+				seen[value] = true
+				counts[value]++
+			}
+		}
+	}
+
+	for _, hit := range hits {
+		add(authors, hit.Authors...)
+		add(subjects, hit.Subjects...)
+		add(publishers, hit.Publisher)
+		add(languages, hit.Language)
+		if hit.Year != 0 {
+			add(years, strconv.FormatUint(uint64(hit.Year), 10))
+		}
+		if hit.AvailableCopies > 0 {
+			facets.Available++
+		}
+	}
+
+	facets.Authors = topValues(authors)
+	facets.Publishers = topValues(publishers)
+	facets.Subjects = topValues(subjects)
+	facets.Languages = topValues(languages)
+	facets.Years = topValues(years)
+
+	return facets
+}
+
+// the FacetLimit most common values, ties in value order
+func topValues(counts map[string]int64) []FacetCount {
+	values := []FacetCount{}
+	for value, count := range counts {
+		values = append(values, FacetCount{Value: value, Count: count})
+	}
+
+	sort.Slice(values, func(i, j int) bool {
+		if values[i].Count != values[j].Count {
+			return values[i].Count > values[j].Count
+		}
+		return values[i].Value < values[j].Value
+	})
+
+	if len(values) > FacetLimit {
+		values = values[:FacetLimit]
+	}
+
+	return values
+}
+
+// the fields shown in the snippet, as postgres builds it
+func snippetText(book models.BookInventory) string {
+	parts := []string{}
+	for _, part := range []string{strings.Join(book.Authors, ", "), strings.Join(book.Subjects, ", "), book.Publisher} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+
+	return strings.Join(parts, " · ")
+}
+
+// relevance of the book, every term has to match one of its fields
+func score(book models.BookInventory, terms []string) (float64, bool) {
+	fields := []struct {
+		words  []string
+		weight float64
+		fuzzy  bool
+	}{
+		{Terms(book.Title), weightTitle, true},
+		{Terms(strings.Join(book.Authors, " ")), weightAuthors, false},
+		{Terms(strings.Join(book.Subjects, " ")), weightSubjects, false},
+		{Terms(book.Publisher), weightPublisher, false},
+	}
+
+	total := 0.0
+	for _, term := range terms {
+		best := 0.0
+		for _, field := range fields {
+			for _, word := range field.words {
+				if m := match(term, word, field.fuzzy) * field.weight; m > best {
+					best = m
+				}
+			}
+		}
+		if best == 0 {
+			return 0, false
+		}
+		total += best
+	}
+
+	return total / float64(len(terms)), true
+}
+
+// how well the term matches a word: the word itself, its start or, when allowed, a misspelling of it
+func match(term string, word string, fuzzy bool) float64 {
+	switch {
+	case word == term:
+		return 1
+	case strings.HasPrefix(word, term):
+		return prefixMatch
+	case fuzzy && distance(term, word) <= allowedEdits(term):
+		return fuzzyMatch
+	default:
+		return 0
+	}
+}
+
+// typos tolerated in a term, none in short words
+func allowedEdits(term string) int {
+	switch n := len([]rune(term)); {
+	case n >= 8:
+		return 2
+	case n >= 4:
+		return 1
+	default:
+		return -1
+	}
+}
+
+// levenshtein distance between two words
+func distance(a string, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	previous := make([]int, len(rb)+1)
+	current := make([]int, len(rb)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		current[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+
+	return previous[len(rb)]
+}
+
+// the text escaped, with the words matching a term wrapped in <mark>
+func highlight(text string, terms []string, fuzzy bool) string {
+	var out strings.Builder
+
+	runes := []rune(text)
+	for i := 0; i < len(runes); {
+		if !unicode.IsLetter(runes[i]) && !unicode.IsDigit(runes[i]) {
+			out.WriteString(html.EscapeString(string(runes[i])))
+			i++
+			continue
+		}
+
+		end := i
+		for end < len(runes) && (unicode.IsLetter(runes[end]) || unicode.IsDigit(runes[end])) {
+			end++
+		}
+
+		word := string(runes[i:end])
+		marked := false
+		for _, term := range terms {
+			if match(term, strings.ToLower(word), fuzzy) > 0 {
+				marked = true
+				break
+			}
+		}
+
+		if marked {
+			out.WriteString("<mark>" + html.EscapeString(word) + "</mark>")
+		} else {
+			out.WriteString(html.EscapeString(word))
+		}
+		i = end
+	}
+
+	return out.String()
+}
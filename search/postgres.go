@@ -0,0 +1,285 @@
+package search
+
+import (
+	"fmt"
+	"html"
+	"project/libraryManagement/models"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// whether pg_trgm is installed, titles only match misspelled words with it
+var trigrams bool
+
+// search_vector holds the weighted words of a book: title (a), authors (b), subjects (c) and publisher (d),
+// the trigger keeps it up to date so every insert and update is searchable straight away
+const searchVectorTrigger = `
+CREATE OR REPLACE FUNCTION book_inventories_search_vector() RETURNS trigger AS $$
+BEGIN
+	NEW.search_vector :=
+		setweight(to_tsvector('simple', coalesce(NEW.title, '')), 'A') ||
+		setweight(to_tsvector('simple', coalesce(array_to_string(NEW.authors, ' '), '')), 'B') ||
+		setweight(to_tsvector('simple', coalesce(array_to_string(NEW.subjects, ' '), '')), 'C') ||
+		setweight(to_tsvector('simple', coalesce(NEW.publisher, '')), 'D');
+	RETURN NEW;
+END
+$$ LANGUAGE plpgsql`
+
+// create the search column, its trigger and indexes, only needed on postgres
+func Migrate(db *gorm.DB) error {
+	if db.Dialector.Name() != "postgres" {
+		return nil
+	}
+
+	// installing an extension needs privileges the app may not have, search works without it
+	if err := db.Exec("CREATE EXTENSION IF NOT EXISTS pg_trgm").Error; err != nil {
+		fmt.Println("pg_trgm is not available, misspelled titles won't be found:", err)
+	}
+	db.Raw("SELECT EXISTS (SELECT 1 FROM pg_extension WHERE extname = 'pg_trgm')").Scan(&trigrams)
+
+	statements := []string{
+		"ALTER TABLE book_inventories ADD COLUMN IF NOT EXISTS search_vector tsvector",
+		searchVectorTrigger,
+		"DROP TRIGGER IF EXISTS book_inventories_search_vector ON book_inventories",
+		"CREATE TRIGGER book_inventories_search_vector BEFORE INSERT OR UPDATE OF title, authors, subjects, publisher ON book_inventories FOR EACH ROW EXECUTE FUNCTION book_inventories_search_vector()",
+		"CREATE INDEX IF NOT EXISTS idx_book_search_vector ON book_inventories USING GIN (search_vector)",
+		// setting a column fires the trigger, which fills in the books created before the search column
+		"UPDATE book_inventories SET title = title WHERE search_vector IS NULL",
+	}
+	if trigrams {
+		statements = append(statements, "CREATE INDEX IF NOT EXISTS idx_book_title_trgm ON book_inventories USING GIN (title gin_trgm_ops)")
+	}
+
+	for _, statement := range statements {
+		if err := db.Exec(statement).Error; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// tsquery matching every term as a word or the start of one, e.g. "harry:* & pot:*",
+// terms only hold letters and digits so they can't carry tsquery operators
+func prefixQuery(terms []string) string {
+	parts := make([]string, len(terms))
+	for i, term := range terms {
+		parts[i] = term + ":*"
+	}
+
+	return strings.Join(parts, " & ")
+}
+
+// sql matching the filters of the query, with its arguments
+func filterSQL(query Query) (string, []interface{}) {
+	conditions := []string{}
+	args := []interface{}{}
+
+	add := func(condition string, values ...interface{}) {
+		conditions = append(conditions, condition)
+		args = append(args, values...)
+	}
+
+	if query.Author != "" {
+		add("EXISTS (SELECT 1 FROM unnest(authors) AS author WHERE lower(author) = lower(?))", query.Author)
+	}
+	if query.Subject != "" {
+		add("EXISTS (SELECT 1 FROM unnest(subjects) AS subject WHERE lower(subject) = lower(?))", query.Subject)
+	}
+	if query.Publisher != "" {
+		add("lower(publisher) = lower(?)", query.Publisher)
+	}
+	if query.Language != "" {
+		add("language = ?", query.Language)
+	}
+	if query.YearFrom != 0 {
+		add("year >= ?", query.YearFrom)
+	}
+	if query.YearTo != 0 {
+		add("year <= ?", query.YearTo)
+	}
+	if query.AvailableOnly {
+		add("available_copies > 0")
+	}
+
+	return strings.Join(conditions, " AND "), args
+}
+
+// rank of a book for the terms and the condition matching them, ts_rank with the title's similarity
+// to the query added when pg_trgm is installed, and the book of an isbn first
+func textSQL(terms []string, normalized string) (string, []interface{}, string, []interface{}) {
+	tsquery := prefixQuery(terms)
+	text := strings.Join(terms, " ")
+
+	rank := "ts_rank(search_vector, to_tsquery('simple', ?))"
+	rankArgs := []interface{}{tsquery}
+	where := "search_vector @@ to_tsquery('simple', ?)"
+	whereArgs := []interface{}{tsquery}
+
+	if trigrams {
+		rank += " + word_similarity(?, title) * 0.5"
+		rankArgs = append(rankArgs, text)
+		where += " OR ? <% title"
+		whereArgs = append(whereArgs, text)
+	}
+
+	if normalized != "" {
+		rank = fmt.Sprintf("CASE WHEN isbn = ? THEN 1 ELSE 0 END + %s", rank)
+		rankArgs = append([]interface{}{normalized}, rankArgs...)
+		where += " OR isbn = ?"
+		whereArgs = append(whereArgs, normalized)
+	}
+
+	return "(" + rank + ")", rankArgs, "(" + where + ")", whereArgs
+}
+
+// column a sort orders by, the rank expression for relevance
+var sortColumns = map[string]string{
+	SortTitle:        "title",
+	SortBorrowed:     "times_borrowed",
+	SortAvailability: "available_copies",
+}
+
+// the page of books after the cursor, the total and the facets of every match
+func postgresFind(db *gorm.DB, query Query, terms []string, normalized string, after *position) (*Page, error) {
+	var hits []Hit
+
+	filters, filterArgs := filterSQL(query)
+
+	var rank, match string
+	var rankArgs, matchArgs []interface{}
+	if len(terms) > 0 {
+		rank, rankArgs, match, matchArgs = textSQL(terms, normalized)
+	}
+
+	// every matching book, before paging
+	matching := func() *gorm.DB {
+		tx := db.Model(&models.BookInventory{})
+		if filters != "" {
+			tx = tx.Where(filters, filterArgs...)
+		}
+		if match != "" {
+			tx = tx.Where(match, matchArgs...)
+		}
+		return tx
+	}
+
+	page := &Page{}
+	if err := matching().Count(&page.Total).Error; err != nil {
+		return nil, err
+	}
+
+	facets, err := postgresFacets(db, matching)
+	if err != nil {
+		return nil, err
+	}
+	page.Facets = *facets
+
+	tx := matching()
+	if len(terms) > 0 {
+		tsquery := prefixQuery(terms)
+		selectSQL := "book_inventories.*, " + rank + ` AS rank,
+			ts_headline('simple', title, to_tsquery('simple', ?), 'StartSel=<mark>, StopSel=</mark>, HighlightAll=true') AS highlight,
+			ts_headline('simple', concat_ws(' · ', NULLIF(array_to_string(authors, ', '), ''), NULLIF(array_to_string(subjects, ', '), ''), NULLIF(publisher, '')),
+				to_tsquery('simple', ?), 'StartSel=<mark>, StopSel=</mark>, MaxFragments=2, MinWords=5, MaxWords=15') AS snippet`
+		tx = tx.Select(selectSQL, append(append([]interface{}{}, rankArgs...), tsquery, tsquery)...)
+	} else {
+		tx = tx.Select("book_inventories.*")
+	}
+
+	// keyset paging: the books after the last one of the previous page in the sort order
+	column := sortColumns[query.Sort]
+	if query.Sort == SortRelevance {
+		column = rank
+	}
+
+	if after != nil {
+		switch query.Sort {
+		case SortNewest:
+			tx = tx.Where("id < ?", after.ID)
+		case SortTitle:
+			tx = tx.Where("(title > ? OR (title = ? AND id > ?))", after.Title, after.Title, after.ID)
+		default:
+			// descending by rank or count, the rank expression carries its own arguments
+			var columnArgs []interface{}
+			if query.Sort == SortRelevance {
+				columnArgs = rankArgs
+			}
+			args := append(append([]interface{}{}, columnArgs...), after.Number)
+			args = append(append(args, columnArgs...), after.Number, after.ID)
+			tx = tx.Where(fmt.Sprintf("(%s < ? OR (%s = ? AND id > ?))", column, column), args...)
+		}
+	}
+
+	switch query.Sort {
+	case SortNewest:
+		tx = tx.Order("id DESC")
+	case SortTitle:
+		tx = tx.Order("title, id")
+	case SortRelevance:
+		tx = tx.Order("rank DESC, id")
+	default:
+		tx = tx.Order(column + " DESC, id")
+	}
+
+	if err := tx.Limit(query.Limit + 1).Scan(&hits).Error; err != nil {
+		return nil, err
+	}
+
+	for i := range hits {
+		if len(terms) > 0 {
+			hits[i].Highlight = markup(hits[i].Highlight)
+			hits[i].Snippet = markup(hits[i].Snippet)
+		} else {
+			hits[i].Highlight = html.EscapeString(hits[i].Title)
+		}
+	}
+
+	page.Results, page.NextCursor = paginate(hits, query.Limit, query.Sort)
+	if page.Results == nil {
+		page.Results = []Hit{}
+	}
+
+	return page, nil
+}
+
+// facet counts of the matching books, most common values first
+func postgresFacets(db *gorm.DB, matching func() *gorm.DB) (*Facets, error) {
+	facets := &Facets{}
+
+	// array columns are unnested first, a book counts once per value
+	arrayFacet := func(column string, counts *[]FacetCount) error {
+		values := matching().Select(fmt.Sprintf("DISTINCT id, unnest(%s) AS value", column))
+		return db.Table("(?) AS facet", values).Select("value, COUNT(*) AS count").Where("value <> ''").
+			Group("value").Order("count DESC, value").Limit(FacetLimit).Scan(counts).Error
+	}
+
+	// set is the condition of a book having a value
+	columnFacet := func(column string, set string, counts *[]FacetCount) error {
+		return matching().Select(fmt.Sprintf("CAST(%s AS TEXT) AS value, COUNT(*) AS count", column)).Where(set).
+			Group(column).Order("count DESC, value").Limit(FacetLimit).Scan(counts).Error
+	}
+
+	steps := []error{
+		arrayFacet("authors", &facets.Authors),
+		arrayFacet("subjects", &facets.Subjects),
+		columnFacet("publisher", "publisher <> ''", &facets.Publishers),
+		columnFacet("language", "language <> ''", &facets.Languages),
+		columnFacet("year", "year > 0", &facets.Years),
+		matching().Where("available_copies > 0").Count(&facets.Available).Error,
+	}
+	for _, err := range steps {
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, counts := range []*[]FacetCount{&facets.Authors, &facets.Subjects, &facets.Publishers, &facets.Languages, &facets.Years} {
+		if *counts == nil {
+			*counts = []FacetCount{}
+		}
+	}
+
+	return facets, nil
+}
@@ -0,0 +1,188 @@
+package search_test
+
+import (
+	"project/libraryManagement/config"
+	"project/libraryManagement/models"
+	"project/libraryManagement/search"
+	"project/libraryManagement/tenant"
+	"project/libraryManagement/testutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+// the books of a library, created in this order
+func catalog(t *testing.T, libID uint) []models.BookInventory {
+	t.Helper()
+
+	books := []models.BookInventory{
+		{Title: "Pride and Prejudice", ISBN: "9780141439518", Authors: models.StringArray{"Jane Austen"}, Subjects: models.StringArray{"Courtship", "England"}, Publisher: "Penguin", Language: "en", Year: 1813, AvailableCopies: 2, TimesBorrowed: 5},
+		{Title: "Emma", Authors: models.StringArray{"Jane Austen"}, Subjects: models.StringArray{"England"}, Publisher: "Penguin", Language: "en", Year: 1815, AvailableCopies: 0, TimesBorrowed: 9},
+		{Title: "Persuasion", Authors: models.StringArray{"Jane Austen"}, Subjects: models.StringArray{"England"}, Publisher: "Oxford", Language: "en", Year: 1817, AvailableCopies: 1, TimesBorrowed: 2},
+		{Title: "Northanger Abbey", Authors: models.StringArray{"Jane Austen"}, Subjects: models.StringArray{"Gothic"}, Publisher: "Oxford", Language: "en", Year: 1817, AvailableCopies: 1, TimesBorrowed: 2},
+		{Title: "Jane Eyre", Authors: models.StringArray{"Charlotte Brontë"}, Subjects: models.StringArray{"Governesses"}, Publisher: "Penguin", Language: "en", Year: 1847, AvailableCopies: 1, TimesBorrowed: 7},
+		{Title: "Madame Bovary", Authors: models.StringArray{"Gustave Flaubert"}, Subjects: models.StringArray{"Adultery"}, Publisher: "Gallimard", Language: "fr", Year: 1857, AvailableCopies: 3, TimesBorrowed: 1},
+	}
+	for i := range books {
+		books[i].LibID, books[i].TotalCopies = libID, books[i].AvailableCopies+1
+		if err := config.DB.Create(&books[i]).Error; err != nil {
+			t.Fatalf("failed to create book: %v", err)
+		}
+	}
+
+	return books
+}
+
+func titlesOf(hits []search.Hit) []string {
+	titles := []string{}
+	for _, hit := range hits {
+		titles = append(titles, hit.Title)
+	}
+	return titles
+}
+
+func TestPostgresRanking(t *testing.T) {
+	testutil.SetupPostgres(t)
+
+	library := testutil.CreateLibrary(t, "Library")
+	other := testutil.CreateLibrary(t, "Other")
+	catalog(t, library.ID)
+	catalog(t, other.ID)
+	db := tenant.ForLibrary(library.ID)
+
+	// the trigger made every book searchable
+	var missing int64
+	config.DB.Model(&models.BookInventory{}).Where("search_vector IS NULL").Count(&missing)
+	assert.Equal(t, int64(0), missing)
+
+	// a title match ranks above author matches, the other library's books aren't found
+	page, err := search.Find(db, search.Query{Text: "jane"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), page.Total)
+	assert.Len(t, page.Results, 5)
+	assert.Equal(t, "Jane Eyre", page.Results[0].Title)
+	assert.Equal(t, "<mark>Jane</mark> Eyre", page.Results[0].Highlight)
+	assert.Greater(t, page.Results[0].Rank, page.Results[1].Rank)
+	assert.Contains(t, page.Results[1].Snippet, "<mark>Jane</mark> Austen")
+
+	// every word has to match, as a word or the start of one
+	page, err = search.Find(db, search.Query{Text: "austen pers"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Persuasion"}, titlesOf(page.Results))
+
+	page, err = search.Find(db, search.Query{Text: "england gothic"})
+	assert.NoError(t, err)
+	assert.Empty(t, page.Results)
+	assert.Empty(t, page.NextCursor)
+
+	// an isbn finds its book, in any form
+	page, err = search.Find(db, search.Query{Text: "0-14-143951-3"})
+	assert.NoError(t, err)
+	assert.Equal(t, "Pride and Prejudice", page.Results[0].Title)
+
+	// misspelled titles are only found with pg_trgm
+	var trigrams bool
+	config.DB.Raw("SELECT EXISTS (SELECT 1 FROM pg_extension WHERE extname = 'pg_trgm')").Scan(&trigrams)
+	if trigrams {
+		page, err = search.Find(db, search.Query{Text: "northanger abey"})
+		assert.NoError(t, err)
+		assert.Equal(t, "Northanger Abbey", page.Results[0].Title)
+	}
+}
+
+// the titles of every page of the query, following the cursors
+func allPages(t *testing.T, db *gorm.DB, query search.Query) []string {
+	t.Helper()
+
+	titles := []string{}
+	for i := 0; i < 20; i++ {
+		page, err := search.Find(db, query)
+		if !assert.NoError(t, err) {
+			return titles
+		}
+		titles = append(titles, titlesOf(page.Results)...)
+
+		if page.NextCursor == "" {
+			return titles
+		}
+		query.Cursor = page.NextCursor
+	}
+
+	t.Fatalf("the pages of %+v don't end", query)
+	return titles
+}
+
+func TestPostgresCursors(t *testing.T) {
+	testutil.SetupPostgres(t)
+
+	library := testutil.CreateLibrary(t, "Library")
+	catalog(t, library.ID)
+	db := tenant.ForLibrary(library.ID)
+
+	// books with the same count are ordered by id, pages of two hold the same books as a single page
+	sorts := map[string][]string{
+		search.SortTitle:        {"Emma", "Jane Eyre", "Madame Bovary", "Northanger Abbey", "Persuasion", "Pride and Prejudice"},
+		search.SortNewest:       {"Madame Bovary", "Jane Eyre", "Northanger Abbey", "Persuasion", "Emma", "Pride and Prejudice"},
+		search.SortBorrowed:     {"Emma", "Jane Eyre", "Pride and Prejudice", "Persuasion", "Northanger Abbey", "Madame Bovary"},
+		search.SortAvailability: {"Madame Bovary", "Pride and Prejudice", "Persuasion", "Northanger Abbey", "Jane Eyre", "Emma"},
+	}
+	for sort, expected := range sorts {
+		assert.Equal(t, expected, allPages(t, db, search.Query{Sort: sort, Limit: 2}), sort)
+		assert.Equal(t, expected, allPages(t, db, search.Query{Sort: sort, Limit: 100}), sort)
+	}
+
+	// the austen novels rank the same, the rank and then the id order them across pages
+	single, err := search.Find(db, search.Query{Text: "jane", Limit: 100})
+	assert.NoError(t, err)
+	for _, limit := range []int{1, 2, 4} {
+		assert.Equal(t, titlesOf(single.Results), allPages(t, db, search.Query{Text: "jane", Sort: search.SortRelevance, Limit: limit}))
+	}
+
+	// filters and a sort other than relevance apply to a text search and its pages too
+	assert.Equal(t, []string{"Emma", "Pride and Prejudice"}, allPages(t, db, search.Query{Text: "austen", Publisher: "penguin", Sort: search.SortBorrowed, Limit: 1}))
+	assert.Equal(t, []string{"Northanger Abbey", "Persuasion"}, allPages(t, db, search.Query{YearFrom: 1816, YearTo: 1820, Sort: search.SortNewest, Limit: 1}))
+
+	// a cursor only continues the sort it was made for
+	page, err := search.Find(db, search.Query{Sort: search.SortBorrowed, Limit: 2})
+	assert.NoError(t, err)
+	_, err = search.Find(db, search.Query{Sort: search.SortTitle, Cursor: page.NextCursor, Limit: 2})
+	assert.ErrorIs(t, err, search.ErrInvalidCursor)
+}
+
+func TestPostgresFacets(t *testing.T) {
+	testutil.SetupPostgres(t)
+
+	library := testutil.CreateLibrary(t, "Library")
+	other := testutil.CreateLibrary(t, "Other")
+	catalog(t, library.ID)
+	catalog(t, other.ID)
+	db := tenant.ForLibrary(library.ID)
+
+	// the facets count every match of the library, not only the page
+	page, err := search.Find(db, search.Query{Text: "austen", Limit: 1})
+	assert.NoError(t, err)
+	assert.Len(t, page.Results, 1)
+	assert.Equal(t, int64(4), page.Total)
+	assert.Equal(t, []search.FacetCount{{Value: "Jane Austen", Count: 4}}, page.Facets.Authors)
+	assert.Equal(t, []search.FacetCount{{Value: "Oxford", Count: 2}, {Value: "Penguin", Count: 2}}, page.Facets.Publishers)
+	assert.Equal(t, []search.FacetCount{{Value: "England", Count: 3}, {Value: "Courtship", Count: 1}, {Value: "Gothic", Count: 1}}, page.Facets.Subjects)
+	assert.Equal(t, []search.FacetCount{{Value: "en", Count: 4}}, page.Facets.Languages)
+	assert.Equal(t, []search.FacetCount{{Value: "1817", Count: 2}, {Value: "1813", Count: 1}, {Value: "1815", Count: 1}}, page.Facets.Years)
+	assert.Equal(t, int64(3), page.Facets.Available)
+
+	// filters narrow the facets as well
+	page, err = search.Find(db, search.Query{Language: "FR", AvailableOnly: true})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Madame Bovary"}, titlesOf(page.Results))
+	assert.Equal(t, []search.FacetCount{{Value: "Gustave Flaubert", Count: 1}}, page.Facets.Authors)
+	assert.Equal(t, []search.FacetCount{{Value: "fr", Count: 1}}, page.Facets.Languages)
+
+	// no match, no facets
+	page, err = search.Find(db, search.Query{Text: "dickens"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), page.Total)
+	assert.Equal(t, []search.FacetCount{}, page.Facets.Authors)
+	assert.Equal(t, []search.FacetCount{}, page.Facets.Years)
+	assert.Equal(t, int64(0), page.Facets.Available)
+}
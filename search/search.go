@@ -0,0 +1,224 @@
+package search
+
+import (
+	"errors"
+	"html"
+	"project/libraryManagement/isbn"
+	"project/libraryManagement/models"
+	"strings"
+	"unicode"
+
+	"gorm.io/gorm"
+)
+
+// results of a page when no limit is given, the most a page returns and the values listed per facet
+const (
+	DefaultLimit = 20
+	MaxLimit     = 100
+	FacetLimit   = 10
+)
+
+// relevance of a match in each field, the default weights postgres ranks the a, b, c and d labels with
+const (
+	weightTitle     = 1.0
+	weightAuthors   = 0.4
+	weightSubjects  = 0.2
+	weightPublisher = 0.1
+)
+
+// sort keys, relevance only applies to a text search and is its default, title is the default otherwise
+const (
+	SortRelevance    = "relevance"
+	SortTitle        = "title"
+	SortNewest       = "newest"
+	SortBorrowed     = "borrowed"
+	SortAvailability = "availability"
+)
+
+var (
+	ErrInvalidSort   = errors.New("sort must be relevance, title, newest, borrowed or availability")
+	ErrInvalidCursor = errors.New("invalid cursor")
+	ErrInvalidYears  = errors.New("yearFrom must not be after yearTo")
+)
+
+// a catalog query: the text search, the filters, the order and the page
+type Query struct {
+	Text          string
+	Author        string
+	Publisher     string
+	Subject       string
+	Language      string
+	YearFrom      uint
+	YearTo        uint
+	AvailableOnly bool
+	Sort          string
+	Cursor        string
+	Limit         int
+}
+
+// a book matching the query, the highlights mark the matched words with <mark>
+type Hit struct {
+	models.BookInventory
+	Rank      float64 `json:"rank"`
+	Highlight string  `json:"highlight"`
+	Snippet   string  `json:"snippet"`
+}
+
+// number of matching books with a value
+type FacetCount struct {
+	Value string `json:"value"`
+	Count int64  `json:"count"`
+}
+
+// most common values among every matching book, not only the page
+type Facets struct {
+	Authors    []FacetCount `json:"authors"`
+	Publishers []FacetCount `json:"publishers"`
+	Subjects   []FacetCount `json:"subjects"`
+	Languages  []FacetCount `json:"languages"`
+	Years      []FacetCount `json:"years"`
+	Available  int64        `json:"available"`
+}
+
+// a page of results, the next page is requested with its cursor, empty on the last page
+type Page struct {
+	Results    []Hit  `json:"results"`
+	NextCursor string `json:"nextCursor"`
+	Total      int64  `json:"total"`
+	Facets     Facets `json:"facets"`
+}
+
+// books matching the query: with a text every word has to match the title, authors, subjects or publisher
+// as a word or the start of a word, titles also match misspelled words, and an isbn finds its book
+func Find(db *gorm.DB, query Query) (*Page, error) {
+	terms := Terms(query.Text)
+
+	if query.Limit <= 0 {
+		query.Limit = DefaultLimit
+	}
+	if query.Limit > MaxLimit {
+		query.Limit = MaxLimit
+	}
+
+	if query.YearFrom != 0 && query.YearTo != 0 && query.YearFrom > query.YearTo {
+		return nil, ErrInvalidYears
+	}
+
+	switch query.Sort {
+	case "":
+		query.Sort = SortTitle
+		if len(terms) > 0 {
+			query.Sort = SortRelevance
+		}
+	case SortRelevance:
+		// nothing to rank by without a text
+		if len(terms) == 0 {
+			query.Sort = SortTitle
+		}
+	case SortTitle, SortNewest, SortBorrowed, SortAvailability:
+	default:
+		return nil, ErrInvalidSort
+	}
+
+	after, err := decodeCursor(query.Cursor, query.Sort)
+	if err != nil {
+		return nil, err
+	}
+
+	query.Language = strings.ToLower(strings.TrimSpace(query.Language))
+	normalized := isbnOf(query.Text, terms)
+
+	if db.Dialector.Name() == "postgres" {
+		return postgresFind(db, query, terms, normalized, after)
+	}
+
+	return fallbackFind(db, query, terms, normalized, after)
+}
+
+// every book matching the query in id order, size books at a time, e.g. to export them without loading the whole
+// catalog, the sort, cursor and limit of the query don't apply
+func Each(db *gorm.DB, query Query, size int, fn func(books []models.BookInventory) error) error {
+	var batch []models.BookInventory
+
+	if query.YearFrom != 0 && query.YearTo != 0 && query.YearFrom > query.YearTo {
+		return ErrInvalidYears
+	}
+
+	terms := Terms(query.Text)
+	query.Language = strings.ToLower(strings.TrimSpace(query.Language))
+	normalized := isbnOf(query.Text, terms)
+
+	if db.Dialector.Name() == "postgres" {
+		tx := db.Model(&models.BookInventory{})
+		if filters, args := filterSQL(query); filters != "" {
+			tx = tx.Where(filters, args...)
+		}
+		if len(terms) > 0 {
+			_, _, match, args := textSQL(terms, normalized)
+			tx = tx.Where(match, args...)
+		}
+
+		return tx.FindInBatches(&batch, size, func(*gorm.DB, int) error {
+			return fn(batch)
+		}).Error
+	}
+
+	// without postgres the batches are filtered in memory
+	return db.FindInBatches(&batch, size, func(*gorm.DB, int) error {
+		matching := []models.BookInventory{}
+		for _, book := range batch {
+			if !matchesFilters(book, query) {
+				continue
+			}
+			if len(terms) > 0 {
+				_, ok := score(book, terms)
+				if !ok && (normalized == "" || book.ISBN != normalized) {
+					continue
+				}
+			}
+			matching = append(matching, book)
+		}
+
+		if len(matching) == 0 {
+			return nil
+		}
+		return fn(matching)
+	}).Error
+}
+
+// the text as an isbn-13 when it is one, an isbn is matched as a whole instead of word by word
+func isbnOf(text string, terms []string) string {
+	if len(terms) == 0 {
+		return ""
+	}
+
+	parsed, err := isbn.Parse(text)
+	if err != nil {
+		return ""
+	}
+
+	return parsed
+}
+
+// lower cased words of the text, letters and digits only
+func Terms(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// text from the database with its <mark> tags kept and everything else escaped
+func markup(text string) string {
+	escaped := html.EscapeString(text)
+	return strings.NewReplacer("&lt;mark&gt;", "<mark>", "&lt;/mark&gt;", "</mark>").Replace(escaped)
+}
+
+// the page of hits and the cursor of the next one, one more hit than the limit is fetched to know if there is one
+func paginate(hits []Hit, limit int, sort string) ([]Hit, string) {
+	if len(hits) <= limit {
+		return hits, ""
+	}
+
+	hits = hits[:limit]
+	return hits, encodeCursor(positionOf(hits[limit-1], sort))
+}
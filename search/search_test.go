@@ -0,0 +1,103 @@
+package search
+
+import (
+	"project/libraryManagement/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTermsAndPrefixQuery(t *testing.T) {
+	terms := Terms("Harry  Pot'ter: & | !Goblet")
+	assert.Equal(t, []string{"harry", "pot", "ter", "goblet"}, terms)
+	assert.Equal(t, "harry:* & pot:* & ter:* & goblet:*", prefixQuery(terms))
+}
+
+func TestScoreWeighsFieldsAndTypos(t *testing.T) {
+	book := models.BookInventory{Title: "Harry Potter and the Goblet of Fire", Authors: models.StringArray{"J. K. Rowling"}, Subjects: models.StringArray{"Wizards"}, Publisher: "Bloomsbury"}
+
+	title, ok := score(book, Terms("harry potter"))
+	assert.True(t, ok)
+	assert.Equal(t, 1.0, title)
+
+	// prefixes and typos in the title match, with a lower rank
+	prefix, ok := score(book, Terms("harr pott"))
+	assert.True(t, ok)
+	assert.Less(t, prefix, title)
+
+	typo, ok := score(book, Terms("goblit"))
+	assert.True(t, ok)
+	assert.Less(t, typo, prefix)
+
+	author, ok := score(book, Terms("rowling"))
+	assert.True(t, ok)
+	assert.Less(t, author, title)
+
+	// every term has to match
+	_, ok = score(book, Terms("harry hermione"))
+	assert.False(t, ok)
+
+	// no typos in short words or outside the title
+	_, ok = score(book, Terms("fre"))
+	assert.False(t, ok)
+	_, ok = score(book, Terms("rowlin"))
+	assert.True(t, ok)
+	_, ok = score(book, Terms("rowlign"))
+	assert.False(t, ok)
+}
+
+func TestHighlight(t *testing.T) {
+	assert.Equal(t, "<mark>Harry</mark> <mark>Potter</mark> &amp; the &lt;Goblet&gt;", highlight("Harry Potter & the <Goblet>", Terms("harry pott"), true))
+	assert.Equal(t, "<mark>Harry</mark> &lt;b&gt;", markup("<mark>Harry</mark> <b>"))
+}
+
+func TestCursorKeepsTheSortOrder(t *testing.T) {
+	hits := []Hit{
+		{BookInventory: models.BookInventory{ID: 1, Title: "B", TimesBorrowed: 3}},
+		{BookInventory: models.BookInventory{ID: 2, Title: "A", TimesBorrowed: 3}},
+		{BookInventory: models.BookInventory{ID: 3, Title: "A", TimesBorrowed: 7}},
+	}
+
+	assert.True(t, positionOf(hits[1], SortTitle).before(positionOf(hits[2], SortTitle)))
+	assert.True(t, positionOf(hits[2], SortTitle).before(positionOf(hits[0], SortTitle)))
+	assert.True(t, positionOf(hits[2], SortBorrowed).before(positionOf(hits[0], SortBorrowed)))
+	assert.True(t, positionOf(hits[0], SortBorrowed).before(positionOf(hits[1], SortBorrowed)))
+	assert.True(t, positionOf(hits[2], SortNewest).before(positionOf(hits[0], SortNewest)))
+
+	page, cursor := paginate(hits, 2, SortBorrowed)
+	assert.Len(t, page, 2)
+
+	p, err := decodeCursor(cursor, SortBorrowed)
+	assert.NoError(t, err)
+	assert.Equal(t, positionOf(hits[1], SortBorrowed), *p)
+
+	_, err = decodeCursor(cursor, SortTitle)
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+	_, err = decodeCursor("not a cursor", SortBorrowed)
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+
+	_, cursor = paginate(hits, 3, SortBorrowed)
+	assert.Empty(t, cursor)
+}
+
+func TestFiltersAndFacets(t *testing.T) {
+	book := models.BookInventory{Authors: models.StringArray{"Jane Austen"}, Publisher: "Penguin", Language: "en", Year: 1815, AvailableCopies: 1}
+
+	assert.True(t, matchesFilters(book, Query{Author: "jane austen", Publisher: "PENGUIN", Language: "en", YearFrom: 1800, YearTo: 1815, AvailableOnly: true}))
+	assert.False(t, matchesFilters(book, Query{Author: "Austen"}))
+	assert.False(t, matchesFilters(book, Query{YearFrom: 1816}))
+	assert.False(t, matchesFilters(book, Query{Language: "fr"}))
+
+	book.AvailableCopies = 0
+	assert.False(t, matchesFilters(book, Query{AvailableOnly: true}))
+
+	facets := countFacets([]Hit{
+		{BookInventory: models.BookInventory{Authors: models.StringArray{"A", "B"}, Language: "en", Year: 2001, AvailableCopies: 1}},
+		{BookInventory: models.BookInventory{Authors: models.StringArray{"B", "B"}, Language: "fr"}},
+	})
+	assert.Equal(t, []FacetCount{{"B", 2}, {"A", 1}}, facets.Authors)
+	assert.Equal(t, []FacetCount{{"en", 1}, {"fr", 1}}, facets.Languages)
+	assert.Equal(t, []FacetCount{{"2001", 1}}, facets.Years)
+	assert.Equal(t, []FacetCount{}, facets.Publishers)
+	assert.Equal(t, int64(1), facets.Available)
+}
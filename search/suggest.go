@@ -0,0 +1,212 @@
+package search
+
+import (
+	"project/libraryManagement/models"
+	"sort"
+	"strings"
+	"sync"
+
+	"gorm.io/gorm"
+)
+
+// suggestions returned when no limit is given and the most a request returns
+const (
+	DefaultSuggestions = 8
+	MaxSuggestions     = 20
+)
+
+// what a suggestion completes
+const (
+	KindTitle   = "title"
+	KindAuthor  = "author"
+	KindSubject = "subject"
+)
+
+// a completion of what the reader typed and the number of books it finds
+type Suggestion struct {
+	Text  string `json:"text"`
+	Kind  string `json:"kind"`
+	Books int    `json:"books"`
+}
+
+// a title, author or subject under one of its keys, every value is found from the start of each of its words
+type completion struct {
+	key   string
+	value *Suggestion
+	start bool
+}
+
+// the completions of a library sorted by key, so the ones of a prefix follow each other
+type prefixIndex struct {
+	completions []completion
+}
+
+// the indexes of the libraries, built on the first suggestion and dropped when the catalog changes,
+// the version of a library tells a build that it was changed in the meantime
+var suggestions = struct {
+	sync.Mutex
+	indexes  map[uint]*prefixIndex
+	versions map[uint]uint64
+}{indexes: map[uint]*prefixIndex{}, versions: map[uint]uint64{}}
+
+// lower cased text with single spaces, keys and prefixes are compared this way
+func normalize(text string) string {
+	return strings.Join(strings.Fields(strings.ToLower(text)), " ")
+}
+
+// index of the titles, authors and subjects of the books
+func newPrefixIndex(books []models.BookInventory) *prefixIndex {
+	values := map[string]*Suggestion{}
+
+	for _, book := range books {
+		seen := map[string]bool{}
+		add := func(kind string, text string) {
+			text = strings.Join(strings.Fields(text), " ")
+			id := kind + ":" + strings.ToLower(text)
+			if text == "" || seen[id] {
+				return
+			}
+			seen[id] = true
+
+			if values[id] == nil {
+				values[id] = &Suggestion{Text: text, Kind: kind}
+			}
+			values[id].Books++
+		}
+
+		add(KindTitle, book.Title)
+		for _, author := range book.Authors {
+			add(KindAuthor, author)
+		}
+		for _, subject := range book.Subjects {
+			add(KindSubject, subject)
+		}
+	}
+
+	index := &prefixIndex{}
+	for _, value := range values {
+		key := normalize(value.Text)
+		for i := 0; i < len(key); i++ {
+			if i == 0 || key[i-1] == ' ' {
+				index.completions = append(index.completions, completion{key: key[i:], value: value, start: i == 0})
+			}
+		}
+	}
+
+	sort.Slice(index.completions, func(i, j int) bool {
+		return index.completions[i].key < index.completions[j].key
+	})
+
+	return index
+}
+
+// whether a ranks before b: values starting with the prefix before the ones with a later word starting with it,
+// then the ones finding the most books, then the shortest
+func (a completion) before(b completion) bool {
+	switch {
+	case a.start != b.start:
+		return a.start
+	case a.value.Books != b.value.Books:
+		return a.value.Books > b.value.Books
+	case len(a.value.Text) != len(b.value.Text):
+		return len(a.value.Text) < len(b.value.Text)
+	default:
+		return a.value.Text < b.value.Text
+	}
+}
+
+// the best completions of the prefix, only the limit best ones are kept while going through the matching keys
+func (index *prefixIndex) lookup(prefix string, limit int) []Suggestion {
+	prefix = normalize(prefix)
+	results := []Suggestion{}
+	if prefix == "" {
+		return results
+	}
+
+	top := make([]completion, 0, limit)
+
+	for i := sort.Search(len(index.completions), func(i int) bool { return index.completions[i].key >= prefix }); i < len(index.completions); i++ {
+		c := index.completions[i]
+		if !strings.HasPrefix(c.key, prefix) {
+			break
+		}
+
+		// a value matching from several of its words is listed once, at its best
+		j := 0
+		for j < len(top) && top[j].value != c.value {
+			j++
+		}
+		switch {
+		case j < len(top):
+			if !c.before(top[j]) {
+				continue
+			}
+		case len(top) < limit:
+			top = append(top, c)
+		case limit > 0 && c.before(top[len(top)-1]):
+			j = len(top) - 1
+		default:
+			continue
+		}
+
+		top[j] = c
+		for ; j > 0 && top[j].before(top[j-1]); j-- {
+			top[j], top[j-1] = top[j-1], top[j]
+		}
+	}
+
+	for _, c := range top {
+		results = append(results, *c.value)
+	}
+
+	return results
+}
+
+// titles, authors and subjects of the library completing the prefix, db has to be scoped to the library
+func Suggest(db *gorm.DB, libID uint, prefix string, limit int) ([]Suggestion, error) {
+	if limit <= 0 {
+		limit = DefaultSuggestions
+	}
+	if limit > MaxSuggestions {
+		limit = MaxSuggestions
+	}
+
+	suggestions.Lock()
+	index, version := suggestions.indexes[libID], suggestions.versions[libID]
+	suggestions.Unlock()
+
+	if index == nil {
+		var books []models.BookInventory
+		if err := db.Select("title", "authors", "subjects").Find(&books).Error; err != nil {
+			return nil, err
+		}
+		index = newPrefixIndex(books)
+
+		// an index built while the catalog changed is used once but not kept
+		suggestions.Lock()
+		if suggestions.versions[libID] == version {
+			suggestions.indexes[libID] = index
+		}
+		suggestions.Unlock()
+	}
+
+	return index.lookup(prefix, limit), nil
+}
+
+// drop the index of a library after its catalog changed, the next suggestion builds it again
+func RefreshSuggestions(libID uint) {
+	suggestions.Lock()
+	defer suggestions.Unlock()
+
+	delete(suggestions.indexes, libID)
+	suggestions.versions[libID]++
+}
+
+// drop every index, e.g. when the app moves to another database
+func ResetSuggestions() {
+	suggestions.Lock()
+	defer suggestions.Unlock()
+
+	suggestions.indexes = map[uint]*prefixIndex{}
+	suggestions.versions = map[uint]uint64{}
+}
@@ -0,0 +1,66 @@
+package search
+
+import (
+	"fmt"
+	"project/libraryManagement/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSuggestionsCompleteWordsOfTitlesAuthorsAndSubjects(t *testing.T) {
+	index := newPrefixIndex([]models.BookInventory{
+		{Title: "Harry Potter and the Goblet of Fire", Authors: models.StringArray{"J. K. Rowling"}, Subjects: models.StringArray{"Wizards"}},
+		{Title: "Harry Potter and the Chamber of Secrets", Authors: models.StringArray{"J. K. Rowling"}, Subjects: models.StringArray{"Wizards", "Harry Potter"}},
+		{Title: "Potter's Field", Authors: models.StringArray{"Ellis Peters"}},
+	})
+
+	// values starting with the prefix come first, then the ones a later word completes
+	assert.Equal(t, []Suggestion{
+		{Text: "Potter's Field", Kind: KindTitle, Books: 1},
+		{Text: "Harry Potter", Kind: KindSubject, Books: 1},
+		{Text: "Harry Potter and the Goblet of Fire", Kind: KindTitle, Books: 1},
+	}, index.lookup("  POTT", 3))
+
+	assert.Equal(t, []Suggestion{{Text: "J. K. Rowling", Kind: KindAuthor, Books: 2}}, index.lookup("rowl", 5))
+	assert.Equal(t, []Suggestion{{Text: "Wizards", Kind: KindSubject, Books: 2}}, index.lookup("wiz", 5))
+	assert.Len(t, index.lookup("harry potter and the", 5), 2)
+	assert.Empty(t, index.lookup("", 5))
+	assert.Empty(t, index.lookup("hermione", 5))
+}
+
+// a catalog of 20000 books with a few thousand authors and subjects
+func benchmarkCatalog() []models.BookInventory {
+	words := []string{"history", "of", "the", "garden", "river", "silent", "modern", "art", "war", "peace", "night", "city", "ocean", "stars", "data", "world"}
+
+	books := make([]models.BookInventory, 20000)
+	for i := range books {
+		books[i] = models.BookInventory{
+			Title:    fmt.Sprintf("%s %s %s volume %d", words[i%len(words)], words[(i/3)%len(words)], words[(i/7)%len(words)], i),
+			Authors:  models.StringArray{fmt.Sprintf("Author %d", i%3000)},
+			Subjects: models.StringArray{fmt.Sprintf("%s %d", words[(i/11)%len(words)], i%500)},
+		}
+	}
+
+	return books
+}
+
+func BenchmarkSuggest(b *testing.B) {
+	index := newPrefixIndex(benchmarkCatalog())
+
+	for _, prefix := range []string{"h", "gar", "silent ri", "author 12"} {
+		b.Run(prefix, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				index.lookup(prefix, DefaultSuggestions)
+			}
+		})
+	}
+}
+
+func BenchmarkBuildSuggestIndex(b *testing.B) {
+	books := benchmarkCatalog()
+
+	for i := 0; i < b.N; i++ {
+		newPrefixIndex(books)
+	}
+}
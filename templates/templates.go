@@ -0,0 +1,190 @@
+package templates
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"project/libraryManagement/models"
+	texttemplate "text/template"
+
+	"gorm.io/gorm"
+)
+
+// template names
+const (
+	OTP              = "otp"
+	AdminOnboarding  = "admin_onboarding"
+	ReaderOnboarding = "reader_onboarding"
+	RequestApproved  = "request_approved"
+	RequestRejected  = "request_rejected"
+	DueReminder      = "due_reminder"
+	OverdueNotice    = "overdue_notice"
+	HoldReady        = "hold_ready"
+)
+
+var (
+	ErrUnknownTemplate = errors.New("unknown email template")
+	ErrInvalidTemplate = errors.New("invalid email template")
+)
+
+//go:embed files
+var files embed.FS
+
+// values available to a template, Library and LogoURL are filled in by Render
+type Data map[string]interface{}
+
+// an email ready to be sent, with a plain text alternative
+type Rendered struct {
+	Subject string `json:"subject"`
+	Text    string `json:"text"`
+	HTML    string `json:"html"`
+}
+
+type defaultTemplate struct {
+	text *texttemplate.Template
+	html *htmltemplate.Template
+}
+
+var (
+	layout   = htmltemplate.Must(htmltemplate.ParseFS(files, "files/layout.html"))
+	defaults = map[string]defaultTemplate{}
+)
+
+// sample values used by previews and to validate overrides
+var samples = map[string]Data{
+	OTP:              {"Code": "123456", "ExpiresIn": "5m0s"},
+	AdminOnboarding:  {},
+	ReaderOnboarding: {},
+	RequestApproved:  {"RequestType": "issue", "Title": "The Pragmatic Programmer", "DueDate": "14 Mar 2025"},
+	RequestRejected:  {"RequestType": "issue", "Title": "The Pragmatic Programmer"},
+	DueReminder:      {"Title": "The Pragmatic Programmer", "DueDate": "14 Mar 2025"},
+	OverdueNotice:    {"Title": "The Pragmatic Programmer", "DueDate": "14 Mar 2025", "DaysLate": 7},
+	HoldReady:        {"Title": "The Pragmatic Programmer", "PickupDeadline": "17 Mar 2025 18:00"},
+}
+
+func init() {
+	for _, name := range Names() {
+		file := "files/" + name + ".tmpl"
+		defaults[name] = defaultTemplate{
+			text: texttemplate.Must(texttemplate.ParseFS(files, file)),
+			html: htmltemplate.Must(htmltemplate.ParseFS(files, file)),
+		}
+	}
+}
+
+// names of every template, in a stable order
+func Names() []string {
+	return []string{OTP, AdminOnboarding, ReaderOnboarding, RequestApproved, RequestRejected, DueReminder, OverdueNotice, HoldReady}
+}
+
+// sample values of a template
+func Sample(name string) Data {
+	data := Data{}
+	for key, value := range samples[name] {
+		data[key] = value
+	}
+
+	return data
+}
+
+// render a template for a library, applying the library's overrides and branding
+func Render(db *gorm.DB, libID uint, name string, data Data) (*Rendered, error) {
+	var library models.Library
+	var override models.EmailTemplate
+
+	if _, ok := defaults[name]; !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownTemplate, name)
+	}
+
+	if libID != 0 {
+		if err := db.First(&library, libID).Error; err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+
+		res := db.Where("lib_id = ? AND name = ?", libID, name).Limit(1).Find(&override)
+		if res.Error != nil {
+			return nil, res.Error
+		}
+	}
+
+	values := Data{"Library": library.Name, "LogoURL": library.LogoURL}
+	for key, value := range data {
+		values[key] = value
+	}
+
+	return render(name, override, values)
+}
+
+// check an override parses and renders with the sample data
+func Validate(name string, override models.EmailTemplate) error {
+	if _, ok := defaults[name]; !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownTemplate, name)
+	}
+
+	values := Sample(name)
+	values["Library"] = "Sample"
+	values["LogoURL"] = ""
+
+	_, err := render(name, override, values)
+	return err
+}
+
+func render(name string, override models.EmailTemplate, values Data) (*Rendered, error) {
+	var rendered Rendered
+	var content bytes.Buffer
+	var err error
+
+	tmpl := defaults[name]
+
+	if rendered.Subject, err = renderText(tmpl.text, "subject", override.Subject, values); err != nil {
+		return nil, err
+	}
+	if rendered.Text, err = renderText(tmpl.text, "text", override.Text, values); err != nil {
+		return nil, err
+	}
+
+	html := tmpl.html.Lookup("html")
+	if override.HTML != "" {
+		if html, err = htmltemplate.New("html").Parse(override.HTML); err != nil {
+			return nil, fmt.Errorf("%w: html: %v", ErrInvalidTemplate, err)
+		}
+	}
+	if err := html.Execute(&content, values); err != nil {
+		return nil, fmt.Errorf("%w: html: %v", ErrInvalidTemplate, err)
+	}
+
+	// wrap the content in the branded layout
+	var page bytes.Buffer
+	err = layout.Execute(&page, map[string]interface{}{
+		"Library": values["Library"],
+		"LogoURL": values["LogoURL"],
+		"Content": htmltemplate.HTML(content.String()),
+	})
+	if err != nil {
+		return nil, err
+	}
+	rendered.HTML = page.String()
+
+	return &rendered, nil
+}
+
+// render a text part, from the override when the library has one
+func renderText(tmpl *texttemplate.Template, part string, override string, values Data) (string, error) {
+	var out bytes.Buffer
+
+	t := tmpl.Lookup(part)
+	if override != "" {
+		var err error
+		if t, err = texttemplate.New(part).Parse(override); err != nil {
+			return "", fmt.Errorf("%w: %s: %v", ErrInvalidTemplate, part, err)
+		}
+	}
+
+	if err := t.Execute(&out, values); err != nil {
+		return "", fmt.Errorf("%w: %s: %v", ErrInvalidTemplate, part, err)
+	}
+
+	return out.String(), nil
+}
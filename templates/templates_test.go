@@ -0,0 +1,47 @@
+package templates_test
+
+import (
+	"project/libraryManagement/config"
+	"project/libraryManagement/models"
+	"project/libraryManagement/templates"
+	"project/libraryManagement/testutil"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEveryTemplateRendersItsSample(t *testing.T) {
+	for _, name := range templates.Names() {
+		assert.NoError(t, templates.Validate(name, models.EmailTemplate{}), name)
+	}
+}
+
+func TestLibraryOverridesAndBranding(t *testing.T) {
+	testutil.SetupDB(t)
+
+	library := testutil.CreateLibrary(t, "Riverside")
+	config.DB.Model(library).Update("logo_url", "https://riverside.test/logo.png")
+
+	rendered, err := templates.Render(config.DB, library.ID, templates.OTP, templates.Data{"Code": "<b>42</b>", "ExpiresIn": "5m0s"})
+	assert.NoError(t, err)
+	assert.Equal(t, "OTP for verification", rendered.Subject)
+	assert.Contains(t, rendered.Text, "<b>42</b>")
+	assert.Contains(t, rendered.HTML, "&lt;b&gt;42&lt;/b&gt;")
+	assert.Contains(t, rendered.HTML, `src="https://riverside.test/logo.png"`)
+
+	config.DB.Create(&models.EmailTemplate{LibID: library.ID, Name: templates.OTP, Subject: "{{.Library}} login code"})
+
+	rendered, err = templates.Render(config.DB, library.ID, templates.OTP, templates.Data{"Code": "42", "ExpiresIn": "5m0s"})
+	assert.NoError(t, err)
+	assert.Equal(t, "Riverside login code", rendered.Subject)
+	assert.True(t, strings.HasPrefix(rendered.Text, "Hey, Please use this otp"))
+
+	// other libraries keep the default
+	other := testutil.CreateLibrary(t, "Hillside")
+	rendered, _ = templates.Render(config.DB, other.ID, templates.OTP, templates.Data{"Code": "42", "ExpiresIn": "5m0s"})
+	assert.Equal(t, "OTP for verification", rendered.Subject)
+
+	assert.ErrorIs(t, templates.Validate(templates.OTP, models.EmailTemplate{HTML: "{{.Code"}), templates.ErrInvalidTemplate)
+	assert.ErrorIs(t, templates.Validate("welcome", models.EmailTemplate{}), templates.ErrUnknownTemplate)
+}
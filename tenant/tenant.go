@@ -0,0 +1,152 @@
+package tenant
+
+import (
+	"context"
+	"errors"
+	"project/libraryManagement/config"
+	"project/libraryManagement/models"
+	"reflect"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrCrossTenant = errors.New("record belongs to another library")
+
+type ctxKey struct{}
+
+var (
+	scopedMu sync.RWMutex
+
+	// tables constrained to the library of the request
+	scopedTables = map[string]bool{}
+)
+
+// attach the library of the authenticated user to the context
+func WithLibrary(ctx context.Context, libID uint) context.Context {
+	return context.WithValue(ctx, ctxKey{}, libID)
+}
+
+// library attached to the context, if any
+func LibraryFrom(ctx context.Context) (uint, bool) {
+	if ctx == nil {
+		return 0, false
+	}
+
+	libID, ok := ctx.Value(ctxKey{}).(uint)
+	return libID, ok
+}
+
+// database handle scoped to the library of the request
+func DB(c *gin.Context) *gorm.DB {
+	return config.DB.WithContext(c.Request.Context())
+}
+
+// database handle scoped to a given library, for work outside of a request
+func ForLibrary(libID uint) *gorm.DB {
+	return config.DB.WithContext(WithLibrary(context.Background(), libID))
+}
+
+// scope every library owned model
+func Setup(db *gorm.DB) error {
+	return Register(db, &models.BookInventory{}, &models.BookCopy{}, &models.RequestEvent{}, &models.IssueRegistery{}, &models.Hold{}, &models.LoanPolicy{}, &models.LedgerEntry{}, &models.NoticeLog{}, &models.OutboxMessage{}, &models.EmailTemplate{}, &models.Kiosk{}, &models.ReplacedCard{}, &models.ImportJob{}, &models.ImportRow{})
+}
+
+// register the scoping callbacks and the models they apply to, every model needs a LibID column
+func Register(db *gorm.DB, values ...interface{}) error {
+	for _, model := range values {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(model); err != nil {
+			return err
+		}
+
+		scopedMu.Lock()
+		scopedTables[stmt.Schema.Table] = true
+		scopedMu.Unlock()
+	}
+
+	if db.Callback().Query().Get("tenant:query") != nil {
+		return nil
+	}
+
+	if err := db.Callback().Query().Before("gorm:query").Register("tenant:query", scopeQuery); err != nil {
+		return err
+	}
+	if err := db.Callback().Row().Before("gorm:row").Register("tenant:row", scopeQuery); err != nil {
+		return err
+	}
+	if err := db.Callback().Update().Before("gorm:update").Register("tenant:update", scopeQuery); err != nil {
+		return err
+	}
+	if err := db.Callback().Delete().Before("gorm:delete").Register("tenant:delete", scopeQuery); err != nil {
+		return err
+	}
+	return db.Callback().Create().Before("gorm:create").Register("tenant:create", scopeCreate)
+}
+
+// library of the statement, only set for scoped tables with a library in the context
+func statementLibrary(db *gorm.DB) (uint, bool) {
+	if db.Statement.Schema == nil || db.Statement.Schema.LookUpField("LibID") == nil {
+		return 0, false
+	}
+
+	scopedMu.RLock()
+	scoped := scopedTables[db.Statement.Schema.Table]
+	scopedMu.RUnlock()
+
+	if !scoped {
+		return 0, false
+	}
+
+	return LibraryFrom(db.Statement.Context)
+}
+
+// constrain selects, updates and deletes to the library
+func scopeQuery(db *gorm.DB) {
+	libID, ok := statementLibrary(db)
+	if !ok {
+		return
+	}
+
+	column := db.Statement.Schema.LookUpField("LibID").DBName
+	db.Statement.AddClause(clause.Where{Exprs: []clause.Expression{
+		clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: column}, Value: libID},
+	}})
+}
+
+// fill in the library on new rows and refuse rows of another library
+func scopeCreate(db *gorm.DB) {
+	libID, ok := statementLibrary(db)
+	if !ok {
+		return
+	}
+
+	field := db.Statement.Schema.LookUpField("LibID")
+	ctx := db.Statement.Context
+
+	assign := func(rv reflect.Value) {
+		value, zero := field.ValueOf(ctx, rv)
+		if zero {
+			if err := field.Set(ctx, rv, libID); err != nil {
+				db.AddError(err)
+			}
+			return
+		}
+
+		if id, ok := value.(uint); ok && id != libID {
+			db.AddError(ErrCrossTenant)
+		}
+	}
+
+	rv := db.Statement.ReflectValue
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			assign(reflect.Indirect(rv.Index(i)))
+		}
+	case reflect.Struct:
+		assign(rv)
+	}
+}
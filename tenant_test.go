@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"project/libraryManagement/config"
+	"project/libraryManagement/models"
+	"project/libraryManagement/testutil"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// two libraries, each with an admin, a reader and a book
+type tenantFixture struct {
+	router      *gin.Engine
+	adminToken  string
+	readerToken string
+	ownBook     *models.BookInventory
+	otherBook   *models.BookInventory
+	otherEvent  models.RequestEvent
+}
+
+func setupTenants(t *testing.T) *tenantFixture {
+	gin.SetMode(gin.TestMode)
+	testutil.SetupDB(t)
+
+	own := testutil.CreateLibrary(t, "Own Library")
+	other := testutil.CreateLibrary(t, "Other Library")
+
+	admin := testutil.CreateUser(t, own.ID, "admin", "admin@own.test")
+	reader := testutil.CreateUser(t, own.ID, "reader", "reader@own.test")
+	otherReader := testutil.CreateUser(t, other.ID, "reader", "reader@other.test")
+
+	ownBook := testutil.CreateBook(t, own.ID, "Own Book", 2)
+	otherBook := testutil.CreateBook(t, other.ID, "Other Book", 2)
+
+	otherEvent := models.RequestEvent{BookId: otherBook.ID, ReaderId: otherReader.ID, RequestDate: time.Now(), RequestType: "issue", Status: "pending", LibID: other.ID}
+	config.DB.Create(&otherEvent)
+
+	r := SetupRouter()
+	registerRoutes(r)
+
+	return &tenantFixture{
+		router:      r,
+		adminToken:  testutil.Token(t, admin),
+		readerToken: testutil.Token(t, reader),
+		ownBook:     ownBook,
+		otherBook:   otherBook,
+		otherEvent:  otherEvent,
+	}
+}
+
+func (f *tenantFixture) do(method string, path string, token string, body interface{}) *httptest.ResponseRecorder {
+	var payload bytes.Buffer
+	if body != nil {
+		json.NewEncoder(&payload).Encode(body)
+	}
+
+	req, _ := http.NewRequest(method, path, &payload)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", token)
+
+	w := httptest.NewRecorder()
+	f.router.ServeHTTP(w, req)
+	return w
+}
+
+func TestAdminCannotTouchOtherLibraryInventory(t *testing.T) {
+	f := setupTenants(t)
+
+	cases := []struct {
+		name   string
+		method string
+		path   string
+		body   interface{}
+	}{
+		{"remove book", "DELETE", fmt.Sprintf("/admin/delete/book/%d", f.otherBook.ID), nil},
+		{"add book", "POST", "/admin/add/book", gin.H{"bookId": f.otherBook.ID, "copies": 1}},
+		{"update book", "PATCH", "/admin/update/book", gin.H{"bookId": f.otherBook.ID, "title": "Hijacked"}},
+		{"approve issue", "POST", "/admin/issue/approve", gin.H{"reqId": f.otherEvent.ReqId}},
+		{"approve return", "POST", "/admin/return/approve", gin.H{"reqId": f.otherEvent.ReqId}},
+		{"reject request", "POST", "/admin/reject/request", gin.H{"reqId": f.otherEvent.ReqId}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := f.do(tc.method, tc.path, f.adminToken, tc.body)
+			assert.Equal(t, http.StatusNotFound, w.Code)
+		})
+	}
+
+	// nothing of the other library has changed
+	var book models.BookInventory
+	config.DB.First(&book, f.otherBook.ID)
+	assert.Equal(t, "Other Book", book.Title)
+	assert.Equal(t, uint(2), book.TotalCopies)
+	assert.Equal(t, uint(2), book.AvailableCopies)
+
+	var event models.RequestEvent
+	config.DB.First(&event, f.otherEvent.ReqId)
+	assert.Equal(t, "pending", event.Status)
+}
+
+func TestAdminCanTouchOwnLibraryInventory(t *testing.T) {
+	f := setupTenants(t)
+
+	w := f.do("POST", "/admin/add/book", f.adminToken, gin.H{"bookId": f.ownBook.ID, "copies": 1})
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	var book models.BookInventory
+	config.DB.First(&book, f.ownBook.ID)
+	assert.Equal(t, uint(3), book.TotalCopies)
+}
+
+func TestReaderOnlySearchesOwnLibrary(t *testing.T) {
+	f := setupTenants(t)
+
+	w := f.do("POST", "/reader/book/search", f.readerToken, gin.H{"query": ""})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var res struct {
+		Result []models.BookInventory `json:"result"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &res)
+
+	if assert.Len(t, res.Result, 1) {
+		assert.Equal(t, f.ownBook.ID, res.Result[0].ID)
+	}
+}
+
+func TestReaderCannotRequestOtherLibraryBook(t *testing.T) {
+	f := setupTenants(t)
+
+	w := f.do("POST", "/reader/issue/request", f.readerToken, gin.H{"bookId": f.otherBook.ID})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = f.do("POST", "/reader/issue/request", f.readerToken, gin.H{"bookId": f.ownBook.ID})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// the request is stamped with the reader's library
+	var event models.RequestEvent
+	config.DB.Where("book_id = ?", f.ownBook.ID).First(&event)
+	assert.Equal(t, f.ownBook.LibID, event.LibID)
+}
+
+func TestAdminOnlyListsOwnLibraryRequests(t *testing.T) {
+	f := setupTenants(t)
+
+	w := f.do("GET", "/user/issues", f.adminToken, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var res struct {
+		Requests []models.RequestEvent `json:"requests"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &res)
+	assert.Empty(t, res.Requests)
+}
@@ -0,0 +1,163 @@
+package testutil
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"project/libraryManagement/cards"
+	"project/libraryManagement/config"
+	"project/libraryManagement/mailer"
+	"project/libraryManagement/models"
+	"project/libraryManagement/search"
+	"project/libraryManagement/tenant"
+	"project/libraryManagement/utils"
+	"testing"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// open a fresh sqlite database, migrate it and make it the app database
+func SetupDB(t testing.TB) *gorm.DB {
+	t.Helper()
+
+	// immediate transactions make sqlite serialize writers instead of failing with "database is locked"
+	dsn := filepath.Join(t.TempDir(), "test.db") + "?_busy_timeout=10000&_txlock=immediate"
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("failed to open test database: %v", err)
+	}
+
+	return use(t, db)
+}
+
+// empty the postgres database of TEST_DATABASE_URL, migrate it and make it the app database,
+// the test is skipped without one. Every table of that database is dropped
+func SetupPostgres(t testing.TB) *gorm.DB {
+	t.Helper()
+
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("failed to open test database: %v", err)
+	}
+
+	tables, err := db.Migrator().GetTables()
+	if err != nil {
+		t.Fatalf("failed to list the tables of the test database: %v", err)
+	}
+	for _, table := range tables {
+		if err := db.Migrator().DropTable(table); err != nil {
+			t.Fatalf("failed to drop %s: %v", table, err)
+		}
+	}
+
+	return use(t, db)
+}
+
+// migrate a test database and make it the app database for the rest of the test
+func use(t testing.TB, db *gorm.DB) *gorm.DB {
+	t.Helper()
+	t.Setenv("SECRET", "test-secret")
+
+	config.DB = db
+	if err := config.Migrate(db); err != nil {
+		t.Fatalf("failed to migrate test database: %v", err)
+	}
+	Mailer(t)
+
+	// suggestion indexes of the previous test's libraries
+	search.ResetSuggestions()
+
+	if err := tenant.Setup(db); err != nil {
+		t.Fatalf("failed to register tenant scoping: %v", err)
+	}
+
+	t.Cleanup(func() {
+		sqlDB, _ := db.DB()
+		sqlDB.Close()
+	})
+
+	return db
+}
+
+// record emails in memory for the rest of the test
+func Mailer(t testing.TB) *mailer.Recorder {
+	t.Helper()
+
+	recorder := mailer.NewRecorder()
+	previous := mailer.Set(recorder)
+	t.Cleanup(func() { mailer.Set(previous) })
+
+	return recorder
+}
+
+// create a library
+func CreateLibrary(t testing.TB, name string) *models.Library {
+	t.Helper()
+
+	library := models.Library{Name: name}
+	if err := config.DB.Create(&library).Error; err != nil {
+		t.Fatalf("failed to create library: %v", err)
+	}
+
+	return &library
+}
+
+// create a user of the library
+func CreateUser(t testing.TB, libID uint, role string, email string) *models.Users {
+	t.Helper()
+
+	user := models.Users{Email: email, Role: role, LibID: libID}
+	if role == "reader" {
+		if err := cards.Assign(config.DB, &user); err != nil {
+			t.Fatalf("failed to assign a card: %v", err)
+		}
+	}
+	if err := config.DB.Create(&user).Error; err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+
+	return &user
+}
+
+// create a book of the library
+func CreateBook(t testing.TB, libID uint, title string, copies uint) *models.BookInventory {
+	t.Helper()
+
+	book := models.BookInventory{Title: title, Authors: models.StringArray{"Test Author"}, Publisher: "Test Publisher", TotalCopies: copies, AvailableCopies: copies, LibID: libID}
+	if err := config.DB.Create(&book).Error; err != nil {
+		t.Fatalf("failed to create book: %v", err)
+	}
+
+	// one available copy per counted copy, numbered after the library's copies
+	var existing int64
+	config.DB.Model(&models.BookCopy{}).Where("lib_id = ?", libID).Count(&existing)
+	for i := uint(0); i < copies; i++ {
+		accession := uint(existing) + i + 1
+		item := models.BookCopy{BookID: book.ID, Barcode: fmt.Sprintf("%08d", accession), AccessionNumber: accession, Condition: "good", Status: "available", LibID: libID}
+		if err := config.DB.Create(&item).Error; err != nil {
+			t.Fatalf("failed to create copy: %v", err)
+		}
+	}
+
+	return &book
+}
+
+// start a session for the user and return its access token
+func Token(t testing.TB, user *models.Users) string {
+	t.Helper()
+
+	tokens, err := utils.CreateSession(user, "test", "127.0.0.1")
+	if err != nil {
+		t.Fatalf("failed to create session: %v", err)
+	}
+
+	return tokens.AccessToken
+}
@@ -0,0 +1,40 @@
+package utils
+
+import (
+	"errors"
+	"project/libraryManagement/config"
+	"project/libraryManagement/models"
+	"time"
+)
+
+// kiosk credentials are prefixed so they are recognizable in a config file
+const kioskCredentialPrefix = "kiosk_"
+
+var ErrInvalidKioskCredential = errors.New("invalid or revoked kiosk credential")
+
+// new kiosk credential and the hash stored for it, the credential is only shown once
+func NewKioskCredential() (string, string, error) {
+	token, err := randomToken(32)
+	if err != nil {
+		return "", "", err
+	}
+
+	credential := kioskCredentialPrefix + token
+	return credential, hashRefreshToken(credential), nil
+}
+
+// kiosk holding the credential, revoked kiosks are refused
+func FindKiosk(credential string) (*models.Kiosk, error) {
+	var kiosk models.Kiosk
+
+	res := config.DB.Where("credential_hash = ? AND revoked_at IS NULL", hashRefreshToken(credential)).First(&kiosk)
+	if res.Error != nil {
+		return nil, ErrInvalidKioskCredential
+	}
+
+	now := time.Now()
+	kiosk.LastSeenAt = &now
+	config.DB.Model(&kiosk).Update("last_seen_at", now)
+
+	return &kiosk, nil
+}
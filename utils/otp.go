@@ -0,0 +1,229 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"project/libraryManagement/config"
+	"project/libraryManagement/mailer"
+	"project/libraryManagement/models"
+	"project/libraryManagement/templates"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// otp purposes, a challenge can only be verified for the purpose it was issued for
+const (
+	OTPPurposeLogin               = "login"
+	OTPPurposeLibraryRegistration = "library_registration"
+)
+
+var (
+	ErrOTPNotFound         = errors.New("no otp has been requested")
+	ErrOTPExpired          = errors.New("otp has expired, please request a new one")
+	ErrOTPAttemptsExceeded = errors.New("too many invalid attempts, please try again later")
+	ErrOTPInvalid          = errors.New("invalid otp")
+	ErrOTPCooldown         = errors.New("otp was sent recently, please wait before requesting a new one")
+	ErrOTPInvalidPurpose   = errors.New("invalid otp purpose")
+)
+
+// otp settings, configurable through the environment
+func otpTTL() time.Duration {
+	return config.GetEnvDuration("OTP_TTL", 5*time.Minute)
+}
+
+func otpMaxAttempts() uint {
+	return uint(config.GetEnvInt("OTP_MAX_ATTEMPTS", 5))
+}
+
+func otpResendCooldown() time.Duration {
+	return config.GetEnvDuration("OTP_RESEND_COOLDOWN", time.Minute)
+}
+
+func otpLockout() time.Duration {
+	return config.GetEnvDuration("OTP_LOCKOUT", 15*time.Minute)
+}
+
+// check if the purpose is one we issue challenges for
+func ValidOTPPurpose(purpose string) bool {
+	return purpose == OTPPurposeLogin || purpose == OTPPurposeLibraryRegistration
+}
+
+// random number
+func getRandNum() (string, error) {
+	nBig, e := rand.Int(rand.Reader, big.NewInt(9000))
+	if e != nil {
+		return "", e
+	}
+	return strconv.FormatInt(nBig.Int64()+1000, 10), nil
+}
+
+// hash the otp, binding it to the user and the purpose
+func hashOTP(userID uint, purpose string, code string) string {
+	mac := hmac.New(sha256.New, []byte(os.Getenv("SECRET")))
+	mac.Write([]byte(fmt.Sprintf("%d:%s:%s", userID, purpose, code)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// latest challenge which has not been consumed yet
+func latestChallenge(userID uint, purpose string) (*models.OTPChallenge, error) {
+	var challenge models.OTPChallenge
+	res := config.DB.Where("user_id = ? AND purpose = ? AND consumed_at IS NULL", userID, purpose).Order("id desc").First(&challenge)
+
+	if res.Error != nil {
+		return nil, res.Error
+	}
+
+	return &challenge, nil
+}
+
+// send otp for verification
+func SendOTP(email string, purpose string) error {
+	if !ValidOTPPurpose(purpose) {
+		return ErrOTPInvalidPurpose
+	}
+
+	user, err := FindUser(email)
+	if err != nil {
+		return errors.New("error finding user")
+	}
+
+	now := time.Now()
+	var attempts uint
+
+	previous, err := latestChallenge(user.ID, purpose)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return errors.New("error finding otp")
+	}
+
+	if previous != nil {
+		if previous.LockedUntil != nil && now.Before(*previous.LockedUntil) {
+			return ErrOTPAttemptsExceeded
+		}
+
+		if now.Before(previous.LastSentAt.Add(otpResendCooldown())) {
+			return ErrOTPCooldown
+		}
+
+		// a resend keeps the attempt counter, so resending doesn't reset the lockout
+		if previous.LockedUntil == nil && now.Before(previous.ExpiresAt) {
+			attempts = previous.Attempts
+		}
+	}
+
+	str, err := getRandNum()
+	if err != nil {
+		fmt.Println(err.Error())
+		return errors.New("error generating otp")
+	}
+
+	challenge := models.OTPChallenge{
+		UserID:      user.ID,
+		Purpose:     purpose,
+		CodeHash:    hashOTP(user.ID, purpose, str),
+		Attempts:    attempts,
+		MaxAttempts: otpMaxAttempts(),
+		ExpiresAt:   now.Add(otpTTL()),
+		LastSentAt:  now,
+	}
+
+	// the code is never stored in clear, so it is mailed directly instead of going through the outbox
+	rendered, err := templates.Render(config.DB, user.LibID, templates.OTP, templates.Data{"Code": str, "ExpiresIn": otpTTL().String()})
+	if err != nil {
+		return errors.New("error rendering otp")
+	}
+
+	// replace any older challenge for the same purpose
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		del := tx.Where("user_id = ? AND purpose = ? AND consumed_at IS NULL", user.ID, purpose).Delete(&models.OTPChallenge{})
+		if del.Error != nil {
+			return del.Error
+		}
+
+		return tx.Create(&challenge).Error
+	})
+	if err != nil {
+		return errors.New("error saving otp")
+	}
+
+	if err := mailer.Send(email, rendered.Subject, rendered.Text, rendered.HTML); err != nil {
+		// the code never reached the user, a new one can be requested right away
+		config.DB.Model(&challenge).Update("last_sent_at", time.Time{})
+		fmt.Println("error sending otp:", err)
+		return errors.New("error sending otp")
+	}
+
+	return nil
+}
+
+// verify otp and send user back
+func VerifyOTP(email, otp, purpose string) (*models.Users, error) {
+	if !ValidOTPPurpose(purpose) {
+		return nil, ErrOTPInvalidPurpose
+	}
+
+	user, err := FindUser(email)
+	if err != nil {
+		return nil, errors.New("user not found")
+	}
+
+	challenge, err := latestChallenge(user.ID, purpose)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrOTPNotFound
+		}
+		return nil, errors.New("error finding otp")
+	}
+
+	now := time.Now()
+
+	if challenge.LockedUntil != nil && now.Before(*challenge.LockedUntil) {
+		return nil, ErrOTPAttemptsExceeded
+	}
+
+	// once the lockout is over the used up code stays refused, a new one has to be requested
+	if challenge.LockedUntil != nil || challenge.Attempts >= challenge.MaxAttempts {
+		return nil, ErrOTPExpired
+	}
+
+	if now.After(challenge.ExpiresAt) {
+		return nil, ErrOTPExpired
+	}
+
+	// compare otp
+	if !hmac.Equal([]byte(hashOTP(user.ID, purpose, otp)), []byte(challenge.CodeHash)) {
+		// count the attempt atomically so parallel guesses can't exceed the limit
+		res := config.DB.Model(&models.OTPChallenge{}).
+			Where("id = ? AND attempts < max_attempts", challenge.ID).
+			Update("attempts", gorm.Expr("attempts + 1"))
+		if res.Error != nil {
+			return nil, errors.New("error updating the otp")
+		}
+		if res.RowsAffected == 0 || challenge.Attempts+1 >= challenge.MaxAttempts {
+			config.DB.Model(&models.OTPChallenge{}).Where("id = ?", challenge.ID).Update("locked_until", now.Add(otpLockout()))
+			return nil, ErrOTPAttemptsExceeded
+		}
+
+		return nil, ErrOTPInvalid
+	}
+
+	// consume the challenge, only one verification can win
+	res := config.DB.Model(&models.OTPChallenge{}).
+		Where("id = ? AND consumed_at IS NULL", challenge.ID).
+		Update("consumed_at", now)
+	if res.Error != nil {
+		return nil, errors.New("error updating the otp")
+	}
+	if res.RowsAffected == 0 {
+		return nil, ErrOTPNotFound
+	}
+
+	return user, nil
+}
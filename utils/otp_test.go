@@ -0,0 +1,151 @@
+package utils
+
+import (
+	"path/filepath"
+	"project/libraryManagement/config"
+	"project/libraryManagement/mailer"
+	"project/libraryManagement/models"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// open a fresh sqlite database with the tables of the users, their otps and sessions and make it the app database
+func setupDB(t *testing.T) {
+	t.Helper()
+	t.Setenv("SECRET", "test-secret")
+
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("failed to open test database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.Library{}, &models.Users{}, &models.OTPChallenge{}, &models.Session{}, &models.EmailTemplate{}); err != nil {
+		t.Fatalf("failed to migrate test database: %v", err)
+	}
+
+	config.DB = db
+	t.Cleanup(func() {
+		sqlDB, _ := db.DB()
+		sqlDB.Close()
+	})
+}
+
+func createUser(t *testing.T, email string) *models.Users {
+	t.Helper()
+
+	user := models.Users{Email: email, Role: "reader"}
+	if err := config.DB.Create(&user).Error; err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+
+	return &user
+}
+
+// the challenge SendOTP would have saved for the code, without sending it
+func createChallenge(t *testing.T, user *models.Users, purpose string, code string) *models.OTPChallenge {
+	t.Helper()
+
+	now := time.Now()
+	challenge := models.OTPChallenge{UserID: user.ID, Purpose: purpose, CodeHash: hashOTP(user.ID, purpose, code), MaxAttempts: otpMaxAttempts(),
+		ExpiresAt: now.Add(otpTTL()), LastSentAt: now}
+	if err := config.DB.Create(&challenge).Error; err != nil {
+		t.Fatalf("failed to create otp challenge: %v", err)
+	}
+
+	return &challenge
+}
+
+func TestOTPChallenges(t *testing.T) {
+	setupDB(t)
+	user := createUser(t, "reader@library.test")
+	createChallenge(t, user, OTPPurposeLogin, "1234")
+
+	// only the purpose it was sent for accepts it
+	_, err := VerifyOTP(user.Email, "1234", OTPPurposeLibraryRegistration)
+	assert.ErrorIs(t, err, ErrOTPNotFound)
+	_, err = VerifyOTP(user.Email, "1234", "password_reset")
+	assert.ErrorIs(t, err, ErrOTPInvalidPurpose)
+	assert.ErrorIs(t, SendOTP(user.Email, "password_reset"), ErrOTPInvalidPurpose)
+
+	// a new code can't be requested during the cooldown
+	assert.ErrorIs(t, SendOTP(user.Email, OTPPurposeLogin), ErrOTPCooldown)
+
+	_, err = VerifyOTP(user.Email, "4321", OTPPurposeLogin)
+	assert.ErrorIs(t, err, ErrOTPInvalid)
+
+	verified, err := VerifyOTP(user.Email, "1234", OTPPurposeLogin)
+	assert.NoError(t, err)
+	assert.Equal(t, user.ID, verified.ID)
+
+	// a code works once
+	_, err = VerifyOTP(user.Email, "1234", OTPPurposeLogin)
+	assert.ErrorIs(t, err, ErrOTPNotFound)
+}
+
+func TestOTPExpires(t *testing.T) {
+	setupDB(t)
+	user := createUser(t, "reader@library.test")
+	challenge := createChallenge(t, user, OTPPurposeLogin, "1234")
+	config.DB.Model(challenge).Update("expires_at", time.Now().Add(-time.Second))
+
+	_, err := VerifyOTP(user.Email, "1234", OTPPurposeLogin)
+	assert.ErrorIs(t, err, ErrOTPExpired)
+}
+
+func TestOTPAttemptLimit(t *testing.T) {
+	setupDB(t)
+	t.Setenv("OTP_MAX_ATTEMPTS", "3")
+	user := createUser(t, "reader@library.test")
+	challenge := createChallenge(t, user, OTPPurposeLogin, "1234")
+
+	for i := 0; i < 2; i++ {
+		_, err := VerifyOTP(user.Email, "4321", OTPPurposeLogin)
+		assert.ErrorIs(t, err, ErrOTPInvalid)
+	}
+	_, err := VerifyOTP(user.Email, "4321", OTPPurposeLogin)
+	assert.ErrorIs(t, err, ErrOTPAttemptsExceeded)
+
+	config.DB.First(challenge, challenge.ID)
+	assert.Equal(t, uint(3), challenge.Attempts)
+	assert.NotNil(t, challenge.LockedUntil)
+
+	// once locked even the right code is refused, and no new one is sent until the lockout ends
+	_, err = VerifyOTP(user.Email, "1234", OTPPurposeLogin)
+	assert.ErrorIs(t, err, ErrOTPAttemptsExceeded)
+
+	config.DB.Model(challenge).Update("last_sent_at", time.Now().Add(-time.Hour))
+	assert.ErrorIs(t, SendOTP(user.Email, OTPPurposeLogin), ErrOTPAttemptsExceeded)
+}
+
+func TestOTPLockoutEnds(t *testing.T) {
+	setupDB(t)
+	t.Setenv("OTP_MAX_ATTEMPTS", "1")
+	user := createUser(t, "reader@library.test")
+	challenge := createChallenge(t, user, OTPPurposeLogin, "1234")
+
+	recorder := mailer.NewRecorder()
+	previous := mailer.Set(recorder)
+	t.Cleanup(func() { mailer.Set(previous) })
+
+	_, err := VerifyOTP(user.Email, "4321", OTPPurposeLogin)
+	assert.ErrorIs(t, err, ErrOTPAttemptsExceeded)
+
+	past := time.Now().Add(-time.Minute)
+	config.DB.Model(challenge).Updates(map[string]interface{}{"locked_until": past, "last_sent_at": past.Add(-time.Hour)})
+
+	// the used up code stays refused, but a new one can be requested with fresh attempts
+	_, err = VerifyOTP(user.Email, "1234", OTPPurposeLogin)
+	assert.ErrorIs(t, err, ErrOTPExpired)
+
+	assert.NoError(t, SendOTP(user.Email, OTPPurposeLogin))
+	assert.Len(t, recorder.To(user.Email), 1)
+
+	latest, err := latestChallenge(user.ID, OTPPurposeLogin)
+	assert.NoError(t, err)
+	assert.Equal(t, uint(0), latest.Attempts)
+	assert.Nil(t, latest.LockedUntil)
+}
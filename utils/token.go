@@ -0,0 +1,251 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"os"
+	"project/libraryManagement/config"
+	"project/libraryManagement/models"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidToken        = errors.New("invalid token")
+	ErrSessionRevoked      = errors.New("session has been revoked")
+	ErrSessionExpired      = errors.New("session has expired, please log in again")
+	ErrRefreshTokenReused  = errors.New("refresh token has already been used, all sessions have been revoked")
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+)
+
+// access token claims
+type Claims struct {
+	Email     string `json:"email"`
+	Role      string `json:"role"`
+	SessionID uint   `json:"sid"`
+	jwt.RegisteredClaims
+}
+
+// access and refresh token issued on login or refresh
+type TokenPair struct {
+	AccessToken      string    `json:"token"`
+	AccessExpiresAt  time.Time `json:"expiresAt"`
+	RefreshToken     string    `json:"refreshToken"`
+	RefreshExpiresAt time.Time `json:"refreshExpiresAt"`
+}
+
+// token lifetimes, configurable through the environment
+func AccessTokenTTL() time.Duration {
+	return config.GetEnvDuration("ACCESS_TOKEN_TTL", 15*time.Minute)
+}
+
+func RefreshTokenTTL() time.Duration {
+	return config.GetEnvDuration("REFRESH_TOKEN_TTL", 30*24*time.Hour)
+}
+
+// random url safe string
+func randomToken(size int) (string, error) {
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// refresh tokens are only stored as a hash
+func hashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// generate an access token for the session
+func GenerateToken(user *models.Users, session *models.Session) (string, time.Time, error) {
+	secret := []byte(os.Getenv("SECRET"))
+
+	jti, err := randomToken(16)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(AccessTokenTTL())
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{
+		Email:     user.Email,
+		Role:      user.Role,
+		SessionID: session.ID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   strconv.FormatUint(uint64(user.ID), 10),
+			ID:        jti,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+	})
+
+	tokenString, err := token.SignedString(secret)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	return tokenString, expiresAt, nil
+}
+
+// create a new session row and return its refresh token
+func newSession(tx *gorm.DB, user *models.Users, userAgent string, ip string) (*models.Session, string, error) {
+	refresh, err := randomToken(32)
+	if err != nil {
+		return nil, "", err
+	}
+
+	now := time.Now()
+	session := models.Session{
+		UserID:           user.ID,
+		RefreshTokenHash: hashRefreshToken(refresh),
+		UserAgent:        userAgent,
+		IP:               ip,
+		ExpiresAt:        now.Add(RefreshTokenTTL()),
+		LastUsedAt:       now,
+	}
+
+	res := tx.Create(&session)
+	if res.Error != nil {
+		return nil, "", res.Error
+	}
+
+	return &session, refresh, nil
+}
+
+// sign the access token for a freshly created session
+func tokenPair(user *models.Users, session *models.Session, refresh string) (*TokenPair, error) {
+	access, expiresAt, err := GenerateToken(user, session)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenPair{AccessToken: access, AccessExpiresAt: expiresAt, RefreshToken: refresh, RefreshExpiresAt: session.ExpiresAt}, nil
+}
+
+// start a new session for the user
+func CreateSession(user *models.Users, userAgent string, ip string) (*TokenPair, error) {
+	session, refresh, err := newSession(config.DB, user, userAgent, ip)
+	if err != nil {
+		return nil, err
+	}
+
+	return tokenPair(user, session, refresh)
+}
+
+// exchange a refresh token for a new token pair, the old refresh token stops working
+func RefreshSession(refreshToken string, userAgent string, ip string) (*models.Users, *TokenPair, error) {
+	var session models.Session
+	var user models.Users
+
+	res := config.DB.Where("refresh_token_hash = ?", hashRefreshToken(refreshToken)).First(&session)
+	if res.Error != nil {
+		return nil, nil, ErrInvalidRefreshToken
+	}
+
+	if session.RevokedAt != nil {
+		// a rotated token being presented again means it has leaked
+		if session.ReplacedByID != nil {
+			RevokeAllSessions(session.UserID)
+			return nil, nil, ErrRefreshTokenReused
+		}
+		return nil, nil, ErrSessionRevoked
+	}
+
+	if time.Now().After(session.ExpiresAt) {
+		return nil, nil, ErrSessionExpired
+	}
+
+	if err := config.DB.Preload("Library").First(&user, session.UserID).Error; err != nil {
+		return nil, nil, ErrInvalidRefreshToken
+	}
+
+	var next *models.Session
+	var refresh string
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		next, refresh, err = newSession(tx, &user, userAgent, ip)
+		if err != nil {
+			return err
+		}
+
+		// only one refresh can rotate the session
+		rotate := tx.Model(&models.Session{}).Where("id = ? AND revoked_at IS NULL", session.ID).
+			Updates(map[string]interface{}{"revoked_at": time.Now(), "replaced_by_id": next.ID})
+		if rotate.Error != nil {
+			return rotate.Error
+		}
+		if rotate.RowsAffected == 0 {
+			return ErrRefreshTokenReused
+		}
+
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, ErrRefreshTokenReused) {
+			RevokeAllSessions(session.UserID)
+		}
+		return nil, nil, err
+	}
+
+	pair, err := tokenPair(&user, next, refresh)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &user, pair, nil
+}
+
+// revoke a single session
+func RevokeSession(id uint) error {
+	return config.DB.Model(&models.Session{}).Where("id = ? AND revoked_at IS NULL", id).Update("revoked_at", time.Now()).Error
+}
+
+// revoke every session of the user, logging them out of all devices
+func RevokeAllSessions(userID uint) error {
+	return config.DB.Model(&models.Session{}).Where("user_id = ? AND revoked_at IS NULL", userID).Update("revoked_at", time.Now()).Error
+}
+
+// validate an access token and make sure its session is still active
+func ParseToken(tokenString string) (*Claims, error) {
+	secret := []byte(os.Getenv("SECRET"))
+	var claims Claims
+
+	token, err := jwt.ParseWithClaims(tokenString, &claims, func(token *jwt.Token) (interface{}, error) {
+		return secret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired(), jwt.WithIssuedAt())
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !token.Valid || claims.SessionID == 0 {
+		return nil, ErrInvalidToken
+	}
+
+	var session models.Session
+	res := config.DB.Where("id = ?", claims.SessionID).First(&session)
+	if res.Error != nil {
+		return nil, ErrInvalidToken
+	}
+
+	if session.RevokedAt != nil {
+		return nil, ErrSessionRevoked
+	}
+
+	if time.Now().After(session.ExpiresAt) {
+		return nil, ErrSessionExpired
+	}
+
+	return &claims, nil
+}
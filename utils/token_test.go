@@ -0,0 +1,96 @@
+package utils
+
+import (
+	"project/libraryManagement/config"
+	"project/libraryManagement/models"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRefreshRotatesTheSession(t *testing.T) {
+	setupDB(t)
+	user := createUser(t, "reader@library.test")
+
+	first, err := CreateSession(user, "laptop", "127.0.0.1")
+	assert.NoError(t, err)
+	claims, err := ParseToken(first.AccessToken)
+	assert.NoError(t, err)
+
+	refreshed, second, err := RefreshSession(first.RefreshToken, "laptop", "127.0.0.1")
+	assert.NoError(t, err)
+	assert.Equal(t, user.ID, refreshed.ID)
+	assert.NotEqual(t, first.RefreshToken, second.RefreshToken)
+
+	// the rotated session is over and points to the new one
+	_, err = ParseToken(first.AccessToken)
+	assert.ErrorIs(t, err, ErrSessionRevoked)
+	next, err := ParseToken(second.AccessToken)
+	assert.NoError(t, err)
+
+	var rotated models.Session
+	config.DB.First(&rotated, claims.SessionID)
+	assert.Equal(t, next.SessionID, *rotated.ReplacedByID)
+
+	// using the old refresh token again means it leaked: every session of the user is revoked
+	other, _ := CreateSession(user, "phone", "127.0.0.2")
+	_, _, err = RefreshSession(first.RefreshToken, "laptop", "127.0.0.1")
+	assert.ErrorIs(t, err, ErrRefreshTokenReused)
+
+	for _, token := range []string{second.AccessToken, other.AccessToken} {
+		_, err = ParseToken(token)
+		assert.ErrorIs(t, err, ErrSessionRevoked)
+	}
+	_, _, err = RefreshSession(second.RefreshToken, "laptop", "127.0.0.1")
+	assert.ErrorIs(t, err, ErrSessionRevoked)
+
+	// sessions of other users are left alone
+	someone := createUser(t, "someone@library.test")
+	theirs, _ := CreateSession(someone, "laptop", "127.0.0.3")
+	_, _, err = RefreshSession(first.RefreshToken, "laptop", "127.0.0.1")
+	assert.ErrorIs(t, err, ErrRefreshTokenReused)
+	_, err = ParseToken(theirs.AccessToken)
+	assert.NoError(t, err)
+
+	// expired and unknown refresh tokens are refused
+	expired, _ := CreateSession(user, "laptop", "127.0.0.1")
+	config.DB.Model(&models.Session{}).Where("user_id = ? AND revoked_at IS NULL", user.ID).Update("expires_at", time.Now().Add(-time.Second))
+	_, _, err = RefreshSession(expired.RefreshToken, "laptop", "127.0.0.1")
+	assert.ErrorIs(t, err, ErrSessionExpired)
+	_, _, err = RefreshSession("unknown", "laptop", "127.0.0.1")
+	assert.ErrorIs(t, err, ErrInvalidRefreshToken)
+}
+
+func TestLogout(t *testing.T) {
+	setupDB(t)
+	user := createUser(t, "reader@library.test")
+
+	laptop, _ := CreateSession(user, "laptop", "127.0.0.1")
+	phone, _ := CreateSession(user, "phone", "127.0.0.2")
+	tablet, _ := CreateSession(user, "tablet", "127.0.0.3")
+
+	// logging out ends the current session only
+	claims, err := ParseToken(laptop.AccessToken)
+	assert.NoError(t, err)
+	assert.NoError(t, RevokeSession(claims.SessionID))
+
+	_, err = ParseToken(laptop.AccessToken)
+	assert.ErrorIs(t, err, ErrSessionRevoked)
+	_, _, err = RefreshSession(laptop.RefreshToken, "laptop", "127.0.0.1")
+	assert.ErrorIs(t, err, ErrSessionRevoked)
+	_, err = ParseToken(phone.AccessToken)
+	assert.NoError(t, err)
+
+	// logging out of all devices ends the others too
+	assert.NoError(t, RevokeAllSessions(user.ID))
+	for _, pair := range []*TokenPair{phone, tablet} {
+		_, err = ParseToken(pair.AccessToken)
+		assert.ErrorIs(t, err, ErrSessionRevoked)
+	}
+
+	// a new login starts a new session
+	fresh, _ := CreateSession(user, "laptop", "127.0.0.1")
+	_, err = ParseToken(fresh.AccessToken)
+	assert.NoError(t, err)
+}